@@ -21,8 +21,13 @@ func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Va
 	r.Put("/asteroid/content", h.sync)
 	r.Get("/asteroids", h.list)
 	r.Get("/asteroid", h.get)
+	r.Get("/asteroid/render", h.render)
 	r.Get("/linked/from/asteroids", h.listLinkedFrom)
 	r.Get("/linked/to/asteroids", h.listLinkedTo)
+	r.Post("/asteroid!star", h.star)
+	r.Post("/asteroid!unstar", h.unstar)
+	r.Get("/starred/asteroids", h.listStarred)
+	r.Get("/viewed/asteroids", h.listViewed)
 }
 
 type handler struct {
@@ -170,10 +175,27 @@ func (h *handler) sync(c *fiber.Ctx) error {
 }
 
 func (h *handler) list(c *fiber.Ctx) error {
-	asts, err := h.asteroidService.List(c.Context())
-	if err != nil {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Sort  string `json:"sort"`
+		Order string `json:"order" validate:"omitempty,oneof=asc desc"`
+	}
+	if err := c.QueryParser(&input); err != nil {
 		return errors.WithStack(gerrors.ErrParamsParsingFailed)
 	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	asts, err := h.asteroidService.List(c.Context(), &asteroid.ListOptions{
+		SortBy: asteroid.SortField(input.Sort),
+		Desc:   input.Order == "desc",
+	})
+	if err != nil {
+		return err
+	}
 	toJ := make([]*Item, 0, len(asts))
 	for _, ast := range asts {
 		toJ = append(toJ, MakeItemPresenter(ast))
@@ -264,3 +286,106 @@ func (h *handler) listLinkedTo(c *fiber.Ctx) error {
 	}
 	return c.JSON(toJ)
 }
+
+func (h *handler) star(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	return h.asteroidService.Star(c.Context(), astID)
+}
+
+func (h *handler) unstar(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	return h.asteroidService.Unstar(c.Context(), astID)
+}
+
+func (h *handler) listStarred(c *fiber.Ctx) error {
+	_ = h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+	asts, err := h.asteroidService.ListStarred(c.Context())
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Item, 0, len(asts))
+	for _, ast := range asts {
+		toJ = append(toJ, MakeItemPresenter(ast))
+	}
+	return c.JSON(toJ)
+}
+
+func (h *handler) listViewed(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Limit int `json:"limit"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+
+	asts, err := h.asteroidService.ListViewed(c.Context(), input.Limit)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Item, 0, len(asts))
+	for _, ast := range asts {
+		toJ = append(toJ, MakeItemPresenter(ast))
+	}
+	return c.JSON(toJ)
+}
+
+func (h *handler) render(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	rendered, err := h.asteroidService.Render(c.Context(), astID)
+	if err != nil {
+		return err
+	}
+	toJ := MakeRenderedPresenter(rendered)
+	return c.JSON(toJ)
+}
@@ -13,6 +13,9 @@ type Asteroid struct {
 	Content     string    `json:"content"`
 	CreatedTime time.Time `json:"created_time"`
 	UpdatedTime time.Time `json:"updated_time"`
+
+	ViewCount      int64     `json:"view_count"`
+	LastViewedTime time.Time `json:"last_viewed_time"`
 }
 
 func MakeAsteroidPresenter(ast *asteroid.Asteroid) *Asteroid {
@@ -23,19 +26,71 @@ func MakeAsteroidPresenter(ast *asteroid.Asteroid) *Asteroid {
 		Content:     ast.Content,
 		CreatedTime: ast.CreatedTime,
 		UpdatedTime: ast.UpdatedTime,
+
+		ViewCount:      ast.ViewCount,
+		LastViewedTime: ast.LastViewedTime,
 	}
 }
 
 type Item struct {
-	ID    string `json:"id"`
-	Hub   bool   `json:"hub"`
-	Title string `json:"title"`
+	ID             string    `json:"id"`
+	Hub            bool      `json:"hub"`
+	Title          string    `json:"title"`
+	ViewCount      int64     `json:"view_count"`
+	LastViewedTime time.Time `json:"last_viewed_time"`
 }
 
 func MakeItemPresenter(ast *asteroid.Asteroid) *Item {
 	return &Item{
-		ID:    ast.ID.Hex(),
-		Hub:   ast.Hub,
-		Title: ast.Title,
+		ID:             ast.ID.Hex(),
+		Hub:            ast.Hub,
+		Title:          ast.Title,
+		ViewCount:      ast.ViewCount,
+		LastViewedTime: ast.LastViewedTime,
+	}
+}
+
+type Rendered struct {
+	HTML    string          `json:"html"`
+	Outline []*Heading      `json:"outline"`
+	Links   []*InternalLink `json:"links"`
+}
+
+type Heading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+}
+
+type InternalLink struct {
+	Target     string `json:"target"`
+	AsteroidID string `json:"asteroid_id,omitempty"`
+	Title      string `json:"title,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Broken     bool   `json:"broken"`
+}
+
+func MakeRenderedPresenter(r *asteroid.Rendered) *Rendered {
+	toJ := &Rendered{
+		HTML:    r.HTML,
+		Outline: make([]*Heading, 0, len(r.Outline)),
+		Links:   make([]*InternalLink, 0, len(r.Links)),
+	}
+	for _, h := range r.Outline {
+		toJ.Outline = append(toJ.Outline, &Heading{
+			Level:  h.Level,
+			Text:   h.Text,
+			Anchor: h.Anchor,
+		})
+	}
+	for _, link := range r.Links {
+		toJ.Links = append(toJ.Links, &InternalLink{
+			Target:     link.Target,
+			AsteroidID: link.AsteroidID,
+			Title:      link.Title,
+			URL:        link.URL,
+			Broken:     link.Broken,
+		})
 	}
+	return toJ
 }
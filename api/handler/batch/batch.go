@@ -0,0 +1,75 @@
+package batch
+
+import (
+	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/api/middleware/requestid"
+	"github.com/ProjectOort/oort-server/biz/batch"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, batchService *batch.Service) {
+	h := &handler{logger, validate, batchService}
+
+	r.Post("/batch", h.apply)
+}
+
+type handler struct {
+	logger       *zap.Logger
+	validate     *validator.Validate
+	batchService *batch.Service
+}
+
+func (h *handler) apply(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Ops []struct {
+			Op           string  `json:"op" validate:"required"`
+			TempID       string  `json:"temp_id"`
+			ID           string  `json:"id"`
+			Hub          *bool   `json:"hub"`
+			Title        *string `json:"title"`
+			Content      *string `json:"content"`
+			From         string  `json:"from"`
+			To           string  `json:"to"`
+			CollectionID string  `json:"collection_id"`
+			ItemID       string  `json:"item_id"`
+		} `json:"ops" validate:"required,dive"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	ops := make([]*batch.Op, 0, len(input.Ops))
+	for _, op := range input.Ops {
+		ops = append(ops, &batch.Op{
+			Type:         batch.OpType(op.Op),
+			TempID:       op.TempID,
+			ID:           op.ID,
+			Hub:          op.Hub,
+			Title:        op.Title,
+			Content:      op.Content,
+			From:         op.From,
+			To:           op.To,
+			CollectionID: op.CollectionID,
+			ItemID:       op.ItemID,
+		})
+	}
+
+	results, err := h.batchService.Apply(c.Context(), ops)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Result, 0, len(results))
+	for _, result := range results {
+		toJ = append(toJ, MakeResultPresenter(result))
+	}
+	return c.JSON(toJ)
+}
@@ -0,0 +1,19 @@
+package batch
+
+import "github.com/ProjectOort/oort-server/biz/batch"
+
+type Result struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	TempID string `json:"temp_id,omitempty"`
+	ID     string `json:"id"`
+}
+
+func MakeResultPresenter(result *batch.Result) *Result {
+	return &Result{
+		Index:  result.Index,
+		Op:     string(result.Type),
+		TempID: result.TempID,
+		ID:     result.ID.Hex(),
+	}
+}
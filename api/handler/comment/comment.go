@@ -0,0 +1,214 @@
+package comment
+
+import (
+	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/api/middleware/requestid"
+	"github.com/ProjectOort/oort-server/biz/comment"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, commentService *comment.Service) {
+	h := &handler{logger, validate, commentService}
+
+	r.Post("/comment", h.create)
+	r.Put("/comment", h.edit)
+	r.Delete("/comment", h.delete)
+	r.Post("/comment!resolve", h.resolve)
+	r.Get("/comments", h.listThreads)
+	r.Get("/comment/replies", h.listReplies)
+}
+
+type handler struct {
+	logger         *zap.Logger
+	validate       *validator.Validate
+	commentService *comment.Service
+}
+
+func (h *handler) create(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string `json:"asteroid_id" validate:"required_without=ParentID"`
+		ParentID   string `json:"parent_id"`
+		Content    string `json:"content" validate:"required"`
+		Anchor     *struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		} `json:"anchor"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	cmt := &comment.Comment{Content: input.Content}
+	if input.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(input.ParentID)
+		if err != nil {
+			return err
+		}
+		cmt.ParentID = &parentID
+	} else {
+		astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+		if err != nil {
+			return err
+		}
+		cmt.AsteroidID = astID
+	}
+	if input.Anchor != nil {
+		cmt.Anchor = &comment.Anchor{Start: input.Anchor.Start, End: input.Anchor.End}
+	}
+
+	cmt, err := h.commentService.Create(c.Context(), cmt)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCommentPresenter(cmt)
+	return c.JSON(toJ)
+}
+
+func (h *handler) edit(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID      string `json:"id" validate:"required"`
+		Content string `json:"content" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	cmtID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	cmt, err := h.commentService.Edit(c.Context(), cmtID, input.Content)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCommentPresenter(cmt)
+	return c.JSON(toJ)
+}
+
+func (h *handler) delete(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	cmtID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	return h.commentService.Delete(c.Context(), cmtID)
+}
+
+func (h *handler) resolve(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID       string `json:"id" validate:"required"`
+		Resolved *bool  `json:"resolved" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	cmtID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	cmt, err := h.commentService.Resolve(c.Context(), cmtID, *input.Resolved)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCommentPresenter(cmt)
+	return c.JSON(toJ)
+}
+
+func (h *handler) listThreads(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string `json:"asteroid_id" query:"asteroid_id" validate:"required"`
+		Page       int    `json:"page"`
+		Size       int    `json:"size"`
+		Resolved   *bool  `json:"resolved"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+	if err != nil {
+		return err
+	}
+	cmts, total, err := h.commentService.ListThreads(c.Context(), astID, &comment.ListOptions{
+		Page:     input.Page,
+		Size:     input.Size,
+		Resolved: input.Resolved,
+	})
+	if err != nil {
+		return err
+	}
+	toJ := MakePagePresenter(cmts, total)
+	return c.JSON(toJ)
+}
+
+func (h *handler) listReplies(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID   string `json:"id" validate:"required"`
+		Page int    `json:"page"`
+		Size int    `json:"size"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	threadID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	cmts, total, err := h.commentService.ListReplies(c.Context(), threadID, &comment.ListOptions{
+		Page: input.Page,
+		Size: input.Size,
+	})
+	if err != nil {
+		return err
+	}
+	toJ := MakePagePresenter(cmts, total)
+	return c.JSON(toJ)
+}
@@ -0,0 +1,68 @@
+package comment
+
+import (
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/comment"
+)
+
+type Comment struct {
+	ID           string     `json:"id"`
+	AsteroidID   string     `json:"asteroid_id"`
+	AuthorID     string     `json:"author_id"`
+	ParentID     string     `json:"parent_id,omitempty"`
+	Content      string     `json:"content"`
+	Anchor       *Anchor    `json:"anchor,omitempty"`
+	Resolved     bool       `json:"resolved"`
+	ResolvedTime *time.Time `json:"resolved_time,omitempty"`
+	ReplyCount   int64      `json:"reply_count"`
+	CreatedTime  time.Time  `json:"created_time"`
+	UpdatedTime  time.Time  `json:"updated_time"`
+}
+
+type Anchor struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Quote string `json:"quote"`
+}
+
+type Page struct {
+	Total int64      `json:"total"`
+	Items []*Comment `json:"items"`
+}
+
+func MakeCommentPresenter(cmt *comment.Comment) *Comment {
+	c := &Comment{
+		ID:           cmt.ID.Hex(),
+		AsteroidID:   cmt.AsteroidID.Hex(),
+		AuthorID:     cmt.AuthorID.Hex(),
+		Content:      cmt.Content,
+		Resolved:     cmt.Resolved,
+		ResolvedTime: cmt.ResolvedTime,
+		ReplyCount:   cmt.ReplyCount,
+		CreatedTime:  cmt.CreatedTime,
+		UpdatedTime:  cmt.UpdatedTime,
+	}
+	if cmt.ParentID != nil {
+		c.ParentID = cmt.ParentID.Hex()
+	}
+	if cmt.Anchor != nil {
+		c.Anchor = &Anchor{
+			Start: cmt.Anchor.Start,
+			End:   cmt.Anchor.End,
+			Quote: cmt.Anchor.Quote,
+		}
+	}
+	return c
+}
+
+func MakePagePresenter(cmts []*comment.Comment, total int64) *Page {
+	p := &Page{
+		Total: total,
+		Items: make([]*Comment, 0, len(cmts)),
+	}
+	for _, cmt := range cmts {
+		p.Items = append(p.Items, MakeCommentPresenter(cmt))
+	}
+	return p
+}
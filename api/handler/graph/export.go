@@ -0,0 +1,321 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// exporter encodes a graph into a format other tools can open.
+type exporter struct {
+	mime      string
+	extension string
+	encode    func(*graph.Graph) ([]byte, error)
+}
+
+const _FormatJSON = "json"
+
+var _Exporters = map[string]*exporter{
+	"graphml":   {"application/graphml+xml", "graphml", encodeGraphML},
+	"gexf":      {"application/gexf+xml", "gexf", encodeGEXF},
+	"dot":       {"text/vnd.graphviz", "dot", encodeDOT},
+	"cytoscape": {"application/vnd.cytoscape+json", "cyjs", encodeCytoscape},
+}
+
+// _AcceptedFormats are tried against the Accept header in order, JSON first so
+// that clients accepting anything keep getting the presenter format.
+var _AcceptedFormats = []string{fiber.MIMEApplicationJSON, "application/graphml+xml", "application/gexf+xml", "text/vnd.graphviz", "application/vnd.cytoscape+json"}
+
+// negotiateFormat picks the export format from the format parameter, or from
+// the Accept header when there's none.
+func negotiateFormat(c *fiber.Ctx, format string) string {
+	if format != "" {
+		return format
+	}
+	accepted := c.Accepts(_AcceptedFormats...)
+	for name, e := range _Exporters {
+		if e.mime == accepted {
+			return name
+		}
+	}
+	return _FormatJSON
+}
+
+// respondGraph writes the graph in the requested format, exports are sent as attachments.
+func respondGraph(c *fiber.Ctx, format string, gph *graph.Graph) error {
+	e, ok := _Exporters[negotiateFormat(c, format)]
+	if !ok {
+		return c.JSON(MakeGraphPresenter(gph))
+	}
+	body, err := e.encode(gph)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Attachment("graph." + e.extension)
+	c.Set(fiber.HeaderContentType, e.mime)
+	return c.Send(body)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+func encodeGraphML(gph *graph.Graph) ([]byte, error) {
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "title", For: "node", Name: "title", Type: "string"},
+			{ID: "hub", For: "node", Name: "hub", Type: "boolean"},
+			{ID: "created_time", For: "node", Name: "created_time", Type: "string"},
+			{ID: "updated_time", For: "node", Name: "updated_time", Type: "string"},
+			{ID: "type", For: "edge", Name: "type", Type: "string"},
+			{ID: "edge_created_time", For: "edge", Name: "created_time", Type: "string"},
+		},
+		Graph: graphMLGraph{
+			ID:          "oort",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, 0, len(gph.Nodes)),
+			Edges:       make([]graphMLEdge, 0, len(gph.Links)),
+		},
+	}
+	for _, node := range gph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{Key: "title", Value: node.Title},
+				{Key: "hub", Value: strconv.FormatBool(node.Hub)},
+				{Key: "created_time", Value: formatTime(node.CreatedTime)},
+				{Key: "updated_time", Value: formatTime(node.UpdatedTime)},
+			},
+		})
+	}
+	for i, link := range gph.Links {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: link.Source,
+			Target: link.Target,
+			Data: []graphMLData{
+				{Key: "type", Value: string(graph.RelationRefer)},
+				{Key: "edge_created_time", Value: formatTime(link.CreatedTime)},
+			},
+		})
+	}
+	return marshalXML(doc)
+}
+
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Mode            string           `xml:"mode,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID     string      `xml:"id,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string      `xml:"id,attr"`
+	Source string      `xml:"source,attr"`
+	Target string      `xml:"target,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+func encodeGEXF(gph *graph.Graph) ([]byte, error) {
+	doc := gexfDocument{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: []gexfAttribute{
+					{ID: "hub", Title: "hub", Type: "boolean"},
+					{ID: "created_time", Title: "created_time", Type: "string"},
+					{ID: "updated_time", Title: "updated_time", Type: "string"},
+				}},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "type", Title: "type", Type: "string"},
+					{ID: "created_time", Title: "created_time", Type: "string"},
+				}},
+			},
+			Nodes: make([]gexfNode, 0, len(gph.Nodes)),
+			Edges: make([]gexfEdge, 0, len(gph.Links)),
+		},
+	}
+	for _, node := range gph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:    node.ID,
+			Label: node.Title,
+			Values: []gexfValue{
+				{For: "hub", Value: strconv.FormatBool(node.Hub)},
+				{For: "created_time", Value: formatTime(node.CreatedTime)},
+				{For: "updated_time", Value: formatTime(node.UpdatedTime)},
+			},
+		})
+	}
+	for i, link := range gph.Links {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: link.Source,
+			Target: link.Target,
+			Label:  string(graph.RelationRefer),
+			Values: []gexfValue{
+				{For: "type", Value: string(graph.RelationRefer)},
+				{For: "created_time", Value: formatTime(link.CreatedTime)},
+			},
+		})
+	}
+	return marshalXML(doc)
+}
+
+func marshalXML(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+var _DOTEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+
+func quoteDOT(s string) string {
+	return `"` + _DOTEscaper.Replace(s) + `"`
+}
+
+func encodeDOT(gph *graph.Graph) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("digraph oort {\n")
+	for _, node := range gph.Nodes {
+		shape := "ellipse"
+		if node.Hub {
+			shape = "box"
+		}
+		fmt.Fprintf(&buf, "  %s [label=%s, shape=%s, hub=%t, created_time=%s, updated_time=%s];\n",
+			quoteDOT(node.ID), quoteDOT(node.Title), shape, node.Hub,
+			quoteDOT(formatTime(node.CreatedTime)), quoteDOT(formatTime(node.UpdatedTime)))
+	}
+	for _, link := range gph.Links {
+		fmt.Fprintf(&buf, "  %s -> %s [type=%s, created_time=%s];\n", quoteDOT(link.Source), quoteDOT(link.Target),
+			quoteDOT(string(graph.RelationRefer)), quoteDOT(formatTime(link.CreatedTime)))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+type cytoscapeDocument struct {
+	Elements cytoscapeElements `json:"elements"`
+}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeElement `json:"nodes"`
+	Edges []cytoscapeElement `json:"edges"`
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func encodeCytoscape(gph *graph.Graph) ([]byte, error) {
+	doc := cytoscapeDocument{
+		Elements: cytoscapeElements{
+			Nodes: make([]cytoscapeElement, 0, len(gph.Nodes)),
+			Edges: make([]cytoscapeElement, 0, len(gph.Links)),
+		},
+	}
+	for _, node := range gph.Nodes {
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{Data: map[string]interface{}{
+			"id":           node.ID,
+			"title":        node.Title,
+			"hub":          node.Hub,
+			"created_time": formatTime(node.CreatedTime),
+			"updated_time": formatTime(node.UpdatedTime),
+		}})
+	}
+	for i, link := range gph.Links {
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{Data: map[string]interface{}{
+			"id":           "e" + strconv.Itoa(i),
+			"source":       link.Source,
+			"target":       link.Target,
+			"type":         string(graph.RelationRefer),
+			"created_time": formatTime(link.CreatedTime),
+		}})
+	}
+	return json.Marshal(doc)
+}
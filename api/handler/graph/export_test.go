@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// _TrickyTitle holds every character the formats have to escape, and one XML
+// can't hold at all.
+const _TrickyTitle = "a < b & \"c\" > 'd' \\ e\nf\x01"
+
+func exportedGraph() *graph.Graph {
+	created := time.Date(2022, 4, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	return &graph.Graph{
+		Nodes: []graph.Node{
+			{ID: "a", Title: _TrickyTitle, Hub: true, CreatedTime: created, UpdatedTime: created},
+			{ID: "b", Title: "plain"},
+		},
+		Links: []graph.Link{{Source: "a", Target: "b", CreatedTime: created}},
+	}
+}
+
+// wellFormed reads the XML document to its end.
+func wellFormed(t *testing.T, body []byte) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err, string(body))
+	}
+}
+
+func TestEncodeXML(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(*graph.Graph) ([]byte, error)
+		// title reads the title of the first node back.
+		title func(t *testing.T, body []byte) string
+	}{
+		{"graphml", encodeGraphML, func(t *testing.T, body []byte) string {
+			var doc graphMLDocument
+			require.NoError(t, xml.Unmarshal(body, &doc))
+			require.Len(t, doc.Graph.Nodes, 2)
+			require.Len(t, doc.Graph.Edges, 1)
+			assert.Equal(t, "a", doc.Graph.Edges[0].Source)
+			assert.Equal(t, "2022-04-01T00:00:00Z", doc.Graph.Nodes[0].Data[2].Value)
+			return doc.Graph.Nodes[0].Data[0].Value
+		}},
+		{"gexf", encodeGEXF, func(t *testing.T, body []byte) string {
+			var doc gexfDocument
+			require.NoError(t, xml.Unmarshal(body, &doc))
+			require.Len(t, doc.Graph.Nodes, 2)
+			require.Len(t, doc.Graph.Edges, 1)
+			assert.Equal(t, "b", doc.Graph.Edges[0].Target)
+			assert.Equal(t, "true", doc.Graph.Nodes[0].Values[0].Value)
+			return doc.Graph.Nodes[0].Label
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.encode(exportedGraph())
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(body, []byte(xml.Header)))
+			assert.NotContains(t, string(body), "a < b")
+			wellFormed(t, body)
+			// the control character isn't allowed in XML and is replaced.
+			assert.Equal(t, "a < b & \"c\" > 'd' \\ e\nf�", tt.title(t, body))
+		})
+	}
+}
+
+func TestEncodeDOT(t *testing.T) {
+	body, err := encodeDOT(exportedGraph())
+	require.NoError(t, err)
+	assert.Equal(t, "digraph oort {\n"+
+		`  "a" [label="a < b & \"c\" > 'd' \\ e\nf`+"\x01"+`", shape=box, hub=true, created_time="2022-04-01T00:00:00Z", updated_time="2022-04-01T00:00:00Z"];`+"\n"+
+		`  "b" [label="plain", shape=ellipse, hub=false, created_time="", updated_time=""];`+"\n"+
+		`  "a" -> "b" [type="REFER", created_time="2022-04-01T00:00:00Z"];`+"\n"+
+		"}\n", string(body))
+}
+
+func TestQuoteDOT(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"", `""`},
+		{`say "hi"`, `"say \"hi\""`},
+		// a trailing backslash must not escape the closing quote.
+		{`dir\`, `"dir\\"`},
+		{"two\r\nlines", `"two\nlines"`},
+		{"<b>&", `"<b>&"`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, quoteDOT(tt.in), tt.in)
+	}
+}
+
+func TestEncodeCytoscape(t *testing.T) {
+	body, err := encodeCytoscape(exportedGraph())
+	require.NoError(t, err)
+	var doc struct {
+		Elements struct {
+			Nodes []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"nodes"`
+			Edges []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"edges"`
+		} `json:"elements"`
+	}
+	require.NoError(t, json.Unmarshal(body, &doc))
+	require.Len(t, doc.Elements.Nodes, 2)
+	require.Len(t, doc.Elements.Edges, 1)
+	assert.Equal(t, _TrickyTitle, doc.Elements.Nodes[0].Data["title"])
+	assert.Equal(t, true, doc.Elements.Nodes[0].Data["hub"])
+	assert.Equal(t, map[string]interface{}{
+		"id":           "e0",
+		"source":       "a",
+		"target":       "b",
+		"type":         "REFER",
+		"created_time": "2022-04-01T00:00:00Z",
+	}, doc.Elements.Edges[0].Data)
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(negotiateFormat(c, c.Query("format")))
+	})
+	tests := []struct {
+		format, accept, want string
+	}{
+		{"", "", _FormatJSON},
+		{"", "*/*", _FormatJSON},
+		{"", "application/graphml+xml", "graphml"},
+		{"", "text/html, application/gexf+xml;q=0.9", "gexf"},
+		{"", "text/vnd.graphviz", "dot"},
+		{"", "application/vnd.cytoscape+json", "cytoscape"},
+		{"", "text/html", _FormatJSON},
+		// the parameter wins over the header.
+		{"dot", "application/graphml+xml", "dot"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/?format="+tt.format, nil)
+		if tt.accept != "" {
+			req.Header.Set(fiber.HeaderAccept, tt.accept)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, string(body), "format %q, accept %q", tt.format, tt.accept)
+	}
+}
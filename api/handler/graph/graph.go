@@ -1,6 +1,13 @@
 package graph
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
 	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
 	"github.com/ProjectOort/oort-server/api/middleware/requestid"
 	"github.com/ProjectOort/oort-server/biz/graph"
@@ -11,25 +18,45 @@ import (
 	"go.uber.org/zap"
 )
 
-func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, graphService *graph.Service) {
-	h := handler{logger, validate, graphService}
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, graphService *graph.Service, analyticsService *graph.AnalyticsService) {
+	h := handler{logger, validate, graphService, analyticsService}
 
 	r.Get("/graph/asteroid", h.getByAsteroidID)
+	r.Get("/graph/collection", h.getByCollectionID)
 	r.Get("/graph/full", h.getFull)
+	r.Get("/graph/full/stream", h.streamFull)
+	r.Get("/graph/hygiene", h.hygiene)
+	r.Get("/graph/hubs/tree", h.hubTree)
+	r.Get("/graph/breadcrumbs", h.breadcrumbs)
+	r.Get("/graph/path", h.shortestPath)
+	r.Get("/graph/paths", h.paths)
+	r.Get("/graph/ranking", h.ranking)
+	r.Get("/graph/clusters", h.clusters)
+	r.Post("/graph/layout!pin", h.pin)
+	r.Post("/graph/layout!unpin", h.unpin)
+	r.Get("/graph/timeline", h.timeline)
 }
 
 type handler struct {
-	logger       *zap.Logger
-	validate     *validator.Validate
-	graphService *graph.Service
+	logger           *zap.Logger
+	validate         *validator.Validate
+	graphService     *graph.Service
+	analyticsService *graph.AnalyticsService
 }
 
 func (h *handler) getByAsteroidID(c *fiber.Ctx) error {
 	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
 
 	var input struct {
-		ID    string `json:"id"`
-		Depth int    `json:"depth"`
+		ID         string `json:"id"`
+		Depth      int    `json:"depth"`
+		Direction  string `json:"direction"`
+		Limit      int    `json:"limit"`
+		Centrality bool   `json:"centrality"`
+		Cluster    bool   `json:"cluster"`
+		Layout     bool   `json:"layout"`
+		Format     string `json:"format" validate:"omitempty,oneof=json graphml gexf dot cytoscape"`
+		AsOf       string `json:"as_of" query:"as_of" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 	}
 	if err := c.QueryParser(&input); err != nil {
 		return errors.WithStack(gerrors.ErrParamsParsingFailed)
@@ -43,20 +70,444 @@ func (h *handler) getByAsteroidID(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	gph, err := h.graphService.GetByAsteroidID(c.Context(), astID, input.Depth)
+	asOf, err := parseAsOf(input.AsOf)
 	if err != nil {
 		return err
 	}
-	toJ := MakeGraphPresenter(gph)
-	return c.JSON(toJ)
+	gph, err := h.graphService.GetByAsteroidID(c.Context(), &graph.NeighborhoodQuery{
+		AsteroidID: astID,
+		Depth:      input.Depth,
+		Direction:  graph.Direction(input.Direction),
+		Limit:      input.Limit,
+		AsOf:       asOf,
+	})
+	if err != nil {
+		return err
+	}
+	opts := &graph.AnnotateOptions{
+		Centrality: input.Centrality,
+		Cluster:    input.Cluster,
+		Layout:     input.Layout,
+		Past:       !asOf.IsZero(),
+	}
+	if err := h.analyticsService.Annotate(c.Context(), gph, opts); err != nil {
+		return err
+	}
+	return respondGraph(c, input.Format, gph)
+}
+
+func (h *handler) getByCollectionID(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID         string `json:"id" validate:"required"`
+		Hops       int    `json:"hops"`
+		Direction  string `json:"direction"`
+		Limit      int    `json:"limit"`
+		Centrality bool   `json:"centrality"`
+		Cluster    bool   `json:"cluster"`
+		Layout     bool   `json:"layout"`
+		Format     string `json:"format" validate:"omitempty,oneof=json graphml gexf dot cytoscape"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	colID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	gph, err := h.graphService.GetByCollection(c.Context(), &graph.CollectionQuery{
+		CollectionID: colID,
+		Hops:         input.Hops,
+		Direction:    graph.Direction(input.Direction),
+		Limit:        input.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	opts := &graph.AnnotateOptions{Centrality: input.Centrality, Cluster: input.Cluster, Layout: input.Layout}
+	if err := h.analyticsService.Annotate(c.Context(), gph, opts); err != nil {
+		return err
+	}
+	return respondGraph(c, input.Format, gph)
 }
 
 func (h *handler) getFull(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Centrality bool   `json:"centrality"`
+		Cluster    bool   `json:"cluster"`
+		Layout     bool   `json:"layout"`
+		Format     string `json:"format" validate:"omitempty,oneof=json graphml gexf dot cytoscape"`
+		AsOf       string `json:"as_of" query:"as_of" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	asOf, err := parseAsOf(input.AsOf)
+	if err != nil {
+		return err
+	}
+	gph, err := h.graphService.GetFull(c.Context(), asOf)
+	if err != nil {
+		return err
+	}
+	opts := &graph.AnnotateOptions{
+		Centrality: input.Centrality,
+		Cluster:    input.Cluster,
+		Layout:     input.Layout,
+		Full:       asOf.IsZero(),
+		Past:       !asOf.IsZero(),
+	}
+	if err := h.analyticsService.Annotate(c.Context(), gph, opts); err != nil {
+		return err
+	}
+	return respondGraph(c, input.Format, gph)
+}
+
+func (h *handler) hygiene(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Group string `json:"group"`
+		Page  int    `json:"page"`
+		Size  int    `json:"size"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	var kinds []graph.HygieneKind
+	if input.Group != "" {
+		kinds = append(kinds, graph.HygieneKind(input.Group))
+	}
+	groups, err := h.graphService.Hygiene(c.Context(), kinds, input.Page, input.Size)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*HygieneGroup, 0, len(groups))
+	for _, group := range groups {
+		toJ = append(toJ, MakeHygieneGroupPresenter(group))
+	}
+	return c.JSON(toJ)
+}
+
+func (h *handler) hubTree(c *fiber.Ctx) error {
+	_ = h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+	tree, err := h.graphService.HubTree(c.Context())
+	if err != nil {
+		return err
+	}
+	toJ := MakeHubTreePresenter(tree)
+	return c.JSON(toJ)
+}
+
+func (h *handler) breadcrumbs(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	paths, err := h.graphService.Breadcrumbs(c.Context(), astID)
+	if err != nil {
+		return err
+	}
+	toJ := make([][]Node, 0, len(paths))
+	for _, path := range paths {
+		toJ = append(toJ, makeNodes(path))
+	}
+	return c.JSON(toJ)
+}
+
+type pathInput struct {
+	From      string `json:"from" validate:"required"`
+	To        string `json:"to" validate:"required"`
+	MaxLength int    `json:"max_length" query:"max_length"`
+	Directed  bool   `json:"directed"`
+	// Relation is a comma separated list of relation types.
+	Relation string `json:"relation"`
+	K        int    `json:"k"`
+}
+
+func (input *pathInput) toQuery() (*graph.PathQuery, error) {
+	from, err := primitive.ObjectIDFromHex(input.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := primitive.ObjectIDFromHex(input.To)
+	if err != nil {
+		return nil, err
+	}
+	q := &graph.PathQuery{
+		From:      from,
+		To:        to,
+		MaxLength: input.MaxLength,
+		Directed:  input.Directed,
+		Limit:     input.K,
+	}
+	for _, typ := range strings.Split(input.Relation, ",") {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			q.RelationTypes = append(q.RelationTypes, graph.RelationType(typ))
+		}
+	}
+	return q, nil
+}
+
+func (h *handler) shortestPath(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input pathInput
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	q, err := input.toQuery()
+	if err != nil {
+		return err
+	}
+	path, err := h.graphService.ShortestPath(c.Context(), q)
+	if err != nil {
+		return err
+	}
+	toJ := MakeGraphPresenter(path)
+	return c.JSON(toJ)
+}
+
+func (h *handler) paths(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input pathInput
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	q, err := input.toQuery()
+	if err != nil {
+		return err
+	}
+	paths, err := h.graphService.Paths(c.Context(), q)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Graph, 0, len(paths))
+	for _, path := range paths {
+		toJ = append(toJ, MakeGraphPresenter(path))
+	}
+	return c.JSON(toJ)
+}
+
+func (h *handler) ranking(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Metric string `json:"metric"`
+		Size   int    `json:"size"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	nodes, err := h.analyticsService.Rank(c.Context(), graph.Metric(input.Metric), input.Size)
+	if err != nil {
+		return err
+	}
+	toJ := makeNodes(nodes)
+	return c.JSON(toJ)
+}
+
+func (h *handler) clusters(c *fiber.Ctx) error {
 	_ = h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
-	gph, err := h.graphService.GetFull(c.Context())
+	clusters, err := h.analyticsService.Clusters(c.Context())
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		toJ = append(toJ, MakeClusterPresenter(cluster))
+	}
+	return c.JSON(toJ)
+}
+
+func (h *handler) pin(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string  `json:"id" validate:"required"`
+		X  float64 `json:"x"`
+		Y  float64 `json:"y"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
 	if err != nil {
 		return err
 	}
-	toJ := MakeGraphPresenter(gph)
+	return h.analyticsService.Pin(c.Context(), astID, input.X, input.Y)
+}
+
+func (h *handler) unpin(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	return h.analyticsService.Unpin(c.Context(), astID)
+}
+
+// parseAsOf parses the validated as_of parameter, zero when it's empty.
+func parseAsOf(asOf string) (time.Time, error) {
+	if asOf == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, asOf)
+}
+
+func (h *handler) timeline(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Interval string `json:"interval"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	points, err := h.graphService.Timeline(c.Context(), graph.Interval(input.Interval))
+	if err != nil {
+		return err
+	}
+	toJ := make([]*TimelinePoint, 0, len(points))
+	for _, point := range points {
+		toJ = append(toJ, MakeTimelinePointPresenter(point))
+	}
 	return c.JSON(toJ)
 }
+
+// streamFull writes the full graph as NDJSON, one node or link per line as
+// they are read, ended by a summary line or an error line.
+func (h *handler) streamFull(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	// the stream is written after the handler returns, when the request
+	// context can't be used anymore. Its own context is canceled once the
+	// client is gone, which closes the cursors reading the graph.
+	ctx, cancel := context.WithCancel(auth.NewContext(context.Background(), auth.FromCtx(c)))
+
+	c.Set(fiber.HeaderContentType, _MIMEApplicationNDJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		v := &ndjsonVisitor{ctx: ctx, cancel: cancel, w: w, enc: json.NewEncoder(w)}
+		summary, err := h.graphService.StreamFull(ctx, v)
+		if ctx.Err() != nil {
+			log.Infow("the client left the full graph stream", "records", v.records)
+			return
+		}
+		if err != nil {
+			log.Errorw("failed to stream the full graph", "error", err)
+			_ = v.enc.Encode(&StreamError{Type: _RecordError, Message: "图谱读取失败"})
+		} else {
+			_ = v.enc.Encode(MakeStreamSummaryPresenter(summary))
+		}
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// ndjsonVisitor writes every node and link on its own line, flushing
+// regularly so that the client receives them as they come. A failed write
+// means the client is gone, and cancels the stream.
+type ndjsonVisitor struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	w       *bufio.Writer
+	enc     *json.Encoder
+	records int
+}
+
+const _FlushEvery = 200
+
+func (v *ndjsonVisitor) write(record interface{}) error {
+	if err := v.ctx.Err(); err != nil {
+		return err
+	}
+	if err := v.enc.Encode(record); err != nil {
+		v.cancel()
+		return err
+	}
+	if v.records++; v.records%_FlushEvery == 0 {
+		if err := v.w.Flush(); err != nil {
+			v.cancel()
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *ndjsonVisitor) VisitNode(node graph.Node) error {
+	return v.write(&StreamNode{Type: _RecordNode, Node: makeNode(node)})
+}
+
+func (v *ndjsonVisitor) VisitLink(link graph.Link) error {
+	return v.write(&StreamLink{Type: _RecordLink, Link: makeLink(link)})
+}
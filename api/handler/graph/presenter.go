@@ -1,40 +1,232 @@
 package graph
 
-import "github.com/ProjectOort/oort-server/biz/graph"
+import (
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/graph"
+)
 
 type Graph struct {
-	Nodes []Node `json:"nodes"`
-	Links []Link `json:"links"`
+	Nodes     []Node `json:"nodes"`
+	Links     []Link `json:"links"`
+	Truncated bool   `json:"truncated,omitempty"`
 }
 
 type Node struct {
-	ID    string `json:"id"`
-	Hub   bool   `json:"hub"`
-	Title string `json:"title"`
+	ID           string      `json:"id"`
+	Hub          bool        `json:"hub"`
+	Title        string      `json:"title"`
+	Centrality   *Centrality `json:"centrality,omitempty"`
+	Cluster      *int        `json:"cluster,omitempty"`
+	Distance     *int        `json:"distance,omitempty"`
+	InCollection *bool       `json:"in_collection,omitempty"`
+	X            *float64    `json:"x,omitempty"`
+	Y            *float64    `json:"y,omitempty"`
+	Pinned       bool        `json:"pinned,omitempty"`
+}
+
+type Centrality struct {
+	PageRank    float64 `json:"pagerank"`
+	InDegree    int     `json:"in_degree"`
+	OutDegree   int     `json:"out_degree"`
+	Betweenness float64 `json:"betweenness"`
+}
+
+func makeNode(node graph.Node) Node {
+	n := Node{
+		ID:           node.ID,
+		Hub:          node.Hub,
+		Title:        node.Title,
+		Cluster:      node.Cluster,
+		Distance:     node.Distance,
+		InCollection: node.InCollection,
+	}
+	if p := node.Position; p != nil {
+		x, y := p.X, p.Y
+		n.X, n.Y, n.Pinned = &x, &y, p.Pinned
+	}
+	if c := node.Centrality; c != nil {
+		n.Centrality = &Centrality{
+			PageRank:    c.PageRank,
+			InDegree:    c.InDegree,
+			OutDegree:   c.OutDegree,
+			Betweenness: c.Betweenness,
+		}
+	}
+	return n
 }
 
 type Link struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+	Source      string     `json:"source"`
+	Target      string     `json:"target"`
+	CreatedTime *time.Time `json:"created_time,omitempty"`
+}
+
+func makeLink(link graph.Link) Link {
+	l := Link{
+		Source: link.Source,
+		Target: link.Target,
+	}
+	if !link.CreatedTime.IsZero() {
+		createdTime := link.CreatedTime
+		l.CreatedTime = &createdTime
+	}
+	return l
 }
 
 func MakeGraphPresenter(gph *graph.Graph) *Graph {
 	g := &Graph{
-		Nodes: make([]Node, len(gph.Nodes)),
-		Links: make([]Link, len(gph.Links)),
+		Nodes:     make([]Node, len(gph.Nodes)),
+		Links:     make([]Link, len(gph.Links)),
+		Truncated: gph.Truncated,
 	}
 	for i, node := range gph.Nodes {
-		g.Nodes[i] = Node{
-			ID:    node.ID,
-			Hub:   node.Hub,
-			Title: node.Title,
-		}
+		g.Nodes[i] = makeNode(node)
 	}
 	for i, link := range gph.Links {
-		g.Links[i] = Link{
-			Source: link.Source,
-			Target: link.Target,
-		}
+		g.Links[i] = makeLink(link)
 	}
 	return g
 }
+
+type HygieneGroup struct {
+	Group string `json:"group"`
+	Total int64  `json:"total"`
+	Nodes []Node `json:"nodes"`
+}
+
+func MakeHygieneGroupPresenter(group *graph.HygieneGroup) *HygieneGroup {
+	g := &HygieneGroup{
+		Group: string(group.Kind),
+		Total: group.Total,
+		Nodes: make([]Node, len(group.Nodes)),
+	}
+	for i, node := range group.Nodes {
+		g.Nodes[i] = makeNode(node)
+	}
+	return g
+}
+
+func makeNodes(nodes []graph.Node) []Node {
+	res := make([]Node, len(nodes))
+	for i, node := range nodes {
+		res[i] = makeNode(node)
+	}
+	return res
+}
+
+type TreeNode struct {
+	ID       string      `json:"id"`
+	Title    string      `json:"title"`
+	Children []*TreeNode `json:"children"`
+}
+
+type HubTree struct {
+	Roots      []*TreeNode `json:"roots"`
+	CycleLinks []Link      `json:"cycle_links"`
+	ExtraLinks []Link      `json:"extra_links"`
+}
+
+func makeTreeNode(tn *graph.TreeNode) *TreeNode {
+	n := &TreeNode{
+		ID:       tn.ID,
+		Title:    tn.Title,
+		Children: make([]*TreeNode, len(tn.Children)),
+	}
+	for i, child := range tn.Children {
+		n.Children[i] = makeTreeNode(child)
+	}
+	return n
+}
+
+func makeLinks(links []graph.Link) []Link {
+	res := make([]Link, len(links))
+	for i, link := range links {
+		res[i] = makeLink(link)
+	}
+	return res
+}
+
+func MakeHubTreePresenter(tree *graph.HubTree) *HubTree {
+	t := &HubTree{
+		Roots:      make([]*TreeNode, len(tree.Roots)),
+		CycleLinks: makeLinks(tree.CycleLinks),
+		ExtraLinks: makeLinks(tree.ExtraLinks),
+	}
+	for i, root := range tree.Roots {
+		t.Roots[i] = makeTreeNode(root)
+	}
+	return t
+}
+
+type Cluster struct {
+	ID      int  `json:"id"`
+	Size    int  `json:"size"`
+	Central Node `json:"central"`
+}
+
+func MakeClusterPresenter(cluster *graph.Cluster) *Cluster {
+	return &Cluster{
+		ID:      cluster.ID,
+		Size:    cluster.Size,
+		Central: makeNode(cluster.Central),
+	}
+}
+
+type TimelinePoint struct {
+	Time         time.Time `json:"time"`
+	Nodes        int       `json:"nodes"`
+	Links        int       `json:"links"`
+	NodesAdded   int       `json:"nodes_added"`
+	LinksAdded   int       `json:"links_added"`
+	LinksRemoved int       `json:"links_removed"`
+}
+
+func MakeTimelinePointPresenter(point *graph.TimelinePoint) *TimelinePoint {
+	return &TimelinePoint{
+		Time:         point.Time,
+		Nodes:        point.Nodes,
+		Links:        point.Links,
+		NodesAdded:   point.NodesAdded,
+		LinksAdded:   point.LinksAdded,
+		LinksRemoved: point.LinksRemoved,
+	}
+}
+
+const (
+	_MIMEApplicationNDJSON = "application/x-ndjson"
+
+	_RecordNode    = "node"
+	_RecordLink    = "link"
+	_RecordSummary = "summary"
+	_RecordError   = "error"
+)
+
+type StreamNode struct {
+	Type string `json:"type"`
+	Node
+}
+
+type StreamLink struct {
+	Type string `json:"type"`
+	Link
+}
+
+type StreamSummary struct {
+	Type  string `json:"type"`
+	Nodes int64  `json:"nodes"`
+	Links int64  `json:"links"`
+}
+
+type StreamError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func MakeStreamSummaryPresenter(summary *graph.StreamSummary) *StreamSummary {
+	return &StreamSummary{
+		Type:  _RecordSummary,
+		Nodes: summary.Nodes,
+		Links: summary.Links,
+	}
+}
@@ -0,0 +1,38 @@
+package query
+
+import (
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/query"
+)
+
+type Asteroid struct {
+	ID          string    `json:"id"`
+	Hub         bool      `json:"hub"`
+	Type        int       `json:"type"`
+	Title       string    `json:"title"`
+	ViewCount   int64     `json:"view_count"`
+	CreatedTime time.Time `json:"created_time"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+type Result struct {
+	Items     []*Asteroid `json:"items"`
+	Truncated bool        `json:"truncated"`
+}
+
+func MakeResultPresenter(r *query.Result) *Result {
+	items := make([]*Asteroid, 0, len(r.Asteroids))
+	for _, ast := range r.Asteroids {
+		items = append(items, &Asteroid{
+			ID:          ast.ID.Hex(),
+			Hub:         ast.Hub,
+			Type:        ast.Type,
+			Title:       ast.Title,
+			ViewCount:   ast.ViewCount,
+			CreatedTime: ast.CreatedTime,
+			UpdatedTime: ast.UpdatedTime,
+		})
+	}
+	return &Result{Items: items, Truncated: r.Truncated}
+}
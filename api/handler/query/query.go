@@ -0,0 +1,45 @@
+package query
+
+import (
+	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/api/middleware/requestid"
+	"github.com/ProjectOort/oort-server/biz/query"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, queryService *query.Service) {
+	h := &handler{logger, validate, queryService}
+
+	r.Get("/query", h.run)
+}
+
+type handler struct {
+	logger       *zap.Logger
+	validate     *validator.Validate
+	queryService *query.Service
+}
+
+func (h *handler) run(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Q     string `json:"q" validate:"required"`
+		Limit int    `json:"limit"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	result, err := h.queryService.Run(c.Context(), input.Q, input.Limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(MakeResultPresenter(result))
+}
@@ -0,0 +1,59 @@
+package review
+
+import (
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/review"
+)
+
+type Card struct {
+	AsteroidID  string    `json:"asteroid_id"`
+	Tags        []string  `json:"tags"`
+	Repetitions int       `json:"repetitions"`
+	IntervalDay int       `json:"interval_day"`
+	EaseFactor  float64   `json:"ease_factor"`
+	DueTime     time.Time `json:"due_time"`
+	Stats       Stats     `json:"stats"`
+}
+
+type Stats struct {
+	Reviews          int       `json:"reviews"`
+	Lapses           int       `json:"lapses"`
+	LastGrade        int       `json:"last_grade"`
+	AverageGrade     float64   `json:"average_grade"`
+	LastReviewedTime time.Time `json:"last_reviewed_time"`
+}
+
+type Item struct {
+	Card
+	Hub     bool   `json:"hub"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+func MakeCardPresenter(card *review.Card) *Card {
+	return &Card{
+		AsteroidID:  card.AsteroidID.Hex(),
+		Tags:        card.Tags,
+		Repetitions: card.Repetitions,
+		IntervalDay: card.IntervalDay,
+		EaseFactor:  card.EaseFactor,
+		DueTime:     card.DueTime,
+		Stats: Stats{
+			Reviews:          card.Stats.Reviews,
+			Lapses:           card.Stats.Lapses,
+			LastGrade:        card.Stats.LastGrade,
+			AverageGrade:     card.Stats.AverageGrade(),
+			LastReviewedTime: card.Stats.LastReviewedTime,
+		},
+	}
+}
+
+func MakeItemPresenter(item *review.Item) *Item {
+	return &Item{
+		Card:    *MakeCardPresenter(item.Card),
+		Hub:     item.Asteroid.Hub,
+		Title:   item.Asteroid.Title,
+		Content: item.Asteroid.Content,
+	}
+}
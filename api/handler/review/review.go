@@ -0,0 +1,173 @@
+package review
+
+import (
+	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/api/middleware/requestid"
+	"github.com/ProjectOort/oort-server/biz/review"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, reviewService *review.Service) {
+	h := &handler{logger, validate, reviewService}
+
+	r.Post("/review/card", h.enroll)
+	r.Delete("/review/card", h.unenroll)
+	r.Get("/review/card", h.get)
+	r.Post("/review/card!grade", h.grade)
+	r.Get("/review/due", h.due)
+}
+
+type handler struct {
+	logger        *zap.Logger
+	validate      *validator.Validate
+	reviewService *review.Service
+}
+
+func (h *handler) enroll(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string   `json:"asteroid_id" validate:"required"`
+		Tags       []string `json:"tags"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+	if err != nil {
+		return err
+	}
+	card, err := h.reviewService.Enroll(c.Context(), astID, input.Tags)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCardPresenter(card)
+	return c.JSON(toJ)
+}
+
+func (h *handler) unenroll(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string `json:"asteroid_id" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+	if err != nil {
+		return err
+	}
+	return h.reviewService.Unenroll(c.Context(), astID)
+}
+
+func (h *handler) get(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string `json:"asteroid_id" query:"asteroid_id" validate:"required"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+	if err != nil {
+		return err
+	}
+	card, err := h.reviewService.Get(c.Context(), astID)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCardPresenter(card)
+	return c.JSON(toJ)
+}
+
+func (h *handler) grade(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		AsteroidID string `json:"asteroid_id" validate:"required"`
+		Grade      *int   `json:"grade" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "body", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.AsteroidID)
+	if err != nil {
+		return err
+	}
+	card, err := h.reviewService.Grade(c.Context(), astID, *input.Grade)
+	if err != nil {
+		return err
+	}
+	toJ := MakeCardPresenter(card)
+	return c.JSON(toJ)
+}
+
+func (h *handler) due(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		HubID        string `json:"hub_id" query:"hub_id"`
+		CollectionID string `json:"collection_id" query:"collection_id"`
+		Tag          string `json:"tag"`
+		Limit        int    `json:"limit"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	query := &review.DueQuery{Tag: input.Tag, Limit: input.Limit}
+	if input.HubID != "" {
+		hubID, err := primitive.ObjectIDFromHex(input.HubID)
+		if err != nil {
+			return err
+		}
+		query.HubID = &hubID
+	}
+	if input.CollectionID != "" {
+		colID, err := primitive.ObjectIDFromHex(input.CollectionID)
+		if err != nil {
+			return err
+		}
+		query.CollectionID = &colID
+	}
+
+	items, err := h.reviewService.Due(c.Context(), query)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Item, 0, len(items))
+	for _, item := range items {
+		toJ = append(toJ, MakeItemPresenter(item))
+	}
+	return c.JSON(toJ)
+}
@@ -1,12 +1,17 @@
 package search
 
-import "github.com/ProjectOort/oort-server/biz/search"
+import (
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/search"
+)
 
 type Item struct {
 	Type     int      `json:"type"`
 	TargetID string   `json:"target_id"`
 	Title    string   `json:"title"`
 	Content  []string `json:"content"`
+	Score    float64  `json:"score"`
 }
 
 func MakeItemPresenter(item *search.Item) *Item {
@@ -15,5 +20,65 @@ func MakeItemPresenter(item *search.Item) *Item {
 		TargetID: item.TargetID,
 		Title:    item.Title,
 		Content:  item.Content,
+		Score:    item.Score,
+	}
+}
+
+type Result struct {
+	Total int64   `json:"total"`
+	Items []*Item `json:"items"`
+}
+
+func MakeResultPresenter(result *search.Result) *Result {
+	r := &Result{
+		Total: result.Total,
+		Items: make([]*Item, 0, len(result.Items)),
+	}
+	for _, item := range result.Items {
+		r.Items = append(r.Items, MakeItemPresenter(item))
+	}
+	return r
+}
+
+type TypeCount struct {
+	Type  int    `json:"type"`
+	Name  string `json:"name"`
+	Total int64  `json:"total"`
+}
+
+type MultiResult struct {
+	Total  int64        `json:"total"`
+	Counts []*TypeCount `json:"counts"`
+	Items  []*Item      `json:"items"`
+}
+
+func MakeMultiResultPresenter(result *search.MultiResult) *MultiResult {
+	r := &MultiResult{
+		Total:  result.Total,
+		Counts: make([]*TypeCount, 0, len(result.Counts)),
+		Items:  make([]*Item, 0, len(result.Items)),
+	}
+	for _, count := range result.Counts {
+		r.Counts = append(r.Counts, &TypeCount{Type: count.Type, Name: count.Name, Total: count.Total})
+	}
+	for _, item := range result.Items {
+		r.Items = append(r.Items, MakeItemPresenter(item))
+	}
+	return r
+}
+
+type Completion struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Hub         bool      `json:"hub"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+func MakeCompletionPresenter(c *search.Completion) *Completion {
+	return &Completion{
+		ID:          c.ID.Hex(),
+		Title:       c.Title,
+		Hub:         c.Hub,
+		UpdatedTime: c.UpdatedTime,
 	}
 }
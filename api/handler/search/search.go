@@ -1,43 +1,157 @@
 package search
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
 	"github.com/ProjectOort/oort-server/api/middleware/requestid"
 	"github.com/ProjectOort/oort-server/biz/search"
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-func RegisterHandlers(r fiber.Router, logger *zap.Logger, searchService *search.Service) {
-	h := handler{logger: logger, searchService: searchService}
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, searchService *search.Service) {
+	h := handler{logger: logger, validate: validate, searchService: searchService}
 
+	r.Get("search", h.search)
 	r.Get("search/asteroid", h.searchAsteroid)
+	r.Get("search/title", h.completeTitle)
 }
 
 type handler struct {
 	logger        *zap.Logger
+	validate      *validator.Validate
 	searchService *search.Service
 }
 
+func (h *handler) search(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Text  string   `json:"text"`
+		Page  int      `json:"page"`
+		Size  int      `json:"size"`
+		Types []string `json:"types"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	result, err := h.searchService.Search(c.Context(), &search.MultiQuery{
+		Text:  input.Text,
+		Page:  input.Page,
+		Size:  input.Size,
+		Types: input.Types,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(MakeMultiResultPresenter(result))
+}
+
 func (h *handler) searchAsteroid(c *fiber.Ctx) error {
 	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
 
 	var input struct {
-		Text string `json:"text"`
+		Text        string `json:"text"`
+		Page        int    `json:"page"`
+		Size        int    `json:"size"`
+		Sort        string `json:"sort"`
+		Order       string `json:"order" validate:"omitempty,oneof=asc desc"`
+		Hub         string `json:"hub" validate:"omitempty,oneof=true false"`
+		Type        string `json:"type" validate:"omitempty,number"`
+		CreatedFrom string `json:"created_from" query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		CreatedTo   string `json:"created_to" query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		UpdatedFrom string `json:"updated_from" query:"updated_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+		UpdatedTo   string `json:"updated_to" query:"updated_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 	}
 	if err := c.QueryParser(&input); err != nil {
 		return errors.WithStack(gerrors.ErrParamsParsingFailed)
 	}
 	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
 
-	items, err := h.searchService.Asteroid(c.Context(), input.Text)
+	q := &search.Query{
+		Text:   input.Text,
+		Page:   input.Page,
+		Size:   input.Size,
+		SortBy: search.SortField(input.Sort),
+		Desc:   input.Order == "desc",
+	}
+	if input.Hub != "" {
+		hub := input.Hub == "true"
+		q.Hub = &hub
+	}
+	if input.Type != "" {
+		typ, err := strconv.Atoi(input.Type)
+		if err != nil {
+			return errors.WithStack(gerrors.ErrParamsParsingFailed)
+		}
+		q.Type = &typ
+	}
+	var err error
+	if q.Created, err = parseTimeRange(input.CreatedFrom, input.CreatedTo); err != nil {
+		return err
+	}
+	if q.Updated, err = parseTimeRange(input.UpdatedFrom, input.UpdatedTo); err != nil {
+		return err
+	}
+
+	result, err := h.searchService.Asteroid(c.Context(), q)
 	if err != nil {
 		return err
 	}
-	toJ := make([]*Item, 0, len(items))
-	for _, item := range items {
-		toJ = append(toJ, MakeItemPresenter(item))
+	return c.JSON(MakeResultPresenter(result))
+}
+
+func (h *handler) completeTitle(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		Prefix string `json:"prefix"`
+		Limit  int    `json:"limit"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	completions, err := h.searchService.CompleteTitle(c.Context(), input.Prefix, input.Limit)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Completion, 0, len(completions))
+	for _, completion := range completions {
+		toJ = append(toJ, MakeCompletionPresenter(completion))
 	}
 	return c.JSON(toJ)
 }
+
+// parseTimeRange parses the validated bounds of a range, either can be empty.
+func parseTimeRange(from, to string) (search.TimeRange, error) {
+	var r search.TimeRange
+	var err error
+	if from != "" {
+		if r.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return r, err
+		}
+	}
+	if to != "" {
+		if r.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
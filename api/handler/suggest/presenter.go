@@ -0,0 +1,27 @@
+package suggest
+
+import "github.com/ProjectOort/oort-server/biz/suggest"
+
+type Suggestion struct {
+	ID              string  `json:"id"`
+	Hub             bool    `json:"hub"`
+	Title           string  `json:"title"`
+	Score           float64 `json:"score"`
+	Similarity      float64 `json:"similarity"`
+	Mention         float64 `json:"mention"`
+	Proximity       float64 `json:"proximity"`
+	SharedNeighbors int     `json:"shared_neighbors"`
+}
+
+func MakeSuggestionPresenter(s *suggest.Suggestion) *Suggestion {
+	return &Suggestion{
+		ID:              s.Asteroid.ID.Hex(),
+		Hub:             s.Asteroid.Hub,
+		Title:           s.Asteroid.Title,
+		Score:           s.Score,
+		Similarity:      s.Similarity,
+		Mention:         s.Mention,
+		Proximity:       s.Proximity,
+		SharedNeighbors: s.SharedNeighbors,
+	}
+}
@@ -0,0 +1,54 @@
+package suggest
+
+import (
+	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/api/middleware/requestid"
+	"github.com/ProjectOort/oort-server/biz/suggest"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func RegisterHandlers(r fiber.Router, logger *zap.Logger, validate *validator.Validate, suggestService *suggest.Service) {
+	h := &handler{logger, validate, suggestService}
+
+	r.Get("/suggested/links", h.links)
+}
+
+type handler struct {
+	logger         *zap.Logger
+	validate       *validator.Validate
+	suggestService *suggest.Service
+}
+
+func (h *handler) links(c *fiber.Ctx) error {
+	log := h.logger.Named("[HANDLER]").With(zap.String("request_id", requestid.FromCtx(c))).Sugar()
+
+	var input struct {
+		ID    string `json:"id" validate:"required"`
+		Limit int    `json:"limit"`
+	}
+	if err := c.QueryParser(&input); err != nil {
+		return errors.WithStack(gerrors.ErrParamsParsingFailed)
+	}
+	log.Debugw("parsed params", "query", input)
+	if err := h.validate.Struct(input); err != nil {
+		return err
+	}
+
+	astID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return err
+	}
+	suggestions, err := h.suggestService.Links(c.Context(), astID, input.Limit)
+	if err != nil {
+		return err
+	}
+	toJ := make([]*Suggestion, 0, len(suggestions))
+	for _, s := range suggestions {
+		toJ = append(toJ, MakeSuggestionPresenter(s))
+	}
+	return c.JSON(toJ)
+}
@@ -60,6 +60,12 @@ func FromCtx(c *fiber.Ctx) Info {
 	return c.Locals(_AccountIDKey).(Info)
 }
 
+// NewContext carries the account into a context detached from the request,
+// for work that outlives the handler such as streamed responses.
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, _AccountIDKey, info)
+}
+
 func FromContext(ctx context.Context) Info {
 	return ctx.Value(_AccountIDKey).(Info)
 }
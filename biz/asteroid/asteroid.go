@@ -18,4 +18,38 @@ type Asteroid struct {
 
 	Title   string `bson:"title"`
 	Content string `bson:"content"`
+
+	ViewCount      int64     `bson:"view_count"`
+	LastViewedTime time.Time `bson:"last_viewed_time"`
+}
+
+// MaxViewHistory bounds how many recently viewed asteroids are kept per account.
+const MaxViewHistory = 100
+
+type SortField string
+
+const (
+	SortByCreatedTime    SortField = "created_time"
+	SortByUpdatedTime    SortField = "updated_time"
+	SortByViewCount      SortField = "view_count"
+	SortByLastViewedTime SortField = "last_viewed_time"
+)
+
+func (x SortField) Valid() bool {
+	switch x {
+	case SortByCreatedTime, SortByUpdatedTime, SortByViewCount, SortByLastViewedTime:
+		return true
+	}
+	return false
+}
+
+type ListOptions struct {
+	SortBy SortField
+	Desc   bool
+}
+
+// CanView reports whether the account is allowed to view the asteroid.
+// Anything attached to an asteroid (comments, for instance) follows the same rule.
+func CanView(accID primitive.ObjectID, ast *Asteroid) bool {
+	return ast.AuthorID == accID
 }
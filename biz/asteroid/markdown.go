@@ -0,0 +1,226 @@
+package asteroid
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rendered is the sanitized HTML of an asteroid content, along with its
+// heading outline and the internal links found in it.
+type Rendered struct {
+	HTML    string
+	Outline []*Heading
+	Links   []*InternalLink
+}
+
+type Heading struct {
+	Level  int
+	Text   string
+	Anchor string
+}
+
+// InternalLink is either a Markdown link whose destination is an asteroid ID,
+// or a [[reference]] to an asteroid by ID or by title.
+type InternalLink struct {
+	Target     string
+	AsteroidID string
+	Title      string
+	URL        string
+	Broken     bool
+}
+
+// LinkResolver looks up the asteroids referenced by ID or by title. Asteroids
+// the current account cannot view must be left out.
+type LinkResolver func(ids []primitive.ObjectID, titles []string) ([]*Asteroid, error)
+
+// URLMaker turns an asteroid ID into the URL clients navigate to.
+type URLMaker func(astID string) string
+
+var (
+	_WikiLinksKey = parser.NewContextKey()
+
+	markdown = goldmark.New(
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithInlineParsers(
+				// must run before the default link parser which also triggers on '['.
+				util.Prioritized(&wikiLinkParser{}, 199),
+			),
+		),
+	)
+
+	sanitizer = newSanitizer()
+)
+
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").OnElements("a")
+	p.AllowAttrs("id").OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowDataAttributes()
+	return p
+}
+
+// linkRef is a link node waiting for its target to be resolved.
+type linkRef struct {
+	node   *ast.Link
+	target string
+	// labeled is false for [[target]], where the text is filled after resolving.
+	labeled bool
+}
+
+// wikiLinkParser parses [[target]] and [[target|label]] into link nodes, and
+// remembers them in the parser context so they can be resolved later.
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *wikiLinkParser) Parse(_ ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := line[2:end]
+	if len(inner) == 0 || bytes.ContainsAny(inner, "[]") {
+		return nil
+	}
+
+	target, label := string(inner), ""
+	if i := strings.IndexByte(target, '|'); i >= 0 {
+		target, label = target[:i], strings.TrimSpace(target[i+1:])
+	}
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil
+	}
+	block.Advance(end + 2)
+
+	link := ast.NewLink()
+	ref := &linkRef{node: link, target: target}
+	if label != "" {
+		link.AppendChild(link, ast.NewString([]byte(label)))
+		ref.labeled = true
+	}
+	refs, _ := pc.Get(_WikiLinksKey).([]*linkRef)
+	pc.Set(_WikiLinksKey, append(refs, ref))
+	return link
+}
+
+// RenderMarkdown renders the content into sanitized HTML with its internal
+// links resolved through resolve, and links that cannot be resolved marked as
+// broken.
+func RenderMarkdown(content string, resolve LinkResolver, makeURL URLMaker) (*Rendered, error) {
+	source := []byte(content)
+	pc := parser.NewContext()
+	doc := markdown.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+
+	wikiLinks, _ := pc.Get(_WikiLinksKey).([]*linkRef)
+	links := make([]*linkRef, 0, len(wikiLinks))
+	wikiNodes := make(map[*ast.Link]struct{}, len(wikiLinks))
+	for _, ref := range wikiLinks {
+		links = append(links, ref)
+		wikiNodes[ref.node] = struct{}{}
+	}
+
+	rendered := &Rendered{
+		Outline: make([]*Heading, 0),
+		Links:   make([]*InternalLink, 0),
+	}
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			heading := &Heading{Level: node.Level, Text: string(node.Text(source))}
+			if id, ok := node.AttributeString("id"); ok {
+				heading.Anchor = string(id.([]byte))
+			}
+			rendered.Outline = append(rendered.Outline, heading)
+		case *ast.Link:
+			if _, ok := wikiNodes[node]; ok {
+				break
+			}
+			if _, err := primitive.ObjectIDFromHex(string(node.Destination)); err == nil {
+				links = append(links, &linkRef{node: node, target: string(node.Destination), labeled: true})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// resolves all the references at once.
+	ids := make([]primitive.ObjectID, 0)
+	titles := make([]string, 0)
+	for _, link := range links {
+		if id, err := primitive.ObjectIDFromHex(link.target); err == nil {
+			ids = append(ids, id)
+		} else {
+			titles = append(titles, link.target)
+		}
+	}
+	byID := make(map[string]*Asteroid)
+	byTitle := make(map[string]*Asteroid)
+	if len(links) != 0 {
+		asts, err := resolve(ids, titles)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range asts {
+			byID[a.ID.Hex()] = a
+			if existed, ok := byTitle[a.Title]; !ok || a.CreatedTime.Before(existed.CreatedTime) {
+				byTitle[a.Title] = a
+			}
+		}
+	}
+
+	for _, link := range links {
+		target, ok := byID[link.target]
+		if !ok {
+			target, ok = byTitle[link.target]
+		}
+		il := &InternalLink{Target: link.target, Broken: !ok}
+		if ok {
+			il.AsteroidID = target.ID.Hex()
+			il.Title = target.Title
+			il.URL = makeURL(il.AsteroidID)
+
+			link.node.Destination = []byte(il.URL)
+			link.node.Title = []byte(il.Title)
+			link.node.SetAttributeString("class", []byte("internal-link"))
+			link.node.SetAttributeString("data-asteroid-id", []byte(il.AsteroidID))
+			if !link.labeled {
+				link.node.AppendChild(link.node, ast.NewString([]byte(il.Title)))
+			}
+		} else {
+			link.node.Destination = nil
+			link.node.SetAttributeString("class", []byte("internal-link broken-link"))
+			if !link.labeled {
+				link.node.AppendChild(link.node, ast.NewString([]byte(link.target)))
+			}
+		}
+		rendered.Links = append(rendered.Links, il)
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, source, doc); err != nil {
+		return nil, err
+	}
+	rendered.HTML = sanitizer.Sanitize(buf.String())
+	return rendered, nil
+}
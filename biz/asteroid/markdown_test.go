@@ -0,0 +1,80 @@
+package asteroid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	known := &Asteroid{ID: primitive.NewObjectID(), Title: "Known Note"}
+	missingID := primitive.NewObjectID().Hex()
+
+	var gotIDs []primitive.ObjectID
+	var gotTitles []string
+	resolve := func(ids []primitive.ObjectID, titles []string) ([]*Asteroid, error) {
+		gotIDs, gotTitles = ids, titles
+		return []*Asteroid{known}, nil
+	}
+	makeURL := func(id string) string { return "/asteroid/" + id }
+
+	src := "# Title\n\n" +
+		"## Section <b>one</b>\n\n" +
+		"See [[Known Note]], [[Unknown|label]], [by id](" + known.ID.Hex() + ") " +
+		"and [gone](" + missingID + ").\n\n" +
+		"[external](https://example.com) <script>alert(1)</script>\n"
+
+	r, err := RenderMarkdown(src, resolve, makeURL)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []primitive.ObjectID{known.ID, mustObjectID(missingID)}, gotIDs)
+	assert.ElementsMatch(t, []string{"Known Note", "Unknown"}, gotTitles)
+
+	if assert.Len(t, r.Outline, 2) {
+		assert.Equal(t, 1, r.Outline[0].Level)
+		assert.Equal(t, "Title", r.Outline[0].Text)
+		assert.Equal(t, "title", r.Outline[0].Anchor)
+		assert.Equal(t, 2, r.Outline[1].Level)
+	}
+
+	if assert.Len(t, r.Links, 4) {
+		links := make(map[string]*InternalLink)
+		for _, link := range r.Links {
+			links[link.Target] = link
+		}
+		assert.False(t, links["Known Note"].Broken)
+		assert.Equal(t, "/asteroid/"+known.ID.Hex(), links["Known Note"].URL)
+		assert.True(t, links["Unknown"].Broken)
+		assert.False(t, links[known.ID.Hex()].Broken)
+		assert.Equal(t, "Known Note", links[known.ID.Hex()].Title)
+		assert.True(t, links[missingID].Broken)
+	}
+
+	assert.Contains(t, r.HTML, `href="/asteroid/`+known.ID.Hex()+`"`)
+	assert.Contains(t, r.HTML, `class="internal-link"`)
+	assert.Contains(t, r.HTML, `data-asteroid-id="`+known.ID.Hex()+`"`)
+	assert.Contains(t, r.HTML, `>Known Note</a>`)
+	assert.Contains(t, r.HTML, `class="internal-link broken-link"`)
+	assert.Contains(t, r.HTML, `>label</a>`)
+	assert.Contains(t, r.HTML, `href="https://example.com"`)
+	assert.NotContains(t, r.HTML, "<script>")
+}
+
+func TestRenderMarkdownWithoutLinks(t *testing.T) {
+	r, err := RenderMarkdown("plain *text*", func([]primitive.ObjectID, []string) ([]*Asteroid, error) {
+		t.Fatal("resolver shouldn't be called without links")
+		return nil, nil
+	}, func(string) string { return "" })
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>plain <em>text</em></p>\n", r.HTML)
+	assert.Empty(t, r.Links)
+}
+
+func mustObjectID(hex string) primitive.ObjectID {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
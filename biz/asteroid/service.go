@@ -5,17 +5,22 @@ import (
 	bizerr "github.com/ProjectOort/oort-server/biz/errors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/conf"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 )
 
+const _DefaultClientURL = "/asteroid/{id}"
+
 type Service struct {
-	logger *zap.Logger
-	repo   Repo
+	logger    *zap.Logger
+	clientURL string
+	repo      Repo
 }
 
 type Repo interface {
@@ -25,15 +30,29 @@ type Repo interface {
 	UpdateContent(context.Context, *Asteroid) error
 	Get(context.Context, primitive.ObjectID) (*Asteroid, error)
 	List(context.Context, []primitive.ObjectID) ([]*Asteroid, error)
-	ListHub(context.Context, primitive.ObjectID) ([]*Asteroid, error)
+	ListHub(context.Context, primitive.ObjectID, *ListOptions) ([]*Asteroid, error)
+	ListByTitles(ctx context.Context, authorID primitive.ObjectID, titles []string) ([]*Asteroid, error)
+	// ListByAuthor lists every alive asteroid of the author, contents included.
+	ListByAuthor(ctx context.Context, authorID primitive.ObjectID) ([]*Asteroid, error)
 	ListLinkedFrom(context.Context, primitive.ObjectID) ([]*Asteroid, error)
 	ListLinkedTo(context.Context, primitive.ObjectID) ([]*Asteroid, error)
+
+	RecordView(ctx context.Context, accID, astID primitive.ObjectID, viewedTime time.Time) error
+	ListViewed(ctx context.Context, accID primitive.ObjectID, limit int) ([]*Asteroid, error)
+	Star(ctx context.Context, accID, astID primitive.ObjectID, starredTime time.Time) error
+	Unstar(ctx context.Context, accID, astID primitive.ObjectID) error
+	ListStarred(ctx context.Context, accID primitive.ObjectID) ([]*Asteroid, error)
 }
 
-func NewService(logger *zap.Logger, repo Repo) *Service {
+func NewService(logger *zap.Logger, cfg *conf.Asteroid, repo Repo) *Service {
+	clientURL := cfg.ClientURL
+	if clientURL == "" {
+		clientURL = _DefaultClientURL
+	}
 	return &Service{
-		logger: logger,
-		repo:   repo,
+		logger:    logger,
+		clientURL: clientURL,
+		repo:      repo,
 	}
 }
 
@@ -113,9 +132,16 @@ func (s *Service) Sync(ctx context.Context, ast *Asteroid) error {
 	return s.repo.UpdateContent(ctx, ast)
 }
 
-func (s *Service) List(ctx context.Context) ([]*Asteroid, error) {
+func (s *Service) List(ctx context.Context, opts *ListOptions) ([]*Asteroid, error) {
 	// TODO Add other type of asteroid query support
-	return s.repo.ListHub(ctx, auth.FromContext(ctx).ID)
+	if opts.SortBy == "" {
+		opts.SortBy = SortByCreatedTime
+	}
+	if !opts.SortBy.Valid() {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的排序字段").WrapSelf()
+	}
+	asts, err := s.repo.ListHub(ctx, auth.FromContext(ctx).ID, opts)
+	return asts, errors.WithStack(err)
 }
 
 func (s *Service) Get(ctx context.Context, astID primitive.ObjectID) (*Asteroid, error) {
@@ -126,12 +152,60 @@ func (s *Service) Get(ctx context.Context, astID primitive.ObjectID) (*Asteroid,
 		}
 		return nil, errors.WithStack(err)
 	}
-	if ast.AuthorID != auth.FromContext(ctx).ID {
+	accID := auth.FromContext(ctx).ID
+	if !CanView(accID, ast) {
 		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
 	}
+	// a failure to record the view shouldn't prevent the user from reading.
+	now := time.Now()
+	if err := s.repo.RecordView(ctx, accID, astID, now); err != nil {
+		s.logger.Warn("failed to record asteroid view", zap.String("asteroid_id", astID.Hex()), zap.Error(err))
+	} else {
+		ast.ViewCount++
+		ast.LastViewedTime = now
+	}
 	return ast, nil
 }
 
+func (s *Service) ListViewed(ctx context.Context, limit int) ([]*Asteroid, error) {
+	if limit <= 0 || limit > MaxViewHistory {
+		limit = MaxViewHistory
+	}
+	asts, err := s.repo.ListViewed(ctx, auth.FromContext(ctx).ID, limit)
+	return asts, errors.WithStack(err)
+}
+
+func (s *Service) Star(ctx context.Context, astID primitive.ObjectID) error {
+	accID := auth.FromContext(ctx).ID
+	if err := s.checkIfViewable(ctx, accID, astID); err != nil {
+		return err
+	}
+	return errors.WithStack(s.repo.Star(ctx, accID, astID, time.Now()))
+}
+
+func (s *Service) Unstar(ctx context.Context, astID primitive.ObjectID) error {
+	return errors.WithStack(s.repo.Unstar(ctx, auth.FromContext(ctx).ID, astID))
+}
+
+func (s *Service) ListStarred(ctx context.Context) ([]*Asteroid, error) {
+	asts, err := s.repo.ListStarred(ctx, auth.FromContext(ctx).ID)
+	return asts, errors.WithStack(err)
+}
+
+func (s *Service) checkIfViewable(ctx context.Context, accID, astID primitive.ObjectID) error {
+	ast, err := s.repo.Get(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+		}
+		return errors.WithStack(err)
+	}
+	if !CanView(accID, ast) {
+		return bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+	}
+	return nil
+}
+
 func (s *Service) ListLinkedFrom(ctx context.Context, astID primitive.ObjectID) ([]*Asteroid, error) {
 	ast, err := s.repo.Get(ctx, astID)
 	if err != nil {
@@ -140,7 +214,7 @@ func (s *Service) ListLinkedFrom(ctx context.Context, astID primitive.ObjectID)
 		}
 		return nil, err
 	}
-	if ast.AuthorID != auth.FromContext(ctx).ID {
+	if !CanView(auth.FromContext(ctx).ID, ast) {
 		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
 	}
 	asts, err := s.repo.ListLinkedFrom(ctx, astID)
@@ -155,9 +229,56 @@ func (s *Service) ListLinkedTo(ctx context.Context, astID primitive.ObjectID) ([
 		}
 		return nil, err
 	}
-	if ast.AuthorID != auth.FromContext(ctx).ID {
+	if !CanView(auth.FromContext(ctx).ID, ast) {
 		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
 	}
 	asts, err := s.repo.ListLinkedTo(ctx, astID)
 	return asts, errors.WithStack(err)
 }
+
+// Render renders the asteroid content into sanitized HTML, resolving its
+// internal links to the asteroids the current account can view.
+func (s *Service) Render(ctx context.Context, astID primitive.ObjectID) (*Rendered, error) {
+	accID := auth.FromContext(ctx).ID
+	ast, err := s.repo.Get(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if !CanView(accID, ast) {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+	}
+
+	resolve := func(ids []primitive.ObjectID, titles []string) ([]*Asteroid, error) {
+		found := make([]*Asteroid, 0, len(ids)+len(titles))
+		if len(ids) != 0 {
+			asts, err := s.repo.List(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, asts...)
+		}
+		if len(titles) != 0 {
+			asts, err := s.repo.ListByTitles(ctx, accID, titles)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, asts...)
+		}
+		viewable := make([]*Asteroid, 0, len(found))
+		for _, a := range found {
+			if a.State && CanView(accID, a) {
+				viewable = append(viewable, a)
+			}
+		}
+		return viewable, nil
+	}
+	makeURL := func(id string) string {
+		return strings.ReplaceAll(s.clientURL, "{id}", id)
+	}
+
+	rendered, err := RenderMarkdown(ast.Content, resolve, makeURL)
+	return rendered, errors.WithStack(err)
+}
@@ -0,0 +1,171 @@
+package batch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OpType string
+
+const (
+	OpCreate         OpType = "create"
+	OpUpdate         OpType = "update"
+	OpLink           OpType = "link"
+	OpUnlink         OpType = "unlink"
+	OpCollectionPush OpType = "collection_push"
+	OpCollectionPop  OpType = "collection_pop"
+)
+
+// MaxOps bounds the number of operations in a single batch.
+const MaxOps = 200
+
+// Op is an operation as the client sends it. Asteroid references (ID, From,
+// To and ItemID) are either hex object IDs or the TempID of an asteroid created
+// earlier in the same batch.
+type Op struct {
+	Type OpType
+
+	// create
+	TempID string
+	// create & update, nil fields are left untouched on update.
+	Hub     *bool
+	Title   *string
+	Content *string
+
+	// update
+	ID string
+
+	// link & unlink, From refers To.
+	From string
+	To   string
+
+	// collection_push & collection_pop
+	CollectionID string
+	ItemID       string
+}
+
+// Mutation is an Op with all its references resolved to object IDs.
+type Mutation struct {
+	Type OpType
+
+	// Asteroid is the asteroid to insert for create.
+	Asteroid *asteroid.Asteroid
+
+	AsteroidID  primitive.ObjectID
+	UpdatedTime time.Time
+	Hub         *bool
+	Title       *string
+	Content     *string
+
+	From primitive.ObjectID
+	To   primitive.ObjectID
+
+	CollectionID primitive.ObjectID
+	ItemID       primitive.ObjectID
+}
+
+type Result struct {
+	Index  int
+	Type   OpType
+	TempID string
+	// ID is the asteroid the operation applied to, or the collection for
+	// collection operations.
+	ID primitive.ObjectID
+}
+
+// OpError reports which operation of the batch is invalid.
+type OpError struct {
+	Index  int
+	Reason string
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("第 %d 个操作%s", e.Index+1, e.Reason)
+}
+
+// plan resolves the temporary IDs of ops in order and returns the mutations to
+// apply, together with the IDs of the pre-existing asteroids and collections
+// they touch so that the caller can check their ownership.
+func plan(ops []*Op) (muts []*Mutation, existingAsteroids []primitive.ObjectID, existingCollections []primitive.ObjectID, err error) {
+	tempIDs := make(map[string]primitive.ObjectID)
+	seenAsteroids := make(map[primitive.ObjectID]struct{})
+	seenCollections := make(map[primitive.ObjectID]struct{})
+
+	ref := func(i int, name, s string) (primitive.ObjectID, error) {
+		if s == "" {
+			return primitive.NilObjectID, &OpError{Index: i, Reason: fmt.Sprintf("缺少 %s", name)}
+		}
+		if id, ok := tempIDs[s]; ok {
+			return id, nil
+		}
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return primitive.NilObjectID, &OpError{Index: i, Reason: fmt.Sprintf("引用了未定义的临时 ID %q", s)}
+		}
+		if _, ok := seenAsteroids[id]; !ok {
+			seenAsteroids[id] = struct{}{}
+			existingAsteroids = append(existingAsteroids, id)
+		}
+		return id, nil
+	}
+
+	muts = make([]*Mutation, 0, len(ops))
+	for i, op := range ops {
+		mut := &Mutation{Type: op.Type}
+		switch op.Type {
+		case OpCreate:
+			if op.Hub == nil || op.Title == nil || *op.Title == "" {
+				return nil, nil, nil, &OpError{Index: i, Reason: "创建节点时 hub 和 title 不能为空"}
+			}
+			mut.AsteroidID = primitive.NewObjectID()
+			if op.TempID != "" {
+				if _, err := primitive.ObjectIDFromHex(op.TempID); err == nil {
+					return nil, nil, nil, &OpError{Index: i, Reason: "的临时 ID 不能是合法的 ObjectID"}
+				}
+				if _, ok := tempIDs[op.TempID]; ok {
+					return nil, nil, nil, &OpError{Index: i, Reason: fmt.Sprintf("的临时 ID %q 重复", op.TempID)}
+				}
+				tempIDs[op.TempID] = mut.AsteroidID
+			}
+			mut.Hub, mut.Title, mut.Content = op.Hub, op.Title, op.Content
+		case OpUpdate:
+			if mut.AsteroidID, err = ref(i, "id", op.ID); err != nil {
+				return nil, nil, nil, err
+			}
+			if op.Hub == nil && op.Title == nil && op.Content == nil {
+				return nil, nil, nil, &OpError{Index: i, Reason: "没有需要更新的字段"}
+			}
+			if op.Title != nil && *op.Title == "" {
+				return nil, nil, nil, &OpError{Index: i, Reason: "的 title 不能为空"}
+			}
+			mut.Hub, mut.Title, mut.Content = op.Hub, op.Title, op.Content
+		case OpLink, OpUnlink:
+			if mut.From, err = ref(i, "from", op.From); err != nil {
+				return nil, nil, nil, err
+			}
+			if mut.To, err = ref(i, "to", op.To); err != nil {
+				return nil, nil, nil, err
+			}
+		case OpCollectionPush, OpCollectionPop:
+			colID, err := primitive.ObjectIDFromHex(op.CollectionID)
+			if err != nil {
+				return nil, nil, nil, &OpError{Index: i, Reason: "的 collection_id 不合法"}
+			}
+			mut.CollectionID = colID
+			if _, ok := seenCollections[colID]; !ok {
+				seenCollections[colID] = struct{}{}
+				existingCollections = append(existingCollections, colID)
+			}
+			if mut.ItemID, err = ref(i, "item_id", op.ItemID); err != nil {
+				return nil, nil, nil, err
+			}
+		default:
+			return nil, nil, nil, &OpError{Index: i, Reason: fmt.Sprintf("的类型 %q 不支持", op.Type)}
+		}
+		muts = append(muts, mut)
+	}
+	return muts, existingAsteroids, existingCollections, nil
+}
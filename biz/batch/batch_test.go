@@ -0,0 +1,69 @@
+package batch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlan(t *testing.T) {
+	hub, title := true, "new hub"
+	existing := primitive.NewObjectID()
+	colID := primitive.NewObjectID()
+
+	muts, astIDs, colIDs, err := plan([]*Op{
+		{Type: OpCreate, TempID: "$hub", Hub: &hub, Title: &title},
+		{Type: OpLink, From: "$hub", To: existing.Hex()},
+		{Type: OpUpdate, ID: "$hub", Title: &title},
+		{Type: OpCollectionPush, CollectionID: colID.Hex(), ItemID: "$hub"},
+		{Type: OpUnlink, From: existing.Hex(), To: "$hub"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, muts, 5) {
+		created := muts[0].AsteroidID
+		assert.False(t, created.IsZero())
+		assert.Equal(t, created, muts[1].From)
+		assert.Equal(t, existing, muts[1].To)
+		assert.Equal(t, created, muts[2].AsteroidID)
+		assert.Equal(t, colID, muts[3].CollectionID)
+		assert.Equal(t, created, muts[3].ItemID)
+		assert.Equal(t, existing, muts[4].From)
+	}
+	assert.Equal(t, []primitive.ObjectID{existing}, astIDs)
+	assert.Equal(t, []primitive.ObjectID{colID}, colIDs)
+}
+
+func TestPlanRejects(t *testing.T) {
+	hub, title := false, "note"
+	cases := []struct {
+		name  string
+		ops   []*Op
+		index int
+	}{
+		{"undefined temp id", []*Op{
+			{Type: OpLink, From: "$later", To: primitive.NewObjectID().Hex()},
+			{Type: OpCreate, TempID: "$later", Hub: &hub, Title: &title},
+		}, 0},
+		{"duplicated temp id", []*Op{
+			{Type: OpCreate, TempID: "$a", Hub: &hub, Title: &title},
+			{Type: OpCreate, TempID: "$a", Hub: &hub, Title: &title},
+		}, 1},
+		{"create without title", []*Op{
+			{Type: OpCreate, Hub: &hub},
+		}, 0},
+		{"empty update", []*Op{
+			{Type: OpUpdate, ID: primitive.NewObjectID().Hex()},
+		}, 0},
+		{"unknown type", []*Op{
+			{Type: "delete", ID: primitive.NewObjectID().Hex()},
+		}, 0},
+	}
+	for _, c := range cases {
+		_, _, _, err := plan(c.ops)
+		var opErr *OpError
+		if assert.ErrorAs(t, err, &opErr, c.name) {
+			assert.Equal(t, c.index, opErr.Index, c.name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package batch
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/collection"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type Service struct {
+	logger         *zap.Logger
+	repo           Repo
+	asteroidRepo   asteroid.Repo
+	collectionRepo collection.Repo
+}
+
+type Repo interface {
+	// Apply applies all the mutations in order, atomically. When a store fails
+	// to commit after another one did, the batch is undone in the latter and
+	// ErrRolledBack is returned, or ErrDiverged if that failed too.
+	Apply(ctx context.Context, muts []*Mutation) error
+}
+
+var (
+	ErrRolledBack = errors.New("batch was undone after a store failed to commit")
+	ErrDiverged   = errors.New("batch was committed to some of the stores only")
+)
+
+func NewService(logger *zap.Logger, repo Repo, asteroidRepo asteroid.Repo, collectionRepo collection.Repo) *Service {
+	return &Service{
+		logger:         logger,
+		repo:           repo,
+		asteroidRepo:   asteroidRepo,
+		collectionRepo: collectionRepo,
+	}
+}
+
+// Apply validates the whole batch up front, then applies it atomically. Either
+// every operation takes effect, or none does.
+func (s *Service) Apply(ctx context.Context, ops []*Op) ([]*Result, error) {
+	accID := auth.FromContext(ctx).ID
+
+	if len(ops) == 0 {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("批量操作不能为空").WrapSelf()
+	}
+	if len(ops) > MaxOps {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("批量操作数量超出上限").WrapSelf()
+	}
+
+	muts, astIDs, colIDs, err := plan(ops)
+	if err != nil {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg(err.Error()).WrapSelf()
+	}
+	if err := s.checkIfAsteroidsBelongToUser(ctx, accID, astIDs); err != nil {
+		return nil, err
+	}
+	if err := s.checkIfCollectionsBelongToUser(ctx, accID, colIDs); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, mut := range muts {
+		mut.UpdatedTime = now
+		if mut.Type != OpCreate {
+			continue
+		}
+		mut.Asteroid = &asteroid.Asteroid{
+			ID:          mut.AsteroidID,
+			State:       true,
+			CreatedTime: now,
+			UpdatedTime: now,
+			AuthorID:    accID,
+			Hub:         *mut.Hub,
+			Title:       *mut.Title,
+		}
+		if mut.Content != nil {
+			mut.Asteroid.Content = *mut.Content
+		}
+	}
+
+	if err := s.repo.Apply(ctx, muts); err != nil {
+		switch {
+		case errors.Is(err, ErrRolledBack):
+			s.logger.Sugar().Warnf("Batch rolled back, error:\n%+v", err)
+			return nil, bizerr.New().StatusCode(http.StatusServiceUnavailable).Msg("批量操作提交失败，已全部撤销，请重试").WrapSelf()
+		case errors.Is(err, ErrDiverged):
+			s.logger.Sugar().Errorf("Batch partly committed, error:\n%+v", err)
+			return nil, bizerr.New().StatusCode(http.StatusInternalServerError).Msg("批量操作只提交了一部分，请联系管理员").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	results := make([]*Result, 0, len(muts))
+	for i, mut := range muts {
+		result := &Result{Index: i, Type: mut.Type, TempID: ops[i].TempID}
+		switch mut.Type {
+		case OpCreate, OpUpdate:
+			result.ID = mut.AsteroidID
+		case OpLink, OpUnlink:
+			result.ID = mut.From
+		case OpCollectionPush, OpCollectionPop:
+			result.ID = mut.CollectionID
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *Service) checkIfAsteroidsBelongToUser(ctx context.Context, accID primitive.ObjectID, astIDs []primitive.ObjectID) error {
+	if len(astIDs) == 0 {
+		return nil
+	}
+	asts, err := s.asteroidRepo.List(ctx, astIDs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	living := 0
+	for _, ast := range asts {
+		if !ast.State {
+			continue
+		}
+		if ast.AuthorID != accID {
+			return bizerr.New().StatusCode(http.StatusForbidden).Msg("你没有权限修改不属于你的节点").WrapSelf()
+		}
+		living++
+	}
+	if living != len(astIDs) {
+		return bizerr.New().StatusCode(http.StatusNotFound).Msg("你要修改的某些节点不存在").WrapSelf()
+	}
+	return nil
+}
+
+func (s *Service) checkIfCollectionsBelongToUser(ctx context.Context, accID primitive.ObjectID, colIDs []primitive.ObjectID) error {
+	for _, colID := range colIDs {
+		col, err := s.collectionRepo.Get(ctx, colID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return bizerr.New().StatusCode(http.StatusNotFound).Msg("收藏夹不存在").WrapSelf()
+			}
+			return errors.WithStack(err)
+		}
+		if !col.State {
+			return bizerr.New().StatusCode(http.StatusNotFound).Msg("收藏夹不存在").WrapSelf()
+		}
+		if col.OwnerID != accID {
+			return bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权访问不属于你的收藏夹").WrapSelf()
+		}
+	}
+	return nil
+}
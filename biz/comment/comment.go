@@ -0,0 +1,53 @@
+package comment
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Comment struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	State       bool               `bson:"state"`
+	CreatedTime time.Time          `bson:"created_time"`
+	UpdatedTime time.Time          `bson:"updated_time"`
+
+	AsteroidID primitive.ObjectID `bson:"asteroid_id"`
+	AuthorID   primitive.ObjectID `bson:"author_id"`
+	// ParentID is nil for the comment that starts a thread.
+	ParentID *primitive.ObjectID `bson:"parent_id"`
+
+	Content string  `bson:"content"`
+	Anchor  *Anchor `bson:"anchor,omitempty"`
+
+	Resolved     bool                `bson:"resolved"`
+	ResolverID   *primitive.ObjectID `bson:"resolver_id,omitempty"`
+	ResolvedTime *time.Time          `bson:"resolved_time,omitempty"`
+
+	// ReplyCount is filled when listing threads, it is not persisted.
+	ReplyCount int64 `bson:"-"`
+}
+
+// Anchor pins a thread to a range of the asteroid content. Start and End are
+// rune offsets, Quote keeps the anchored text as it was when commenting so a
+// client can relocate the range after the content changes.
+type Anchor struct {
+	Start int    `bson:"start"`
+	End   int    `bson:"end"`
+	Quote string `bson:"quote"`
+}
+
+func (x *Comment) IsThread() bool {
+	return x.ParentID == nil
+}
+
+type ListOptions struct {
+	Page int
+	Size int
+	// Resolved filters threads by their resolved state, nil lists all of them.
+	Resolved *bool
+}
+
+func (x *ListOptions) Skip() int64 {
+	return int64((x.Page - 1) * x.Size)
+}
@@ -0,0 +1,232 @@
+package comment
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	_DefaultPageSize = 20
+	_MaxPageSize     = 100
+)
+
+type Service struct {
+	logger       *zap.Logger
+	repo         Repo
+	asteroidRepo asteroid.Repo
+}
+
+type Repo interface {
+	Create(ctx context.Context, cmt *Comment) error
+	UpdateContent(ctx context.Context, cmt *Comment) error
+	UpdateResolved(ctx context.Context, cmt *Comment) error
+	// Delete removes the comment, and all its replies if it starts a thread.
+	Delete(ctx context.Context, cmtID primitive.ObjectID) error
+	Get(ctx context.Context, cmtID primitive.ObjectID) (*Comment, error)
+	ListThreads(ctx context.Context, astID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error)
+	ListReplies(ctx context.Context, threadID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error)
+	CountReplies(ctx context.Context, threadIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error)
+}
+
+func NewService(logger *zap.Logger, repo Repo, asteroidRepo asteroid.Repo) *Service {
+	return &Service{
+		logger:       logger,
+		repo:         repo,
+		asteroidRepo: asteroidRepo,
+	}
+}
+
+// Create posts a comment. A comment with a ParentID is a reply to that thread,
+// otherwise it starts a new thread which may carry an anchor.
+func (s *Service) Create(ctx context.Context, cmt *Comment) (*Comment, error) {
+	accID := auth.FromContext(ctx).ID
+
+	if cmt.ParentID != nil {
+		thread, err := s.get(ctx, *cmt.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if !thread.IsThread() {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不能回复一条回复").WrapSelf()
+		}
+		if cmt.Anchor != nil {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("回复不能锚定到内容").WrapSelf()
+		}
+		cmt.AsteroidID = thread.AsteroidID
+	}
+
+	ast, err := s.getViewableAsteroid(ctx, accID, cmt.AsteroidID)
+	if err != nil {
+		return nil, err
+	}
+	if cmt.Anchor != nil {
+		content := []rune(ast.Content)
+		if cmt.Anchor.Start < 0 || cmt.Anchor.Start >= cmt.Anchor.End || cmt.Anchor.End > len(content) {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("评论锚定的范围不合法").WrapSelf()
+		}
+		cmt.Anchor.Quote = string(content[cmt.Anchor.Start:cmt.Anchor.End])
+	}
+
+	cmt.ID = primitive.NewObjectID()
+	cmt.State = true
+	cmt.AuthorID = accID
+	cmt.CreatedTime = time.Now()
+	cmt.UpdatedTime = time.Now()
+	if err := s.repo.Create(ctx, cmt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cmt, nil
+}
+
+func (s *Service) Edit(ctx context.Context, cmtID primitive.ObjectID, content string) (*Comment, error) {
+	cmt, err := s.getOwnedComment(ctx, auth.FromContext(ctx).ID, cmtID)
+	if err != nil {
+		return nil, err
+	}
+	cmt.Content = content
+	cmt.UpdatedTime = time.Now()
+	if err := s.repo.UpdateContent(ctx, cmt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cmt, nil
+}
+
+func (s *Service) Delete(ctx context.Context, cmtID primitive.ObjectID) error {
+	cmt, err := s.getOwnedComment(ctx, auth.FromContext(ctx).ID, cmtID)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(s.repo.Delete(ctx, cmt.ID))
+}
+
+// Resolve marks a thread as resolved or reopens it. Anyone who can view the
+// asteroid may do so.
+func (s *Service) Resolve(ctx context.Context, cmtID primitive.ObjectID, resolved bool) (*Comment, error) {
+	accID := auth.FromContext(ctx).ID
+	cmt, err := s.get(ctx, cmtID)
+	if err != nil {
+		return nil, err
+	}
+	if !cmt.IsThread() {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("只能解决评论主题").WrapSelf()
+	}
+	if _, err := s.getViewableAsteroid(ctx, accID, cmt.AsteroidID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cmt.Resolved = resolved
+	cmt.UpdatedTime = now
+	if resolved {
+		cmt.ResolverID = &accID
+		cmt.ResolvedTime = &now
+	} else {
+		cmt.ResolverID = nil
+		cmt.ResolvedTime = nil
+	}
+	if err := s.repo.UpdateResolved(ctx, cmt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cmt, nil
+}
+
+func (s *Service) ListThreads(ctx context.Context, astID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error) {
+	if _, err := s.getViewableAsteroid(ctx, auth.FromContext(ctx).ID, astID); err != nil {
+		return nil, 0, err
+	}
+	normalizeListOptions(opts)
+	threads, total, err := s.repo.ListThreads(ctx, astID, opts)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	if len(threads) == 0 {
+		return threads, total, nil
+	}
+
+	threadIDs := make([]primitive.ObjectID, 0, len(threads))
+	for _, thread := range threads {
+		threadIDs = append(threadIDs, thread.ID)
+	}
+	counts, err := s.repo.CountReplies(ctx, threadIDs)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	for _, thread := range threads {
+		thread.ReplyCount = counts[thread.ID]
+	}
+	return threads, total, nil
+}
+
+func (s *Service) ListReplies(ctx context.Context, threadID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error) {
+	thread, err := s.get(ctx, threadID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := s.getViewableAsteroid(ctx, auth.FromContext(ctx).ID, thread.AsteroidID); err != nil {
+		return nil, 0, err
+	}
+	normalizeListOptions(opts)
+	opts.Resolved = nil
+	replies, total, err := s.repo.ListReplies(ctx, thread.ID, opts)
+	return replies, total, errors.WithStack(err)
+}
+
+func normalizeListOptions(opts *ListOptions) {
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+	if opts.Size <= 0 {
+		opts.Size = _DefaultPageSize
+	}
+	if opts.Size > _MaxPageSize {
+		opts.Size = _MaxPageSize
+	}
+}
+
+func (s *Service) get(ctx context.Context, cmtID primitive.ObjectID) (*Comment, error) {
+	cmt, err := s.repo.Get(ctx, cmtID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("评论不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	return cmt, nil
+}
+
+func (s *Service) getOwnedComment(ctx context.Context, accID, cmtID primitive.ObjectID) (*Comment, error) {
+	cmt, err := s.get(ctx, cmtID)
+	if err != nil {
+		return nil, err
+	}
+	if cmt.AuthorID != accID {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你只能修改自己的评论").WrapSelf()
+	}
+	if _, err := s.getViewableAsteroid(ctx, accID, cmt.AsteroidID); err != nil {
+		return nil, err
+	}
+	return cmt, nil
+}
+
+func (s *Service) getViewableAsteroid(ctx context.Context, accID, astID primitive.ObjectID) (*asteroid.Asteroid, error) {
+	ast, err := s.asteroidRepo.Get(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要评论的节点不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if !asteroid.CanView(accID, ast) {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+	}
+	return ast, nil
+}
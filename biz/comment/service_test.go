@@ -0,0 +1,241 @@
+package comment
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// memRepo keeps the comments in memory.
+type memRepo struct {
+	comments map[primitive.ObjectID]*Comment
+}
+
+func (r *memRepo) Create(ctx context.Context, cmt *Comment) error {
+	c := *cmt
+	r.comments[cmt.ID] = &c
+	return nil
+}
+
+func (r *memRepo) UpdateContent(ctx context.Context, cmt *Comment) error {
+	r.comments[cmt.ID].Content = cmt.Content
+	return nil
+}
+
+func (r *memRepo) UpdateResolved(ctx context.Context, cmt *Comment) error {
+	c := *cmt
+	r.comments[cmt.ID] = &c
+	return nil
+}
+
+func (r *memRepo) Delete(ctx context.Context, cmtID primitive.ObjectID) error {
+	for id, cmt := range r.comments {
+		if id == cmtID || cmt.ParentID != nil && *cmt.ParentID == cmtID {
+			delete(r.comments, id)
+		}
+	}
+	return nil
+}
+
+func (r *memRepo) Get(ctx context.Context, cmtID primitive.ObjectID) (*Comment, error) {
+	cmt, ok := r.comments[cmtID]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	c := *cmt
+	return &c, nil
+}
+
+func (r *memRepo) ListThreads(ctx context.Context, astID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error) {
+	return nil, 0, nil
+}
+
+func (r *memRepo) ListReplies(ctx context.Context, threadID primitive.ObjectID, opts *ListOptions) ([]*Comment, int64, error) {
+	return nil, 0, nil
+}
+
+func (r *memRepo) CountReplies(ctx context.Context, threadIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	return map[primitive.ObjectID]int64{}, nil
+}
+
+// memAsteroidRepo only serves Get, from memory.
+type memAsteroidRepo struct {
+	asteroid.Repo
+	asteroids map[primitive.ObjectID]*asteroid.Asteroid
+}
+
+func (r *memAsteroidRepo) Get(ctx context.Context, id primitive.ObjectID) (*asteroid.Asteroid, error) {
+	ast, ok := r.asteroids[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return ast, nil
+}
+
+// fixture is an asteroid of owner, with a thread and a reply of owner on it,
+// and an asteroid of stranger.
+type fixture struct {
+	service         *Service
+	repo            *memRepo
+	owner, stranger primitive.ObjectID
+	ast, strangers  primitive.ObjectID
+	thread, reply   primitive.ObjectID
+}
+
+func newFixture() *fixture {
+	f := &fixture{
+		owner:     primitive.NewObjectID(),
+		stranger:  primitive.NewObjectID(),
+		ast:       primitive.NewObjectID(),
+		strangers: primitive.NewObjectID(),
+		thread:    primitive.NewObjectID(),
+		reply:     primitive.NewObjectID(),
+	}
+	f.repo = &memRepo{comments: map[primitive.ObjectID]*Comment{
+		f.thread: {ID: f.thread, State: true, AsteroidID: f.ast, AuthorID: f.owner, Content: "thread"},
+		f.reply:  {ID: f.reply, State: true, AsteroidID: f.ast, AuthorID: f.owner, ParentID: &f.thread, Content: "reply"},
+	}}
+	asteroids := &memAsteroidRepo{asteroids: map[primitive.ObjectID]*asteroid.Asteroid{
+		f.ast:       {ID: f.ast, State: true, AuthorID: f.owner, Content: "héllo world"},
+		f.strangers: {ID: f.strangers, State: true, AuthorID: f.stranger, Content: "not yours"},
+	}}
+	f.service = NewService(zap.NewNop(), f.repo, asteroids)
+	return f
+}
+
+func as(accID primitive.ObjectID) context.Context {
+	return auth.NewContext(context.Background(), auth.Info{ID: accID})
+}
+
+// statusOf is the status code of the business error, 0 without an error.
+func statusOf(t *testing.T, err error) int {
+	if err == nil {
+		return 0
+	}
+	e, ok := bizerr.As(err)
+	require.True(t, ok, "%+v", err)
+	return e.GetStatusCode()
+}
+
+func TestCreate(t *testing.T) {
+	f := newFixture()
+	missing := primitive.NewObjectID()
+	tests := []struct {
+		name     string
+		cmt      *Comment
+		status   int
+		quote    string
+		asteroid primitive.ObjectID
+	}{
+		{"thread", &Comment{AsteroidID: f.ast}, 0, "", f.ast},
+		{"thread on another's asteroid", &Comment{AsteroidID: f.strangers}, http.StatusForbidden, "", f.ast},
+		{"thread on a missing asteroid", &Comment{AsteroidID: missing}, http.StatusNotFound, "", f.ast},
+		// offsets count runes, not bytes.
+		{"anchor", &Comment{AsteroidID: f.ast, Anchor: &Anchor{Start: 1, End: 5}}, 0, "éllo", f.ast},
+		{"anchor to the end", &Comment{AsteroidID: f.ast, Anchor: &Anchor{Start: 6, End: 11}}, 0, "world", f.ast},
+		{"anchor past the end", &Comment{AsteroidID: f.ast, Anchor: &Anchor{Start: 6, End: 12}}, http.StatusBadRequest, "", f.ast},
+		{"empty anchor", &Comment{AsteroidID: f.ast, Anchor: &Anchor{Start: 3, End: 3}}, http.StatusBadRequest, "", f.ast},
+		{"negative anchor", &Comment{AsteroidID: f.ast, Anchor: &Anchor{Start: -1, End: 3}}, http.StatusBadRequest, "", f.ast},
+		// a reply takes the asteroid of its thread.
+		{"reply", &Comment{AsteroidID: missing, ParentID: &f.thread}, 0, "", f.ast},
+		{"reply to a reply", &Comment{ParentID: &f.reply}, http.StatusBadRequest, "", f.ast},
+		{"anchored reply", &Comment{ParentID: &f.thread, Anchor: &Anchor{Start: 1, End: 5}}, http.StatusBadRequest, "", f.ast},
+		{"reply to a missing thread", &Comment{ParentID: &missing}, http.StatusNotFound, "", f.ast},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmt, err := f.service.Create(as(f.owner), tt.cmt)
+			require.Equal(t, tt.status, statusOf(t, err))
+			if err != nil {
+				return
+			}
+			stored, err := f.repo.Get(context.Background(), cmt.ID)
+			require.NoError(t, err)
+			assert.Equal(t, f.owner, stored.AuthorID)
+			assert.Equal(t, tt.asteroid, stored.AsteroidID)
+			if tt.quote != "" {
+				assert.Equal(t, tt.quote, stored.Anchor.Quote)
+			}
+		})
+	}
+}
+
+func TestEditAndDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  func(f *fixture) primitive.ObjectID
+		cmt    func(f *fixture) primitive.ObjectID
+		status int
+	}{
+		{"author", func(f *fixture) primitive.ObjectID { return f.owner }, func(f *fixture) primitive.ObjectID { return f.reply }, 0},
+		{"someone else", func(f *fixture) primitive.ObjectID { return f.stranger }, func(f *fixture) primitive.ObjectID { return f.reply }, http.StatusForbidden},
+		{"missing comment", func(f *fixture) primitive.ObjectID { return f.owner }, func(f *fixture) primitive.ObjectID { return primitive.NewObjectID() }, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			cmtID := tt.cmt(f)
+			_, err := f.service.Edit(as(tt.actor(f)), cmtID, "edited")
+			require.Equal(t, tt.status, statusOf(t, err))
+			if err == nil {
+				assert.Equal(t, "edited", f.repo.comments[cmtID].Content)
+			}
+
+			err = f.service.Delete(as(tt.actor(f)), cmtID)
+			require.Equal(t, tt.status, statusOf(t, err))
+			if err == nil {
+				assert.NotContains(t, f.repo.comments, cmtID)
+			}
+		})
+	}
+
+	// deleting a thread takes its replies along.
+	f := newFixture()
+	require.NoError(t, f.service.Delete(as(f.owner), f.thread))
+	assert.Empty(t, f.repo.comments)
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  func(f *fixture) primitive.ObjectID
+		cmt    func(f *fixture) primitive.ObjectID
+		status int
+	}{
+		{"thread", func(f *fixture) primitive.ObjectID { return f.owner }, func(f *fixture) primitive.ObjectID { return f.thread }, 0},
+		{"reply", func(f *fixture) primitive.ObjectID { return f.owner }, func(f *fixture) primitive.ObjectID { return f.reply }, http.StatusBadRequest},
+		{"without access to the asteroid", func(f *fixture) primitive.ObjectID { return f.stranger }, func(f *fixture) primitive.ObjectID { return f.thread }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			actor, cmtID := tt.actor(f), tt.cmt(f)
+			_, err := f.service.Resolve(as(actor), cmtID, true)
+			require.Equal(t, tt.status, statusOf(t, err))
+			if err != nil {
+				assert.False(t, f.repo.comments[cmtID].Resolved)
+				return
+			}
+			resolved := f.repo.comments[cmtID]
+			assert.True(t, resolved.Resolved)
+			assert.Equal(t, &actor, resolved.ResolverID)
+			assert.NotNil(t, resolved.ResolvedTime)
+
+			_, err = f.service.Resolve(as(actor), cmtID, false)
+			require.NoError(t, err)
+			reopened := f.repo.comments[cmtID]
+			assert.False(t, reopened.Resolved)
+			assert.Nil(t, reopened.ResolverID)
+			assert.Nil(t, reopened.ResolvedTime)
+		})
+	}
+}
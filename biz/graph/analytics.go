@@ -0,0 +1,244 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// Centrality scores of a node in the graph of its account.
+type Centrality struct {
+	PageRank  float64
+	InDegree  int
+	OutDegree int
+	// Betweenness is normalized by the number of ordered pairs of other nodes.
+	Betweenness float64
+}
+
+// Metric is a centrality score nodes can be ranked by.
+type Metric string
+
+const (
+	MetricPageRank    Metric = "pagerank"
+	MetricInDegree    Metric = "in_degree"
+	MetricOutDegree   Metric = "out_degree"
+	MetricBetweenness Metric = "betweenness"
+)
+
+var Metrics = []Metric{MetricPageRank, MetricInDegree, MetricOutDegree, MetricBetweenness}
+
+func (x Metric) Valid() bool {
+	for _, metric := range Metrics {
+		if x == metric {
+			return true
+		}
+	}
+	return false
+}
+
+func (x Metric) Score(c *Centrality) float64 {
+	switch x {
+	case MetricInDegree:
+		return float64(c.InDegree)
+	case MetricOutDegree:
+		return float64(c.OutDegree)
+	case MetricBetweenness:
+		return c.Betweenness
+	default:
+		return c.PageRank
+	}
+}
+
+const (
+	_PageRankDamping    = 0.85
+	_PageRankTolerance  = 1e-9
+	_PageRankIterations = 100
+)
+
+// indexedGraph is the adjacency of a graph with its nodes numbered in ID
+// order, so that the algorithms don't depend on the order the store returned.
+type indexedGraph struct {
+	ids []string
+	out [][]int
+	in  [][]int
+}
+
+func indexGraph(g *Graph) *indexedGraph {
+	ids := make([]string, 0, len(g.Nodes))
+	index := make(map[string]int, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if _, ok := index[node.ID]; ok {
+			continue
+		}
+		index[node.ID] = -1
+		ids = append(ids, node.ID)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	ig := &indexedGraph{
+		ids: ids,
+		out: make([][]int, len(ids)),
+		in:  make([][]int, len(ids)),
+	}
+	seen := make(map[[2]int]struct{}, len(g.Links))
+	for _, link := range g.Links {
+		source, ok := index[link.Source]
+		if !ok {
+			continue
+		}
+		target, ok := index[link.Target]
+		if !ok || source == target {
+			continue
+		}
+		key := [2]int{source, target}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		ig.out[source] = append(ig.out[source], target)
+		ig.in[target] = append(ig.in[target], source)
+	}
+	for i := range ids {
+		sort.Ints(ig.out[i])
+		sort.Ints(ig.in[i])
+	}
+	return ig
+}
+
+// Fingerprint identifies the shape of the graph, two graphs with the same
+// nodes and links have the same fingerprint whatever their order.
+func Fingerprint(g *Graph) string {
+	ig := indexGraph(g)
+	h := sha256.New()
+	for i, id := range ig.ids {
+		h.Write([]byte(id))
+		for _, target := range ig.out[i] {
+			h.Write([]byte{'>'})
+			h.Write([]byte(ig.ids[target]))
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ComputeCentrality computes the centrality scores of every node of g. Links
+// to nodes missing from g, self links and duplicated links are ignored.
+func ComputeCentrality(g *Graph) map[string]*Centrality {
+	ig := indexGraph(g)
+	pageRank := ig.pageRank()
+	betweenness := ig.betweenness()
+
+	scores := make(map[string]*Centrality, len(ig.ids))
+	for i, id := range ig.ids {
+		scores[id] = &Centrality{
+			PageRank:    pageRank[i],
+			InDegree:    len(ig.in[i]),
+			OutDegree:   len(ig.out[i]),
+			Betweenness: betweenness[i],
+		}
+	}
+	return scores
+}
+
+// pageRank runs the power iteration, the rank of dangling nodes is spread
+// evenly over all the nodes.
+func (ig *indexedGraph) pageRank() []float64 {
+	n := len(ig.ids)
+	rank := make([]float64, n)
+	if n == 0 {
+		return rank
+	}
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < _PageRankIterations; iter++ {
+		dangling := 0.0
+		for i := range rank {
+			if len(ig.out[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-_PageRankDamping)/float64(n) + _PageRankDamping*dangling/float64(n)
+		for i := range next {
+			sum := 0.0
+			for _, source := range ig.in[i] {
+				sum += rank[source] / float64(len(ig.out[source]))
+			}
+			next[i] = base + _PageRankDamping*sum
+		}
+		diff := 0.0
+		for i := range rank {
+			if d := next[i] - rank[i]; d > 0 {
+				diff += d
+			} else {
+				diff -= d
+			}
+		}
+		rank, next = next, rank
+		if diff < _PageRankTolerance {
+			break
+		}
+	}
+	return rank
+}
+
+// betweenness is Brandes' algorithm for unweighted directed graphs.
+func (ig *indexedGraph) betweenness() []float64 {
+	n := len(ig.ids)
+	scores := make([]float64, n)
+
+	stack := make([]int, 0, n)
+	queue := make([]int, 0, n)
+	preds := make([][]int, n)
+	sigma := make([]float64, n)
+	dist := make([]int, n)
+	delta := make([]float64, n)
+	for s := 0; s < n; s++ {
+		stack = stack[:0]
+		queue = queue[:0]
+		for i := 0; i < n; i++ {
+			preds[i] = preds[i][:0]
+			sigma[i] = 0
+			dist[i] = -1
+			delta[i] = 0
+		}
+		sigma[s] = 1
+		dist[s] = 0
+		queue = append(queue, s)
+		for len(queue) != 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range ig.out[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				scores[w] += delta[w]
+			}
+		}
+	}
+	if n > 2 {
+		norm := float64((n - 1) * (n - 2))
+		for i := range scores {
+			scores[i] /= norm
+		}
+	}
+	return scores
+}
@@ -0,0 +1,292 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	_DefaultRankingSize = 20
+	_MaxRankingSize     = 100
+	// _AnalysisCacheSize is how many accounts keep their analysis cached.
+	_AnalysisCacheSize = 256
+	// _LayoutSaveTimeout bounds saving a layout computed in the background.
+	_LayoutSaveTimeout = 10 * time.Second
+)
+
+// Analysis is everything computed on the graph of an account, it stays valid
+// as long as the fingerprint of the graph doesn't change.
+type Analysis struct {
+	Fingerprint string
+	Centrality  map[string]*Centrality
+	Clusters    map[string]int
+	Summaries   []*Cluster
+}
+
+// AnnotateOptions chooses the analysis results filled into graph nodes.
+type AnnotateOptions struct {
+	Centrality bool
+	Cluster    bool
+	Layout     bool
+	// Full tells that the annotated graph is the full current graph of the
+	// account, which is then analyzed as is instead of being loaded again.
+	Full bool
+	// Past tells that the annotated graph is the graph as of a past time. The
+	// analysis describes the current graph only, so none can be chosen then.
+	Past bool
+}
+
+// AnalyticsService runs graph algorithms in process over the graph of the
+// current account, and caches the results of the accounts seen last until
+// their graph changes.
+type AnalyticsService struct {
+	logger *zap.Logger
+	repo   Repo
+
+	mu    sync.Mutex
+	cache *analysisCache
+	// laying are the accounts whose full layout is being computed.
+	laying map[primitive.ObjectID]bool
+}
+
+func NewAnalyticsService(logger *zap.Logger, repo Repo) *AnalyticsService {
+	return &AnalyticsService{
+		logger: logger,
+		repo:   repo,
+		cache:  newAnalysisCache(_AnalysisCacheSize),
+		laying: make(map[primitive.ObjectID]bool),
+	}
+}
+
+// analyze returns the analysis of gph, the full current graph of the current
+// account, reusing the cached one when the graph hasn't changed. gph is loaded
+// first when nil, and returned either way.
+func (s *AnalyticsService) analyze(ctx context.Context, gph *Graph) (*Graph, *Analysis, error) {
+	accID := auth.FromContext(ctx).ID
+	if gph == nil {
+		var err error
+		if gph, err = s.repo.GetFullGraph(ctx, accID, time.Time{}); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+	fingerprint := Fingerprint(gph)
+
+	s.mu.Lock()
+	cached, ok := s.cache.get(accID)
+	s.mu.Unlock()
+	if ok && cached.Fingerprint == fingerprint {
+		return gph, cached, nil
+	}
+
+	analysis := &Analysis{
+		Fingerprint: fingerprint,
+		Centrality:  ComputeCentrality(gph),
+		Clusters:    DetectClusters(gph),
+	}
+	analysis.Summaries = SummarizeClusters(gph, analysis.Clusters, analysis.Centrality)
+	s.mu.Lock()
+	s.cache.put(accID, analysis)
+	s.mu.Unlock()
+	s.logger.Debug("graph analysis computed", zap.String("account_id", accID.Hex()), zap.Int("nodes", len(gph.Nodes)))
+	return gph, analysis, nil
+}
+
+// Rank lists the nodes of the current account with the highest score for the metric.
+func (s *AnalyticsService) Rank(ctx context.Context, metric Metric, size int) ([]Node, error) {
+	if metric == "" {
+		metric = MetricPageRank
+	}
+	if !metric.Valid() {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的排名指标").WrapSelf()
+	}
+	if size <= 0 {
+		size = _DefaultRankingSize
+	}
+	if size > _MaxRankingSize {
+		size = _MaxRankingSize
+	}
+
+	gph, analysis, err := s.analyze(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]Node, 0, len(gph.Nodes))
+	for _, node := range gph.Nodes {
+		node.Centrality = analysis.Centrality[node.ID]
+		nodes = append(nodes, node)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		si, sj := metric.Score(nodes[i].Centrality), metric.Score(nodes[j].Centrality)
+		if si != sj {
+			return si > sj
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	if len(nodes) > size {
+		nodes = nodes[:size]
+	}
+	return nodes, nil
+}
+
+// Clusters lists the clusters of the graph of the current account, largest first.
+func (s *AnalyticsService) Clusters(ctx context.Context) ([]*Cluster, error) {
+	_, analysis, err := s.analyze(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.Summaries, nil
+}
+
+// Annotate fills the analysis results chosen by opts into the nodes of g,
+// which must belong to the current account. Positions are left empty while
+// the first layout of the account is computed.
+func (s *AnalyticsService) Annotate(ctx context.Context, g *Graph, opts *AnnotateOptions) error {
+	if !opts.Centrality && !opts.Cluster && !opts.Layout {
+		return nil
+	}
+	if opts.Past {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("查看过去的图谱时不能计算中心度、聚类或布局").WrapSelf()
+	}
+	var full *Graph
+	if opts.Full {
+		full = g
+	}
+	full, analysis, err := s.analyze(ctx, full)
+	if err != nil {
+		return err
+	}
+	var layout *Layout
+	if opts.Layout {
+		if layout, err = s.layout(ctx, full, analysis.Fingerprint); err != nil {
+			return err
+		}
+	}
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+		if opts.Centrality {
+			node.Centrality = analysis.Centrality[node.ID]
+		}
+		if cluster, ok := analysis.Clusters[node.ID]; ok && opts.Cluster {
+			node.Cluster = &cluster
+		}
+		if layout != nil {
+			node.Position = layout.Positions[node.ID]
+		}
+	}
+	return nil
+}
+
+// layout returns the stored layout of the current account's graph, it is
+// updated incrementally first when the graph changed since it was computed.
+// When the account has no layout yet, it returns nil and lays the whole graph
+// out in the background, which takes too long to hold the request.
+func (s *AnalyticsService) layout(ctx context.Context, g *Graph, fingerprint string) (*Layout, error) {
+	accID := auth.FromContext(ctx).ID
+	stored, err := s.repo.GetLayout(ctx, accID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		s.layOutInBackground(accID, g, fingerprint)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if stored.Fingerprint == fingerprint {
+		return stored, nil
+	}
+
+	layout := &Layout{
+		AccountID:   accID,
+		Fingerprint: fingerprint,
+		Positions:   ComputeLayout(g, stored),
+		Signatures:  LinkSignatures(g),
+		UpdatedTime: time.Now(),
+	}
+	if err := s.repo.SaveLayout(ctx, layout); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return layout, nil
+}
+
+// layOutInBackground computes the first layout of the account's graph g and
+// saves it, unless it is already being computed.
+func (s *AnalyticsService) layOutInBackground(accID primitive.ObjectID, g *Graph, fingerprint string) {
+	s.mu.Lock()
+	if s.laying[accID] {
+		s.mu.Unlock()
+		return
+	}
+	s.laying[accID] = true
+	s.mu.Unlock()
+
+	// the layout only reads the IDs and links, copied as the caller goes on
+	// filling the nodes.
+	snapshot := &Graph{Nodes: make([]Node, 0, len(g.Nodes)), Links: append([]Link(nil), g.Links...)}
+	for _, node := range g.Nodes {
+		snapshot.Nodes = append(snapshot.Nodes, Node{ID: node.ID})
+	}
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.laying, accID)
+			s.mu.Unlock()
+		}()
+		layout := &Layout{
+			AccountID:   accID,
+			Fingerprint: fingerprint,
+			Positions:   ComputeLayout(snapshot, nil),
+			Signatures:  LinkSignatures(snapshot),
+			UpdatedTime: time.Now(),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), _LayoutSaveTimeout)
+		defer cancel()
+		if err := s.repo.SaveLayout(ctx, layout); err != nil {
+			s.logger.Error("failed to save the graph layout", zap.String("account_id", accID.Hex()), zap.Error(err))
+			return
+		}
+		s.logger.Debug("graph layout computed", zap.String("account_id", accID.Hex()), zap.Int("nodes", len(snapshot.Nodes)))
+	}()
+}
+
+// Pin places the asteroid by hand, the layout won't move it anymore.
+func (s *AnalyticsService) Pin(ctx context.Context, astID primitive.ObjectID, x, y float64) error {
+	return s.setPosition(ctx, astID, func(pos *Position) {
+		pos.X, pos.Y, pos.Pinned = x, y, true
+	})
+}
+
+// Unpin lets the layout move the asteroid again, from where it was pinned.
+func (s *AnalyticsService) Unpin(ctx context.Context, astID primitive.ObjectID) error {
+	return s.setPosition(ctx, astID, func(pos *Position) {
+		pos.Pinned = false
+	})
+}
+
+func (s *AnalyticsService) setPosition(ctx context.Context, astID primitive.ObjectID, update func(*Position)) error {
+	full, analysis, err := s.analyze(ctx, nil)
+	if err != nil {
+		return err
+	}
+	layout, err := s.layout(ctx, full, analysis.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if layout == nil {
+		return bizerr.New().StatusCode(http.StatusConflict).Msg("布局还在计算中，请稍后再试").WrapSelf()
+	}
+	pos, ok := layout.Positions[astID.Hex()]
+	if !ok {
+		return bizerr.New().StatusCode(http.StatusNotFound).Msg("你要摆放的节点不存在").WrapSelf()
+	}
+	update(pos)
+	return errors.WithStack(s.repo.SetPosition(ctx, layout.AccountID, astID.Hex(), pos))
+}
@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeCentrality(t *testing.T) {
+	// a -> b -> c, with d referring to b as well.
+	g := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c"), note("d")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: "c"},
+			{Source: "d", Target: "b"},
+			// duplicated, self and dangling links are ignored.
+			{Source: "a", Target: "b"},
+			{Source: "c", Target: "c"},
+			{Source: "c", Target: "x"},
+		},
+	}
+	scores := ComputeCentrality(g)
+
+	assert.Equal(t, 2, scores["b"].InDegree)
+	assert.Equal(t, 1, scores["b"].OutDegree)
+	assert.Equal(t, 0, scores["c"].OutDegree)
+
+	// b lies on the only shortest paths a->c and d->c, out of 3*2 ordered pairs.
+	assert.InDelta(t, 2.0/6.0, scores["b"].Betweenness, 1e-9)
+	assert.Zero(t, scores["a"].Betweenness)
+	assert.Zero(t, scores["c"].Betweenness)
+
+	sum := 0.0
+	for _, c := range scores {
+		sum += c.PageRank
+	}
+	assert.InDelta(t, 1.0, sum, 1e-6)
+	assert.Greater(t, scores["c"].PageRank, scores["b"].PageRank)
+	assert.Greater(t, scores["b"].PageRank, scores["a"].PageRank)
+	assert.InDelta(t, scores["a"].PageRank, scores["d"].PageRank, 1e-9)
+}
+
+func TestComputeCentralityCycle(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: "c"},
+			{Source: "c", Target: "a"},
+		},
+	}
+	scores := ComputeCentrality(g)
+	for _, id := range []string{"a", "b", "c"} {
+		assert.InDelta(t, 1.0/3.0, scores[id].PageRank, 1e-6)
+		assert.InDelta(t, 0.5, scores[id].Betweenness, 1e-9)
+	}
+	assert.Empty(t, ComputeCentrality(&Graph{}))
+}
+
+func TestFingerprint(t *testing.T) {
+	g1 := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c")},
+		Links: []Link{{Source: "a", Target: "b"}, {Source: "b", Target: "c"}},
+	}
+	g2 := &Graph{
+		Nodes: []Node{note("c"), note("a"), hub("b")},
+		Links: []Link{{Source: "b", Target: "c"}, {Source: "a", Target: "b"}},
+	}
+	g3 := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c")},
+		Links: []Link{{Source: "a", Target: "b"}, {Source: "c", Target: "b"}},
+	}
+	assert.Equal(t, Fingerprint(g1), Fingerprint(g2))
+	assert.NotEqual(t, Fingerprint(g1), Fingerprint(g3))
+}
+
+func TestAnnotatePast(t *testing.T) {
+	// the analysis of the current graph isn't pasted onto a past one.
+	s := &AnalyticsService{}
+	for _, opts := range []*AnnotateOptions{
+		{Centrality: true, Past: true},
+		{Cluster: true, Past: true},
+		{Layout: true, Past: true},
+	} {
+		err := s.Annotate(context.Background(), &Graph{Nodes: []Node{note("a")}}, opts)
+		e, ok := bizerr.As(err)
+		require.True(t, ok, "%+v", err)
+		assert.Equal(t, http.StatusBadRequest, e.GetStatusCode())
+	}
+	assert.NoError(t, s.Annotate(context.Background(), &Graph{Nodes: []Node{note("a")}}, &AnnotateOptions{Past: true}))
+}
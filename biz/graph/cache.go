@@ -0,0 +1,52 @@
+package graph
+
+import (
+	"container/list"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// analysisCache keeps the analyses of the accounts seen last, evicting the
+// least recently used one beyond its capacity. It is not safe for concurrent
+// use.
+type analysisCache struct {
+	capacity int
+	order    *list.List
+	entries  map[primitive.ObjectID]*list.Element
+}
+
+type analysisEntry struct {
+	accID    primitive.ObjectID
+	analysis *Analysis
+}
+
+func newAnalysisCache(capacity int) *analysisCache {
+	return &analysisCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[primitive.ObjectID]*list.Element),
+	}
+}
+
+func (c *analysisCache) get(accID primitive.ObjectID) (*Analysis, bool) {
+	elem, ok := c.entries[accID]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*analysisEntry).analysis, true
+}
+
+func (c *analysisCache) put(accID primitive.ObjectID, analysis *Analysis) {
+	if elem, ok := c.entries[accID]; ok {
+		elem.Value.(*analysisEntry).analysis = analysis
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[accID] = c.order.PushFront(&analysisEntry{accID, analysis})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*analysisEntry).accID)
+	}
+}
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAnalysisCache(t *testing.T) {
+	c := newAnalysisCache(2)
+	a, b, d := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	c.put(a, &Analysis{Fingerprint: "a"})
+	c.put(b, &Analysis{Fingerprint: "b"})
+
+	// reading a makes b the least recently used.
+	got, ok := c.get(a)
+	assert.True(t, ok)
+	assert.Equal(t, "a", got.Fingerprint)
+	c.put(d, &Analysis{Fingerprint: "d"})
+	_, ok = c.get(b)
+	assert.False(t, ok)
+
+	c.put(a, &Analysis{Fingerprint: "a2"})
+	got, _ = c.get(a)
+	assert.Equal(t, "a2", got.Fingerprint)
+	_, ok = c.get(d)
+	assert.True(t, ok)
+	assert.Len(t, c.entries, 2)
+}
@@ -0,0 +1,213 @@
+package graph
+
+import "sort"
+
+// Cluster is a community of densely linked nodes.
+type Cluster struct {
+	ID   int
+	Size int
+	// Central is the node of the cluster with the highest PageRank.
+	Central Node
+}
+
+const _ModularityEpsilon = 1e-12
+
+// weightedGraph is an undirected graph whose adjacency weights are symmetric,
+// a self loop holds the weight of the links inside an aggregated community.
+type weightedGraph struct {
+	adj []map[int]float64
+	// degree is the sum of the weights around each node, self loop included.
+	degree []float64
+	total  float64
+}
+
+func newWeightedGraph(n int) *weightedGraph {
+	wg := &weightedGraph{
+		adj:    make([]map[int]float64, n),
+		degree: make([]float64, n),
+	}
+	for i := range wg.adj {
+		wg.adj[i] = make(map[int]float64)
+	}
+	return wg
+}
+
+func (wg *weightedGraph) add(i, j int, w float64) {
+	wg.adj[i][j] += w
+	wg.degree[i] += w
+	wg.total += w
+}
+
+// neighbors returns the neighbors of i in ascending order, to keep the moves deterministic.
+func (wg *weightedGraph) neighbors(i int) []int {
+	res := make([]int, 0, len(wg.adj[i]))
+	for j := range wg.adj[i] {
+		res = append(res, j)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// moveNodes is the local moving phase of Louvain, each node joins the
+// neighboring community with the best modularity gain until none moves.
+// It returns the community of each node, and whether any node moved.
+func (wg *weightedGraph) moveNodes() ([]int, bool) {
+	n := len(wg.adj)
+	community := make([]int, n)
+	tot := make([]float64, n)
+	for i := range community {
+		community[i] = i
+		tot[i] = wg.degree[i]
+	}
+
+	moved := false
+	for {
+		improved := false
+		for i := 0; i < n; i++ {
+			old := community[i]
+			tot[old] -= wg.degree[i]
+
+			links := make(map[int]float64)
+			candidates := []int{old}
+			for _, j := range wg.neighbors(i) {
+				if j == i {
+					continue
+				}
+				c := community[j]
+				if _, ok := links[c]; !ok && c != old {
+					candidates = append(candidates, c)
+				}
+				links[c] += wg.adj[i][j]
+			}
+
+			best := old
+			bestGain := links[old] - tot[old]*wg.degree[i]/wg.total
+			for _, c := range candidates[1:] {
+				gain := links[c] - tot[c]*wg.degree[i]/wg.total
+				if gain > bestGain+_ModularityEpsilon {
+					best, bestGain = c, gain
+				}
+			}
+			community[i] = best
+			tot[best] += wg.degree[i]
+			if best != old {
+				improved = true
+				moved = true
+			}
+		}
+		if !improved {
+			return community, moved
+		}
+	}
+}
+
+// aggregate renumbers the communities from 0 and merges each of them into a
+// single node. It returns the new graph and the new node of each old one.
+func (wg *weightedGraph) aggregate(community []int) (*weightedGraph, []int) {
+	renumber := make(map[int]int)
+	mapping := make([]int, len(community))
+	for i, c := range community {
+		id, ok := renumber[c]
+		if !ok {
+			id = len(renumber)
+			renumber[c] = id
+		}
+		mapping[i] = id
+	}
+	next := newWeightedGraph(len(renumber))
+	for i := range wg.adj {
+		for j, w := range wg.adj[i] {
+			next.add(mapping[i], mapping[j], w)
+		}
+	}
+	return next, mapping
+}
+
+// DetectClusters runs the Louvain method over g with the directions of the
+// links ignored, and returns the cluster ID of each node. Cluster IDs are
+// numbered from 0 by decreasing size.
+func DetectClusters(g *Graph) map[string]int {
+	ig := indexGraph(g)
+	n := len(ig.ids)
+	wg := newWeightedGraph(n)
+	for i := range ig.out {
+		for _, j := range ig.out[i] {
+			wg.add(i, j, 1)
+			wg.add(j, i, 1)
+		}
+	}
+
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+	if wg.total > 0 {
+		for {
+			community, moved := wg.moveNodes()
+			if !moved {
+				break
+			}
+			next, mapping := wg.aggregate(community)
+			// the nodes moved around but ended up in as many communities.
+			if len(next.adj) == len(wg.adj) {
+				break
+			}
+			wg = next
+			for i := range membership {
+				membership[i] = mapping[membership[i]]
+			}
+		}
+	}
+
+	// numbers the clusters by decreasing size, then by their first node ID.
+	members := make(map[int][]int)
+	for i, c := range membership {
+		members[c] = append(members[c], i)
+	}
+	keys := make([]int, 0, len(members))
+	for c := range members {
+		keys = append(keys, c)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		ma, mb := members[keys[a]], members[keys[b]]
+		if len(ma) != len(mb) {
+			return len(ma) > len(mb)
+		}
+		return ma[0] < mb[0]
+	})
+	clusters := make(map[string]int, n)
+	for id, c := range keys {
+		for _, i := range members[c] {
+			clusters[ig.ids[i]] = id
+		}
+	}
+	return clusters
+}
+
+// SummarizeClusters sizes the clusters of g, and finds their most central
+// node by PageRank.
+func SummarizeClusters(g *Graph, clusters map[string]int, centrality map[string]*Centrality) []*Cluster {
+	byID := make(map[int]*Cluster)
+	for _, node := range g.Nodes {
+		id, ok := clusters[node.ID]
+		if !ok {
+			continue
+		}
+		cluster, ok := byID[id]
+		if !ok {
+			cluster = &Cluster{ID: id, Central: node}
+			byID[id] = cluster
+		}
+		cluster.Size++
+		if c, best := centrality[node.ID], centrality[cluster.Central.ID]; c != nil && best != nil &&
+			(c.PageRank > best.PageRank || (c.PageRank == best.PageRank && node.ID < cluster.Central.ID)) {
+			cluster.Central = node
+		}
+	}
+	res := make([]*Cluster, 0, len(byID))
+	for _, cluster := range byID {
+		res = append(res, cluster)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectClusters(t *testing.T) {
+	// two triangles joined by a single link, and a lonely node.
+	g := &Graph{
+		Nodes: []Node{note("a1"), note("a2"), hub("a3"), note("b1"), note("b2"), note("b3"), note("b4"), note("z")},
+		Links: []Link{
+			{Source: "a1", Target: "a2"},
+			{Source: "a2", Target: "a3"},
+			{Source: "a3", Target: "a1"},
+			{Source: "b1", Target: "b2"},
+			{Source: "b2", Target: "b3"},
+			{Source: "b3", Target: "b1"},
+			{Source: "b4", Target: "b1"},
+			{Source: "b4", Target: "b2"},
+			{Source: "a3", Target: "b1"},
+		},
+	}
+	clusters := DetectClusters(g)
+	assert.Len(t, clusters, 8)
+
+	assert.Equal(t, 0, clusters["b1"])
+	for _, id := range []string{"b2", "b3", "b4"} {
+		assert.Equal(t, clusters["b1"], clusters[id])
+	}
+	assert.Equal(t, 1, clusters["a1"])
+	for _, id := range []string{"a2", "a3"} {
+		assert.Equal(t, clusters["a1"], clusters[id])
+	}
+	assert.Equal(t, 2, clusters["z"])
+	assert.Equal(t, clusters, DetectClusters(g))
+
+	summaries := SummarizeClusters(g, clusters, ComputeCentrality(g))
+	if assert.Len(t, summaries, 3) {
+		assert.Equal(t, 0, summaries[0].ID)
+		assert.Equal(t, 4, summaries[0].Size)
+		assert.Equal(t, 3, summaries[1].Size)
+		assert.Equal(t, 1, summaries[2].Size)
+		assert.Equal(t, "z", summaries[2].Central.ID)
+	}
+}
+
+func TestDetectClustersWithoutLinks(t *testing.T) {
+	g := &Graph{Nodes: []Node{note("a"), note("b")}}
+	assert.Equal(t, map[string]int{"a": 0, "b": 1}, DetectClusters(g))
+	assert.Empty(t, DetectClusters(&Graph{}))
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"net/http"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CollectionQuery returns the subgraph induced by the items of a collection,
+// expanded breadth first by Hops hops, until Limit nodes are reached.
+type CollectionQuery struct {
+	CollectionID primitive.ObjectID
+	// Hops is zero for the items and the links among them only.
+	Hops      int
+	Direction Direction
+	// Limit is the maximum number of nodes, the items included.
+	Limit int
+}
+
+// Normalize fills the defaults of the query and validates it.
+func (q *CollectionQuery) Normalize() error {
+	if q.Hops < 0 {
+		q.Hops = 0
+	}
+	if q.Hops > MaxNeighborhoodDepth {
+		q.Hops = MaxNeighborhoodDepth
+	}
+	if q.Direction == "" {
+		q.Direction = DirectionBoth
+	}
+	if !q.Direction.Valid() {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的方向").WrapSelf()
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultNeighborhoodLimit
+	}
+	if q.Limit > MaxNeighborhoodLimit {
+		q.Limit = MaxNeighborhoodLimit
+	}
+	return nil
+}
+
+// MarkCollection marks the nodes at distance zero as the items of the
+// collection, and the others as reached by the expansion.
+func MarkCollection(g *Graph) {
+	for i := range g.Nodes {
+		in := g.Nodes[i].Distance != nil && *g.Nodes[i].Distance == 0
+		g.Nodes[i].InCollection = &in
+	}
+}
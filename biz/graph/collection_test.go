@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionQueryNormalize(t *testing.T) {
+	q := &CollectionQuery{Hops: -1}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, 0, q.Hops)
+		assert.Equal(t, DirectionBoth, q.Direction)
+		assert.Equal(t, DefaultNeighborhoodLimit, q.Limit)
+	}
+
+	q = &CollectionQuery{Hops: 100, Limit: 5000, Direction: DirectionOut}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, MaxNeighborhoodDepth, q.Hops)
+		assert.Equal(t, DirectionOut, q.Direction)
+		assert.Equal(t, MaxNeighborhoodLimit, q.Limit)
+	}
+
+	assert.Error(t, (&CollectionQuery{Direction: "up"}).Normalize())
+}
+
+func TestMarkCollection(t *testing.T) {
+	zero, one := 0, 1
+	g := &Graph{Nodes: []Node{{ID: "a", Distance: &zero}, {ID: "b", Distance: &one}, {ID: "c"}}}
+	MarkCollection(g)
+	assert.True(t, *g.Nodes[0].InCollection)
+	assert.False(t, *g.Nodes[1].InCollection)
+	assert.False(t, *g.Nodes[2].InCollection)
+}
@@ -1,17 +1,66 @@
 package graph
 
+import "time"
+
 type Graph struct {
 	Nodes []Node
 	Links []Link
+	// Truncated is set when nodes were left out to stay within a limit.
+	Truncated bool
 }
 
 type Node struct {
-	ID    string
-	Hub   bool
-	Title string
+	ID          string
+	Hub         bool
+	Title       string
+	CreatedTime time.Time
+	UpdatedTime time.Time
+	// Centrality, Cluster and Position are only filled when asked for.
+	Centrality *Centrality
+	Cluster    *int
+	Position   *Position
+	// Distance is the number of hops from the asteroid a neighborhood is centered
+	// on, or from the nearest item of a collection.
+	Distance *int
+	// InCollection tells the items of a collection from the nodes its graph was expanded to.
+	InCollection *bool
 }
 
 type Link struct {
 	Source string
 	Target string
+	// CreatedTime is zero for links created before it was recorded.
+	CreatedTime time.Time
+}
+
+// HygieneKind is a group of asteroids that are poorly connected to the rest of
+// the graph.
+type HygieneKind string
+
+const (
+	// HygieneOrphan asteroids have no REFER edge at all.
+	HygieneOrphan HygieneKind = "orphan"
+	// HygieneDeadEnd asteroids are referred to, but refer to nothing.
+	HygieneDeadEnd HygieneKind = "dead_end"
+	// HygieneUnreachable notes cannot be reached from any hub.
+	HygieneUnreachable HygieneKind = "unreachable"
+	// HygieneEmptyHub hubs refer to nothing.
+	HygieneEmptyHub HygieneKind = "empty_hub"
+)
+
+var HygieneKinds = []HygieneKind{HygieneOrphan, HygieneDeadEnd, HygieneUnreachable, HygieneEmptyHub}
+
+func (x HygieneKind) Valid() bool {
+	for _, kind := range HygieneKinds {
+		if x == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type HygieneGroup struct {
+	Kind  HygieneKind
+	Total int64
+	Nodes []Node
 }
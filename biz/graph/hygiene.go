@@ -0,0 +1,72 @@
+package graph
+
+import "sort"
+
+// FindHygiene lists the nodes of the graph in the hygiene group, oldest first,
+// for stores that can't express the groups as queries.
+func FindHygiene(g *Graph, kind HygieneKind) []Node {
+	ig := indexGraph(g)
+	index := make(map[string]int, len(ig.ids))
+	for i, id := range ig.ids {
+		index[id] = i
+	}
+	hubs := make(map[int]bool)
+	for _, node := range g.Nodes {
+		if node.Hub {
+			hubs[index[node.ID]] = true
+		}
+	}
+
+	// every node a hub leads to, hubs included.
+	var reachable map[int]bool
+	if kind == HygieneUnreachable {
+		reachable = make(map[int]bool, len(ig.ids))
+		queue := make([]int, 0, len(hubs))
+		for hub := range hubs {
+			reachable[hub] = true
+			queue = append(queue, hub)
+		}
+		for len(queue) != 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range ig.out[cur] {
+				if !reachable[next] {
+					reachable[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	nodes := make([]Node, 0)
+	seen := make(map[string]bool, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if seen[node.ID] {
+			continue
+		}
+		seen[node.ID] = true
+		i := index[node.ID]
+		in, out := len(ig.in[i]), len(ig.out[i])
+		var matched bool
+		switch kind {
+		case HygieneOrphan:
+			matched = in == 0 && out == 0
+		case HygieneDeadEnd:
+			matched = in != 0 && out == 0
+		case HygieneUnreachable:
+			matched = !reachable[i]
+		case HygieneEmptyHub:
+			matched = hubs[i] && out == 0
+		}
+		if matched {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if !nodes[i].CreatedTime.Equal(nodes[j].CreatedTime) {
+			return nodes[i].CreatedTime.Before(nodes[j].CreatedTime)
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes
+}
@@ -0,0 +1,33 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHygiene(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2022, 3, d, 0, 0, 0, 0, time.UTC) }
+	at := func(node Node, d int) Node {
+		node.CreatedTime = day(d)
+		return node
+	}
+	g := &Graph{
+		Nodes: []Node{
+			at(hub("h"), 1), at(hub("empty"), 2), at(note("a"), 3), at(note("b"), 4),
+			at(note("lonely"), 6), at(note("c"), 5), at(note("d"), 5),
+		},
+		Links: []Link{
+			{Source: "h", Target: "a"},
+			{Source: "a", Target: "b"},
+			{Source: "c", Target: "d"},
+			{Source: "c", Target: "gone"},
+		},
+	}
+
+	assert.Equal(t, []string{"empty", "lonely"}, ids(FindHygiene(g, HygieneOrphan)))
+	assert.Equal(t, []string{"b", "d"}, ids(FindHygiene(g, HygieneDeadEnd)))
+	assert.Equal(t, []string{"c", "d", "lonely"}, ids(FindHygiene(g, HygieneUnreachable)))
+	assert.Equal(t, []string{"empty"}, ids(FindHygiene(g, HygieneEmptyHub)))
+}
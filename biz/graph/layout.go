@@ -0,0 +1,234 @@
+package graph
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Position of a node in the layout of its account's graph. Pinned positions
+// were placed by hand and are never moved by the layout.
+type Position struct {
+	X      float64 `bson:"x"`
+	Y      float64 `bson:"y"`
+	Pinned bool    `bson:"pinned"`
+}
+
+// Layout is the persisted layout of an account's graph, computed for the
+// graph with the given fingerprint.
+type Layout struct {
+	AccountID   primitive.ObjectID   `bson:"_id"`
+	Fingerprint string               `bson:"fingerprint"`
+	Positions   map[string]*Position `bson:"positions"`
+	// Signatures are the LinkSignatures of the graph, so that an update can
+	// tell the nodes whose links changed. Layouts saved before have none.
+	Signatures  map[string]string `bson:"signatures"`
+	UpdatedTime time.Time         `bson:"updated_time"`
+}
+
+const (
+	// _LayoutEdgeLength is the ideal distance between two linked nodes.
+	_LayoutEdgeLength = 100.0
+	// a full layout starts hot to untangle the graph, an incremental one only
+	// settles the nodes that changed.
+	_FullLayoutIterations        = 300
+	_IncrementalLayoutIterations = 60
+)
+
+// hashUnit maps the ID and salt to a number in [0, 1), so that positions
+// derived from it are the same on every run.
+func hashUnit(id string, salt byte) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h.Write([]byte{salt})
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+// LinkSignatures hashes the links in and out of every node of g, a node's
+// signature changes whenever one of its links is added or removed.
+func LinkSignatures(g *Graph) map[string]string {
+	ig := indexGraph(g)
+	signatures := make(map[string]string, len(ig.ids))
+	for i, id := range ig.ids {
+		h := fnv.New64a()
+		for _, target := range ig.out[i] {
+			h.Write([]byte{'>'})
+			h.Write([]byte(ig.ids[target]))
+		}
+		for _, source := range ig.in[i] {
+			h.Write([]byte{'<'})
+			h.Write([]byte(ig.ids[source]))
+		}
+		signatures[id] = strconv.FormatUint(h.Sum64(), 36)
+	}
+	return signatures
+}
+
+// ComputeLayout runs a deterministic Fruchterman-Reingold layout over g. Every
+// pair of nodes is compared at each step, so a full layout, without a previous
+// one, is quadratic in the nodes. An update places the new nodes around their
+// positioned neighbors, and only relaxes the nodes that are new or whose links
+// changed since previous, the rest of the nodes keep their previous position.
+// Pinned positions don't move, positions of nodes missing from g are dropped.
+func ComputeLayout(g *Graph, previous *Layout) map[string]*Position {
+	ig := indexGraph(g)
+	n := len(ig.ids)
+	positions := make(map[string]*Position, n)
+	if n == 0 {
+		return positions
+	}
+	var (
+		known      map[string]*Position
+		signatures map[string]string
+	)
+	if previous != nil {
+		known = previous.Positions
+		if previous.Signatures != nil {
+			signatures = LinkSignatures(g)
+		}
+	}
+
+	xs := make([]float64, n)
+	ys := make([]float64, n)
+	pinned := make([]bool, n)
+	placed := make([]bool, n)
+	// an update only moves the new nodes, and the ends of the links added or
+	// removed, found by their signature. Without signatures to compare, the
+	// neighbors of the new nodes stand for the latter.
+	movable := make([]bool, n)
+	incremental := false
+	for i, id := range ig.ids {
+		p, ok := known[id]
+		if !ok {
+			movable[i] = true
+			continue
+		}
+		xs[i], ys[i], pinned[i], placed[i] = p.X, p.Y, p.Pinned, true
+		incremental = true
+		if signatures != nil && signatures[id] != previous.Signatures[id] {
+			movable[i] = true
+		}
+	}
+	for i := range ig.ids {
+		if placed[i] || signatures != nil {
+			continue
+		}
+		for _, neighbors := range [][]int{ig.out[i], ig.in[i]} {
+			for _, j := range neighbors {
+				movable[j] = true
+			}
+		}
+	}
+	moving := make([]int, 0, n)
+	for i := range movable {
+		movable[i] = movable[i] && !pinned[i]
+		if movable[i] {
+			moving = append(moving, i)
+		}
+	}
+
+	// places the new nodes, next to the neighbors already placed when there are.
+	spread := _LayoutEdgeLength * math.Sqrt(float64(n))
+	for i, id := range ig.ids {
+		if placed[i] {
+			continue
+		}
+		angle := 2 * math.Pi * hashUnit(id, 0)
+		cx, cy, count := 0.0, 0.0, 0
+		for _, neighbors := range [][]int{ig.out[i], ig.in[i]} {
+			for _, j := range neighbors {
+				if placed[j] {
+					cx, cy, count = cx+xs[j], cy+ys[j], count+1
+				}
+			}
+		}
+		if count != 0 {
+			xs[i] = cx/float64(count) + _LayoutEdgeLength/2*math.Cos(angle)
+			ys[i] = cy/float64(count) + _LayoutEdgeLength/2*math.Sin(angle)
+		} else {
+			radius := spread / 2 * math.Sqrt(hashUnit(id, 1))
+			xs[i] = radius * math.Cos(angle)
+			ys[i] = radius * math.Sin(angle)
+		}
+		placed[i] = true
+	}
+
+	iterations, temperature := _FullLayoutIterations, spread/4
+	if incremental {
+		iterations, temperature = _IncrementalLayoutIterations, _LayoutEdgeLength/2
+	}
+	k := _LayoutEdgeLength
+	dx := make([]float64, n)
+	dy := make([]float64, n)
+	// push moves i, and j when it can move too, along the force pulling them
+	// together, or pushing them apart when negative.
+	push := func(i, j int, ddx, ddy, dist, force float64) {
+		dx[i] -= ddx / dist * force
+		dy[i] -= ddy / dist * force
+		if movable[j] {
+			dx[j] += ddx / dist * force
+			dy[j] += ddy / dist * force
+		}
+	}
+	attract := func(i, j int) {
+		ddx, ddy := xs[i]-xs[j], ys[i]-ys[j]
+		if dist := math.Hypot(ddx, ddy); dist >= 1e-6 {
+			push(i, j, ddx, ddy, dist, dist*dist/k)
+		}
+	}
+	for iter := 0; iter < iterations; iter++ {
+		for i := range dx {
+			dx[i], dy[i] = 0, 0
+		}
+		// every pair of nodes repels, pairs of frozen nodes don't matter.
+		for _, i := range moving {
+			for j := 0; j < n; j++ {
+				if j == i || movable[j] && j < i {
+					continue
+				}
+				ddx, ddy := xs[i]-xs[j], ys[i]-ys[j]
+				dist := math.Hypot(ddx, ddy)
+				if dist < 1e-6 {
+					// pushes overlapping nodes apart along a fixed direction.
+					ddx, ddy, dist = math.Cos(float64(i+j)), math.Sin(float64(i+j)), 1
+				}
+				push(i, j, ddx, ddy, dist, -k*k/dist)
+			}
+		}
+		// linked nodes attract, whatever the direction of the link. A link
+		// between two moving nodes is taken from its source only.
+		for _, i := range moving {
+			for _, j := range ig.out[i] {
+				attract(i, j)
+			}
+			for _, j := range ig.in[i] {
+				if !movable[j] {
+					attract(i, j)
+				}
+			}
+		}
+		// moves the moving nodes, no further than the temperature.
+		t := temperature * (1 - float64(iter)/float64(iterations))
+		for _, i := range moving {
+			length := math.Hypot(dx[i], dy[i])
+			if length < 1e-9 {
+				continue
+			}
+			step := math.Min(length, t)
+			xs[i] += dx[i] / length * step
+			ys[i] += dy[i] / length * step
+		}
+	}
+
+	for i, id := range ig.ids {
+		positions[id] = &Position{
+			X:      math.Round(xs[i]*100) / 100,
+			Y:      math.Round(ys[i]*100) / 100,
+			Pinned: pinned[i],
+		}
+	}
+	return positions
+}
@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func distance(a, b *Position) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+func TestComputeLayout(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c"), note("d"), note("e")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: "c"},
+			{Source: "c", Target: "a"},
+			{Source: "d", Target: "e"},
+		},
+	}
+	positions := ComputeLayout(g, nil)
+	assert.Len(t, positions, 5)
+	assert.Equal(t, positions, ComputeLayout(g, nil))
+
+	// linked nodes end up closer than unlinked ones.
+	assert.Less(t, distance(positions["a"], positions["b"]), distance(positions["a"], positions["d"]))
+	assert.Less(t, distance(positions["d"], positions["e"]), distance(positions["b"], positions["e"]))
+
+	assert.Empty(t, ComputeLayout(&Graph{}, nil))
+}
+
+func TestComputeLayoutIncremental(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c")},
+		Links: []Link{{Source: "a", Target: "b"}, {Source: "b", Target: "c"}},
+	}
+	previous := &Layout{Positions: ComputeLayout(g, nil), Signatures: LinkSignatures(g)}
+	previous.Positions["a"].Pinned = true
+	previous.Positions["a"].X, previous.Positions["a"].Y = 500, 500
+	previous.Positions["gone"] = &Position{X: 1, Y: 1}
+
+	g.Nodes = append(g.Nodes, note("d"))
+	g.Links = append(g.Links, Link{Source: "d", Target: "c"})
+	positions := ComputeLayout(g, previous)
+
+	assert.Len(t, positions, 4)
+	// only the new node and the other end of its link move.
+	assert.Equal(t, previous.Positions["b"], positions["b"])
+	assert.NotEqual(t, previous.Positions["c"], positions["c"])
+	assert.NotContains(t, positions, "gone")
+	assert.Equal(t, &Position{X: 500, Y: 500, Pinned: true}, positions["a"])
+	// the new node settles next to its neighbor.
+	assert.Less(t, distance(positions["d"], positions["c"]), 2*_LayoutEdgeLength)
+}
+
+func TestComputeLayoutLinkChanged(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{note("a"), note("b"), note("c"), note("d"), note("e")},
+		Links: []Link{{Source: "a", Target: "b"}, {Source: "c", Target: "d"}},
+	}
+	previous := &Layout{Positions: ComputeLayout(g, nil), Signatures: LinkSignatures(g)}
+
+	// links two nodes already placed, e stays out of it.
+	g.Links = append(g.Links, Link{Source: "b", Target: "e"})
+	positions := ComputeLayout(g, previous)
+
+	assert.NotEqual(t, previous.Positions["b"], positions["b"])
+	assert.NotEqual(t, previous.Positions["e"], positions["e"])
+	for _, id := range []string{"a", "c", "d"} {
+		assert.Equal(t, previous.Positions[id], positions[id], id)
+	}
+}
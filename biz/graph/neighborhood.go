@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"net/http"
+	"time"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Direction of the REFER edges followed when expanding a neighborhood.
+type Direction string
+
+const (
+	DirectionOut  Direction = "out"
+	DirectionIn   Direction = "in"
+	DirectionBoth Direction = "both"
+)
+
+func (x Direction) Valid() bool {
+	switch x {
+	case DirectionOut, DirectionIn, DirectionBoth:
+		return true
+	}
+	return false
+}
+
+const (
+	DefaultNeighborhoodDepth = 2
+	MaxNeighborhoodDepth     = 10
+	DefaultNeighborhoodLimit = 200
+	MaxNeighborhoodLimit     = 1000
+)
+
+// NeighborhoodQuery expands the graph breadth first from an asteroid, one hop
+// at a time, until Depth hops or Limit nodes are reached.
+type NeighborhoodQuery struct {
+	AsteroidID primitive.ObjectID
+	Depth      int
+	Direction  Direction
+	// Limit is the maximum number of nodes, the center included.
+	Limit int
+	// AsOf rebuilds the neighborhood as it was at that time, unless zero.
+	AsOf time.Time
+}
+
+// Normalize fills the defaults of the query and validates it.
+func (q *NeighborhoodQuery) Normalize() error {
+	if q.Depth <= 0 {
+		q.Depth = DefaultNeighborhoodDepth
+	}
+	if q.Depth > MaxNeighborhoodDepth {
+		q.Depth = MaxNeighborhoodDepth
+	}
+	if q.Direction == "" {
+		q.Direction = DirectionBoth
+	}
+	if !q.Direction.Valid() {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的方向").WrapSelf()
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultNeighborhoodLimit
+	}
+	if q.Limit > MaxNeighborhoodLimit {
+		q.Limit = MaxNeighborhoodLimit
+	}
+	return nil
+}
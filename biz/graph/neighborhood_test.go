@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeighborhoodQueryNormalize(t *testing.T) {
+	q := &NeighborhoodQuery{}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, DefaultNeighborhoodDepth, q.Depth)
+		assert.Equal(t, DirectionBoth, q.Direction)
+		assert.Equal(t, DefaultNeighborhoodLimit, q.Limit)
+	}
+
+	q = &NeighborhoodQuery{Depth: 20, Direction: DirectionIn, Limit: 5000}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, MaxNeighborhoodDepth, q.Depth)
+		assert.Equal(t, DirectionIn, q.Direction)
+		assert.Equal(t, MaxNeighborhoodLimit, q.Limit)
+	}
+
+	q = &NeighborhoodQuery{Direction: "up"}
+	assert.Error(t, q.Normalize())
+}
@@ -0,0 +1,269 @@
+package graph
+
+import (
+	"net/http"
+	"sort"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RelationType is the type of edges between asteroids in the graph store.
+type RelationType string
+
+const RelationRefer RelationType = "REFER"
+
+var RelationTypes = []RelationType{RelationRefer}
+
+func (x RelationType) Valid() bool {
+	for _, typ := range RelationTypes {
+		if x == typ {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DefaultPathLength = 4
+	MaxPathLength     = 6
+	DefaultPathCount  = 3
+	MaxPathCount      = 20
+)
+
+// PathQuery looks for the paths between two asteroids. A path only goes
+// through asteroids of the same account and never visits one twice.
+type PathQuery struct {
+	From primitive.ObjectID
+	To   primitive.ObjectID
+	// MaxLength is the maximum number of edges on a path.
+	MaxLength int
+	// Directed paths follow the edges from their source to their target.
+	Directed bool
+	// RelationTypes restricts the edges a path goes through, any type if empty.
+	RelationTypes []RelationType
+	// Limit is the number of paths to find, shortest first.
+	Limit int
+}
+
+// Normalize fills the defaults of the query and validates it.
+func (q *PathQuery) Normalize() error {
+	if q.From == q.To {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("起点和终点不能是同一个节点").WrapSelf()
+	}
+	if q.MaxLength <= 0 {
+		q.MaxLength = DefaultPathLength
+	}
+	if q.MaxLength > MaxPathLength {
+		q.MaxLength = MaxPathLength
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPathCount
+	}
+	if q.Limit > MaxPathCount {
+		q.Limit = MaxPathCount
+	}
+	if len(q.RelationTypes) == 0 {
+		q.RelationTypes = RelationTypes
+	}
+	for _, typ := range q.RelationTypes {
+		if !typ.Valid() {
+			return bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的关系类型").WrapSelf()
+		}
+	}
+	return nil
+}
+
+// SearchPaths finds the paths matching the query in the graph with the k
+// shortest paths algorithm of Yen, so the work grows with the number of paths
+// asked for instead of the number of paths there are. Paths of the same length
+// come in the order of the IDs they go through.
+func SearchPaths(g *Graph, q *PathQuery) []*Graph {
+	ig := indexGraph(g)
+	index := make(map[string]int, len(ig.ids))
+	for i, id := range ig.ids {
+		index[id] = i
+	}
+	from, okFrom := index[q.From.Hex()]
+	to, okTo := index[q.To.Hex()]
+	paths := make([]*Graph, 0, q.Limit)
+	if !okFrom || !okTo {
+		return paths
+	}
+
+	next, prev := ig.out, ig.in
+	if !q.Directed {
+		next = make([][]int, len(ig.ids))
+		for i := range ig.ids {
+			next[i] = mergeSorted(ig.out[i], ig.in[i])
+		}
+		prev = next
+	}
+	sp := &shortestPaths{next: next, prev: prev, to: to, dist: make([]int, len(ig.ids))}
+
+	found := make([][]int, 0, q.Limit)
+	if first := sp.find(from, nil, nil); first != nil && len(first)-1 <= q.MaxLength {
+		found = append(found, first)
+	}
+	candidates := make([][]int, 0)
+	for len(found) != 0 && len(found) < q.Limit {
+		last := found[len(found)-1]
+		// every node of the last path but the target spurs off a new path,
+		// sharing its root and leaving it by a link none of the paths found
+		// with that root took.
+		for i := 0; i < len(last)-1; i++ {
+			root := last[:i+1]
+			removedNodes := make(map[int]bool, i)
+			for _, n := range root[:i] {
+				removedNodes[n] = true
+			}
+			removedLinks := make(map[[2]int]bool)
+			for _, p := range found {
+				if len(p) > i+1 && equalInts(p[:i+1], root) {
+					removedLinks[[2]int{p[i], p[i+1]}] = true
+				}
+			}
+			spur := sp.find(last[i], removedNodes, removedLinks)
+			if spur == nil || i+len(spur)-1 > q.MaxLength {
+				continue
+			}
+			candidate := append(append(make([]int, 0, i+len(spur)), root[:i]...), spur...)
+			if !containsPath(candidates, candidate) && !containsPath(found, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		best := 0
+		for j := range candidates {
+			if lessPath(candidates[j], candidates[best]) {
+				best = j
+			}
+		}
+		found = append(found, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+
+	nodes := make(map[string]Node, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes[node.ID] = node
+	}
+	for _, p := range found {
+		paths = append(paths, makePath(ig, nodes, p))
+	}
+	return paths
+}
+
+// shortestPaths finds shortest paths to a fixed target, avoiding some nodes and links.
+type shortestPaths struct {
+	next, prev [][]int
+	to         int
+	dist       []int
+}
+
+// find returns the shortest path from source to the target going through the
+// lowest indexes, nil if there is none.
+func (sp *shortestPaths) find(source int, removedNodes map[int]bool, removedLinks map[[2]int]bool) []int {
+	for i := range sp.dist {
+		sp.dist[i] = -1
+	}
+	sp.dist[sp.to] = 0
+	queue := []int{sp.to}
+	for len(queue) != 0 && sp.dist[source] < 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, p := range sp.prev[cur] {
+			if sp.dist[p] >= 0 || removedNodes[p] || removedLinks[[2]int{p, cur}] {
+				continue
+			}
+			sp.dist[p] = sp.dist[cur] + 1
+			queue = append(queue, p)
+		}
+	}
+	if sp.dist[source] < 0 {
+		return nil
+	}
+	// walks down the distances, taking the lowest index at every step.
+	path := []int{source}
+	for cur := source; cur != sp.to; {
+		for _, n := range sp.next[cur] {
+			if sp.dist[n] == sp.dist[cur]-1 && !removedNodes[n] && !removedLinks[[2]int{cur, n}] {
+				cur = n
+				break
+			}
+		}
+		path = append(path, cur)
+	}
+	return path
+}
+
+// lessPath orders paths by length, then by the indexes they go through.
+func lessPath(a, b []int) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func equalInts(a, b []int) bool {
+	return len(a) == len(b) && !lessPath(a, b) && !lessPath(b, a)
+}
+
+func containsPath(paths [][]int, p []int) bool {
+	for _, q := range paths {
+		if equalInts(q, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// makePath turns the visited indexes into a graph, keeping the direction of
+// the links it goes through.
+func makePath(ig *indexedGraph, nodes map[string]Node, path []int) *Graph {
+	g := &Graph{
+		Nodes: make([]Node, 0, len(path)),
+		Links: make([]Link, 0, len(path)-1),
+	}
+	for i, cur := range path {
+		g.Nodes = append(g.Nodes, nodes[ig.ids[cur]])
+		if i == 0 {
+			continue
+		}
+		prev := path[i-1]
+		source, target := ig.ids[prev], ig.ids[cur]
+		j := sort.SearchInts(ig.out[prev], cur)
+		if j == len(ig.out[prev]) || ig.out[prev][j] != cur {
+			source, target = target, source
+		}
+		g.Links = append(g.Links, Link{Source: source, Target: target})
+	}
+	return g
+}
+
+// mergeSorted merges two sorted slices, dropping duplicates.
+func mergeSorted(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var v int
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			v, i = a[i], i+1
+		case i == len(a) || b[j] < a[i]:
+			v, j = b[j], j+1
+		default:
+			v, i, j = a[i], i+1, j+1
+		}
+		if len(merged) == 0 || merged[len(merged)-1] != v {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPathQueryNormalize(t *testing.T) {
+	from, to := primitive.NewObjectID(), primitive.NewObjectID()
+
+	q := &PathQuery{From: from, To: to}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, DefaultPathLength, q.MaxLength)
+		assert.Equal(t, DefaultPathCount, q.Limit)
+		assert.Equal(t, RelationTypes, q.RelationTypes)
+	}
+
+	q = &PathQuery{From: from, To: to, MaxLength: 100, Limit: 100}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, MaxPathLength, q.MaxLength)
+		assert.Equal(t, MaxPathCount, q.Limit)
+	}
+
+	q = &PathQuery{From: from, To: to, RelationTypes: []RelationType{"CONTAIN"}}
+	assert.Error(t, q.Normalize())
+
+	q = &PathQuery{From: from, To: from}
+	assert.Error(t, q.Normalize())
+}
+
+func TestSearchPaths(t *testing.T) {
+	from, to := primitive.NewObjectID(), primitive.NewObjectID()
+	f, z := from.Hex(), to.Hex()
+	g := &Graph{
+		Nodes: []Node{note(f), note("a"), note("b"), note("c"), note(z)},
+		Links: []Link{
+			{Source: f, Target: "a"},
+			{Source: "a", Target: z},
+			{Source: f, Target: "b"},
+			{Source: z, Target: "b"},
+			{Source: "b", Target: "c"},
+			{Source: "c", Target: z},
+		},
+	}
+
+	paths := SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: 6, Directed: true, Limit: 5})
+	if assert.Len(t, paths, 2) {
+		assert.Equal(t, []string{f, "a", z}, ids(paths[0].Nodes))
+		assert.Equal(t, []string{f, "b", "c", z}, ids(paths[1].Nodes))
+		assert.Equal(t, []Link{{Source: f, Target: "a"}, {Source: "a", Target: z}}, paths[0].Links)
+	}
+
+	// the link from z to b can be walked backwards.
+	paths = SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: 6, Limit: 5})
+	if assert.Len(t, paths, 3) {
+		assert.Equal(t, []string{f, "a", z}, ids(paths[0].Nodes))
+		assert.Equal(t, []string{f, "b", z}, ids(paths[1].Nodes))
+		assert.Equal(t, Link{Source: z, Target: "b"}, paths[1].Links[1])
+		assert.Equal(t, []string{f, "b", "c", z}, ids(paths[2].Nodes))
+	}
+
+	assert.Len(t, SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: 2, Limit: 1}), 1)
+	assert.Empty(t, SearchPaths(g, &PathQuery{From: to, To: from, MaxLength: 6, Directed: true, Limit: 5}))
+	assert.Empty(t, SearchPaths(g, &PathQuery{From: from, To: primitive.NewObjectID(), MaxLength: 6, Limit: 5}))
+}
+
+func TestSearchPathsDense(t *testing.T) {
+	// every node links to every other one, so there are billions of simple
+	// paths up to the maximum length, of which only the shortest are walked.
+	from, to := primitive.NewObjectID(), primitive.NewObjectID()
+	g := &Graph{Nodes: []Node{note(from.Hex()), note(to.Hex())}}
+	for i := 0; i < 40; i++ {
+		g.Nodes = append(g.Nodes, note(primitive.NewObjectID().Hex()))
+	}
+	for _, a := range g.Nodes {
+		for _, b := range g.Nodes {
+			if a.ID != b.ID {
+				g.Links = append(g.Links, Link{Source: a.ID, Target: b.ID})
+			}
+		}
+	}
+
+	paths := SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: MaxPathLength, Directed: true, Limit: MaxPathCount})
+	if assert.Len(t, paths, MaxPathCount) {
+		assert.Len(t, paths[0].Links, 1)
+		for i := 1; i < len(paths); i++ {
+			assert.Len(t, paths[i].Links, 2)
+			assert.Less(t, paths[i-1].Nodes[1].ID, paths[i].Nodes[1].ID)
+		}
+	}
+}
+
+func TestSearchPathsSpurs(t *testing.T) {
+	// the second path leaves the first one after its second node.
+	from, to := primitive.NewObjectID(), primitive.NewObjectID()
+	f, z := from.Hex(), to.Hex()
+	g := &Graph{
+		Nodes: []Node{note(f), note("a"), note("b"), note("c"), note("d"), note(z)},
+		Links: []Link{
+			{Source: f, Target: "a"},
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: z},
+			{Source: "a", Target: "c"},
+			{Source: "c", Target: "d"},
+			{Source: "d", Target: z},
+		},
+	}
+	paths := SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: 6, Directed: true, Limit: 5})
+	if assert.Len(t, paths, 2) {
+		assert.Equal(t, []string{f, "a", "b", z}, ids(paths[0].Nodes))
+		assert.Equal(t, []string{f, "a", "c", "d", z}, ids(paths[1].Nodes))
+	}
+	assert.Len(t, SearchPaths(g, &PathQuery{From: from, To: to, MaxLength: 3, Directed: true, Limit: 5}), 1)
+}
@@ -2,38 +2,244 @@ package graph
 
 import (
 	"context"
+	"net/http"
+	"time"
+
 	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/collection"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 )
 
 type Service struct {
-	logger *zap.Logger
-	repo   Repo
+	logger         *zap.Logger
+	repo           Repo
+	asteroidRepo   asteroid.Repo
+	collectionRepo collection.Repo
 }
 
 type Repo interface {
-	GetGraphByAsteroidID(ctx context.Context, astID primitive.ObjectID, depth int) (*Graph, error)
-	GetFullGraph(ctx context.Context, accID primitive.ObjectID) (*Graph, error)
+	// GetGraphByAsteroidID expands the neighborhood of the asteroid through the
+	// account's asteroids only, and sets the distance of every node.
+	GetGraphByAsteroidID(ctx context.Context, accID primitive.ObjectID, q *NeighborhoodQuery) (*Graph, error)
+	// GetGraphByAsteroidIDs expands the graph from the given asteroids of the
+	// account, which are at distance zero.
+	GetGraphByAsteroidIDs(ctx context.Context, accID primitive.ObjectID, ids []primitive.ObjectID, q *CollectionQuery) (*Graph, error)
+	// GetFullGraph rebuilds the graph as it was at asOf, or returns the current one when asOf is zero.
+	GetFullGraph(ctx context.Context, accID primitive.ObjectID, asOf time.Time) (*Graph, error)
+	// StreamFullGraph walks the account's current graph straight from the
+	// stores, without holding it in memory.
+	StreamFullGraph(ctx context.Context, accID primitive.ObjectID, v Visitor) error
+	// ListEvents lists the creation of the account's asteroids, and the creation and removal of their links.
+	ListEvents(ctx context.Context, accID primitive.ObjectID) ([]Event, error)
+	// ListHygiene lists a page of the account's asteroids in the hygiene group, and counts the whole group.
+	ListHygiene(ctx context.Context, accID primitive.ObjectID, kind HygieneKind, skip, limit int) ([]Node, int64, error)
+	// GetHubGraph returns the account's hubs, and every asteroid a hub refers to along with those links.
+	GetHubGraph(ctx context.Context, accID primitive.ObjectID) (*Graph, error)
+	// FindPaths finds up to q.Limit paths matching the query, shortest first.
+	// Every path is a graph whose nodes are in the order they are visited.
+	FindPaths(ctx context.Context, accID primitive.ObjectID, q *PathQuery) ([]*Graph, error)
+
+	// GetLayout returns mongo.ErrNoDocuments when the account has no layout yet.
+	GetLayout(ctx context.Context, accID primitive.ObjectID) (*Layout, error)
+	SaveLayout(ctx context.Context, layout *Layout) error
+	SetPosition(ctx context.Context, accID primitive.ObjectID, astID string, pos *Position) error
 }
 
-func NewService(logger *zap.Logger, repo Repo) *Service {
+func NewService(logger *zap.Logger, repo Repo, asteroidRepo asteroid.Repo, collectionRepo collection.Repo) *Service {
 	return &Service{
-		logger: logger,
-		repo:   repo,
+		logger:         logger,
+		repo:           repo,
+		asteroidRepo:   asteroidRepo,
+		collectionRepo: collectionRepo,
 	}
 }
 
-func (s *Service) GetByAsteroidID(ctx context.Context, astID primitive.ObjectID, depth int) (*Graph, error) {
-	if depth <= 0 || depth > 20 {
-		depth = 20
+func (s *Service) GetByAsteroidID(ctx context.Context, q *NeighborhoodQuery) (*Graph, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	accID := auth.FromContext(ctx).ID
+	ast, err := s.asteroidRepo.Get(ctx, q.AsteroidID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if !ast.State {
+		return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
 	}
-	gph, err := s.repo.GetGraphByAsteroidID(ctx, astID, depth)
+	if !asteroid.CanView(accID, ast) {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+	}
+	if !q.AsOf.IsZero() && ast.CreatedTime.After(q.AsOf) {
+		return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("该节点在指定时间尚不存在").WrapSelf()
+	}
+	gph, err := s.repo.GetGraphByAsteroidID(ctx, accID, q)
 	return gph, errors.WithStack(err)
 }
 
-func (s *Service) GetFull(ctx context.Context) (*Graph, error) {
-	gph, err := s.repo.GetFullGraph(ctx, auth.FromContext(ctx).ID)
+// GetByCollection returns the graph of a collection of the current account,
+// made of the items the account can view.
+func (s *Service) GetByCollection(ctx context.Context, q *CollectionQuery) (*Graph, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	accID := auth.FromContext(ctx).ID
+	col, err := s.collectionRepo.Get(ctx, q.CollectionID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("收藏夹不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if col.OwnerID != accID {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权访问不属于你的收藏夹").WrapSelf()
+	}
+	items, err := s.collectionRepo.ListItems(ctx, q.CollectionID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		if item.State && asteroid.CanView(accID, &item.Asteroid) {
+			ids = append(ids, item.ID)
+		}
+	}
+	gph, err := s.repo.GetGraphByAsteroidIDs(ctx, accID, ids, q)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	MarkCollection(gph)
+	return gph, nil
+}
+
+func (s *Service) GetFull(ctx context.Context, asOf time.Time) (*Graph, error) {
+	gph, err := s.repo.GetFullGraph(ctx, auth.FromContext(ctx).ID, asOf)
 	return gph, errors.WithStack(err)
 }
+
+// StreamFull walks the current account's graph into v, for graphs too large
+// to be loaded at once.
+func (s *Service) StreamFull(ctx context.Context, v Visitor) (*StreamSummary, error) {
+	counter := &countingVisitor{Visitor: v}
+	if err := s.repo.StreamFullGraph(ctx, auth.FromContext(ctx).ID, counter); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &counter.summary, nil
+}
+
+// Timeline counts the nodes and links of the current account's graph over time.
+func (s *Service) Timeline(ctx context.Context, interval Interval) ([]*TimelinePoint, error) {
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if !interval.Valid() {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的时间间隔").WrapSelf()
+	}
+	events, err := s.repo.ListEvents(ctx, auth.FromContext(ctx).ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return BuildTimeline(events, interval, time.Now())
+}
+
+const (
+	_DefaultHygienePageSize = 20
+	_MaxHygienePageSize     = 100
+)
+
+// Hygiene reports the poorly connected asteroids of the current account. Each
+// group is paginated on its own, all groups are reported when kinds is empty.
+func (s *Service) Hygiene(ctx context.Context, kinds []HygieneKind, page, size int) ([]*HygieneGroup, error) {
+	if len(kinds) == 0 {
+		kinds = HygieneKinds
+	}
+	for _, kind := range kinds {
+		if !kind.Valid() {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的分组").WrapSelf()
+		}
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = _DefaultHygienePageSize
+	}
+	if size > _MaxHygienePageSize {
+		size = _MaxHygienePageSize
+	}
+
+	accID := auth.FromContext(ctx).ID
+	groups := make([]*HygieneGroup, 0, len(kinds))
+	for _, kind := range kinds {
+		nodes, total, err := s.repo.ListHygiene(ctx, accID, kind, (page-1)*size, size)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		groups = append(groups, &HygieneGroup{Kind: kind, Total: total, Nodes: nodes})
+	}
+	return groups, nil
+}
+
+// HubTree returns the hub hierarchy of the current account.
+func (s *Service) HubTree(ctx context.Context) (*HubTree, error) {
+	gph, err := s.repo.GetHubGraph(ctx, auth.FromContext(ctx).ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return BuildHubTree(gph), nil
+}
+
+// Breadcrumbs returns the shortest hub paths leading to the asteroid from each
+// root hub. An asteroid no hub leads to has no breadcrumbs.
+func (s *Service) Breadcrumbs(ctx context.Context, astID primitive.ObjectID) ([][]Node, error) {
+	gph, err := s.repo.GetHubGraph(ctx, auth.FromContext(ctx).ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return FindBreadcrumbs(gph, astID.Hex()), nil
+}
+
+// ShortestPath finds one of the shortest paths between two asteroids of the current account.
+func (s *Service) ShortestPath(ctx context.Context, q *PathQuery) (*Graph, error) {
+	q.Limit = 1
+	paths, err := s.Paths(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("两个节点之间没有路径").WrapSelf()
+	}
+	return paths[0], nil
+}
+
+// Paths finds the q.Limit shortest paths between two asteroids of the current account.
+func (s *Service) Paths(ctx context.Context, q *PathQuery) ([]*Graph, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	accID := auth.FromContext(ctx).ID
+	asts, err := s.asteroidRepo.List(ctx, []primitive.ObjectID{q.From, q.To})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(asts) != 2 {
+		return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+	}
+	for _, ast := range asts {
+		if !ast.State {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+		}
+		if !asteroid.CanView(accID, ast) {
+			return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+		}
+	}
+	paths, err := s.repo.FindPaths(ctx, accID, q)
+	return paths, errors.WithStack(err)
+}
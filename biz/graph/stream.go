@@ -0,0 +1,30 @@
+package graph
+
+// Visitor receives the nodes and links of a graph as they are read, nodes
+// and links come interleaved and a link may arrive before its nodes.
+type Visitor interface {
+	VisitNode(Node) error
+	VisitLink(Link) error
+}
+
+// StreamSummary counts what a streamed graph contained.
+type StreamSummary struct {
+	Nodes int64
+	Links int64
+}
+
+// countingVisitor counts the nodes and links it passes on.
+type countingVisitor struct {
+	Visitor
+	summary StreamSummary
+}
+
+func (v *countingVisitor) VisitNode(node Node) error {
+	v.summary.Nodes++
+	return v.Visitor.VisitNode(node)
+}
+
+func (v *countingVisitor) VisitLink(link Link) error {
+	v.summary.Links++
+	return v.Visitor.VisitLink(link)
+}
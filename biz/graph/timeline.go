@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+)
+
+// EventKind is a change of the graph recorded in time.
+type EventKind string
+
+const (
+	EventNodeCreated EventKind = "node_created"
+	EventLinkCreated EventKind = "link_created"
+	EventLinkRemoved EventKind = "link_removed"
+)
+
+type Event struct {
+	Kind EventKind
+	Time time.Time
+}
+
+// Interval is the span of time covered by each point of a timeline.
+type Interval string
+
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+)
+
+func (x Interval) Valid() bool {
+	switch x {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+		return true
+	}
+	return false
+}
+
+// start returns the beginning of the interval t is in, weeks start on Monday.
+func (x Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch x {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+func (x Interval) next(t time.Time) time.Time {
+	switch x {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// MaxTimelinePoints bounds the length of a timeline, a coarser interval is
+// needed for a longer history.
+const MaxTimelinePoints = 1000
+
+// TimelinePoint counts the nodes and links at the end of an interval, along
+// with the changes during it.
+type TimelinePoint struct {
+	Time         time.Time
+	Nodes        int
+	Links        int
+	NodesAdded   int
+	LinksAdded   int
+	LinksRemoved int
+}
+
+// BuildTimeline replays the events into one point per interval, from the
+// interval of the first event to the one of now.
+func BuildTimeline(events []Event, interval Interval, now time.Time) ([]*TimelinePoint, error) {
+	points := make([]*TimelinePoint, 0)
+	if len(events) == 0 {
+		return points, nil
+	}
+	sorted := append(make([]Event, 0, len(events)), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	first, last := interval.start(sorted[0].Time), interval.start(now)
+	if end := interval.start(sorted[len(sorted)-1].Time); end.After(last) {
+		last = end
+	}
+	count := 0
+	for t := first; !t.After(last); t = interval.next(t) {
+		if count++; count > MaxTimelinePoints {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("时间跨度过大, 请使用更大的时间间隔").WrapSelf()
+		}
+	}
+
+	nodes, links, i := 0, 0, 0
+	for t := first; !t.After(last); t = interval.next(t) {
+		point := &TimelinePoint{Time: t}
+		end := interval.next(t)
+		for ; i < len(sorted) && sorted[i].Time.Before(end); i++ {
+			switch sorted[i].Kind {
+			case EventNodeCreated:
+				point.NodesAdded++
+			case EventLinkCreated:
+				point.LinksAdded++
+			case EventLinkRemoved:
+				point.LinksRemoved++
+			}
+		}
+		nodes += point.NodesAdded
+		links += point.LinksAdded - point.LinksRemoved
+		point.Nodes, point.Links = nodes, links
+		points = append(points, point)
+	}
+	return points, nil
+}
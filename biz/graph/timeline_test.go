@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2022, 3, d, h, 0, 0, 0, time.UTC) }
+	events := []Event{
+		{Kind: EventLinkCreated, Time: day(2, 10)},
+		{Kind: EventNodeCreated, Time: day(1, 9)},
+		{Kind: EventNodeCreated, Time: day(1, 23)},
+		{Kind: EventNodeCreated, Time: day(3, 8)},
+		{Kind: EventLinkCreated, Time: day(3, 9)},
+		{Kind: EventLinkRemoved, Time: day(3, 10)},
+	}
+
+	points, err := BuildTimeline(events, IntervalDay, day(4, 12))
+	if assert.NoError(t, err) && assert.Len(t, points, 4) {
+		assert.Equal(t, &TimelinePoint{Time: day(1, 0), Nodes: 2, NodesAdded: 2}, points[0])
+		assert.Equal(t, &TimelinePoint{Time: day(2, 0), Nodes: 2, Links: 1, LinksAdded: 1}, points[1])
+		assert.Equal(t, &TimelinePoint{Time: day(3, 0), Nodes: 3, Links: 1, NodesAdded: 1, LinksAdded: 1, LinksRemoved: 1}, points[2])
+		assert.Equal(t, &TimelinePoint{Time: day(4, 0), Nodes: 3, Links: 1}, points[3])
+	}
+
+	// 2022-03-01 is a Tuesday, its week starts on Monday the 28th of February.
+	points, err = BuildTimeline(events, IntervalWeek, day(4, 12))
+	if assert.NoError(t, err) && assert.Len(t, points, 1) {
+		assert.Equal(t, time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC), points[0].Time)
+		assert.Equal(t, 3, points[0].Nodes)
+		assert.Equal(t, 1, points[0].Links)
+	}
+
+	points, err = BuildTimeline(events, IntervalMonth, day(4, 12).AddDate(0, 1, 0))
+	if assert.NoError(t, err) && assert.Len(t, points, 2) {
+		assert.Equal(t, time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), points[1].Time)
+		assert.Equal(t, 3, points[1].Nodes)
+	}
+
+	_, err = BuildTimeline(events, IntervalDay, day(1, 0).AddDate(5, 0, 0))
+	assert.Error(t, err)
+
+	points, err = BuildTimeline(nil, IntervalDay, day(1, 0))
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+}
@@ -0,0 +1,207 @@
+package graph
+
+import "sort"
+
+// MaxBreadcrumbs bounds how many shortest paths are enumerated for one asteroid.
+const MaxBreadcrumbs = 50
+
+type TreeNode struct {
+	Node
+	Children []*TreeNode
+}
+
+// HubTree arranges hubs as a forest along the REFER links between them. Every
+// hub appears exactly once, so the hub links that are not part of the forest
+// are reported separately.
+type HubTree struct {
+	Roots []*TreeNode
+	// CycleLinks point back to an ancestor, they are cut to break the cycles.
+	CycleLinks []Link
+	// ExtraLinks point to a hub already placed under another parent.
+	ExtraLinks []Link
+}
+
+// hubAdjacency keeps the hub nodes of g, and the links between hubs sorted by
+// target so that the result doesn't depend on the order the store returned.
+func hubAdjacency(g *Graph) (map[string]Node, []string, map[string][]string, map[string]int) {
+	hubs := make(map[string]Node)
+	ids := make([]string, 0)
+	for _, node := range g.Nodes {
+		if node.Hub {
+			hubs[node.ID] = node
+			ids = append(ids, node.ID)
+		}
+	}
+	// object IDs sort in creation order.
+	sort.Strings(ids)
+
+	adj := make(map[string][]string)
+	inDegree := make(map[string]int)
+	seen := make(map[Link]struct{})
+	for _, link := range g.Links {
+		_, sourceIsHub := hubs[link.Source]
+		_, targetIsHub := hubs[link.Target]
+		if !sourceIsHub || !targetIsHub {
+			continue
+		}
+		key := Link{Source: link.Source, Target: link.Target}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		adj[link.Source] = append(adj[link.Source], link.Target)
+		inDegree[link.Target]++
+	}
+	for _, targets := range adj {
+		sort.Strings(targets)
+	}
+	return hubs, ids, adj, inDegree
+}
+
+// BuildHubTree builds the hub hierarchy of g. Hubs nothing refers to are the
+// roots, and a cycle no root leads to is entered from its earliest created hub.
+func BuildHubTree(g *Graph) *HubTree {
+	hubs, ids, adj, inDegree := hubAdjacency(g)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(ids))
+	tree := &HubTree{
+		Roots:      make([]*TreeNode, 0),
+		CycleLinks: make([]Link, 0),
+		ExtraLinks: make([]Link, 0),
+	}
+
+	var visit func(id string) *TreeNode
+	visit = func(id string) *TreeNode {
+		state[id] = visiting
+		tn := &TreeNode{Node: hubs[id], Children: make([]*TreeNode, 0)}
+		for _, child := range adj[id] {
+			switch state[child] {
+			case unvisited:
+				tn.Children = append(tn.Children, visit(child))
+			case visiting:
+				tree.CycleLinks = append(tree.CycleLinks, Link{Source: id, Target: child})
+			case visited:
+				tree.ExtraLinks = append(tree.ExtraLinks, Link{Source: id, Target: child})
+			}
+		}
+		state[id] = visited
+		return tn
+	}
+
+	for _, id := range ids {
+		if inDegree[id] == 0 {
+			tree.Roots = append(tree.Roots, visit(id))
+		}
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			tree.Roots = append(tree.Roots, visit(id))
+		}
+	}
+	return tree
+}
+
+// FindBreadcrumbs returns, for every root hub of g leading to the target,
+// its shortest paths to the target, passing through hubs only. A root farther
+// away than another is reported all the same. The paths start at the root and
+// end at the target, roots in the order of the hub tree, at most
+// MaxBreadcrumbs of them are returned.
+func FindBreadcrumbs(g *Graph, target string) [][]Node {
+	nodes := make(map[string]Node, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes[node.ID] = node
+	}
+	paths := make([][]Node, 0)
+	if _, ok := nodes[target]; !ok {
+		return paths
+	}
+
+	tree := BuildHubTree(g)
+	hubs, _, hubAdj, _ := hubAdjacency(g)
+
+	// hub links leading to non-hub nodes are only ever the last hop.
+	adj := make(map[string][]string, len(hubAdj))
+	for source, targets := range hubAdj {
+		adj[source] = append(adj[source], targets...)
+	}
+	for _, link := range g.Links {
+		if _, ok := hubs[link.Source]; !ok {
+			continue
+		}
+		if _, ok := hubs[link.Target]; ok {
+			continue
+		}
+		adj[link.Source] = append(adj[link.Source], link.Target)
+	}
+
+	for _, root := range tree.Roots {
+		if len(paths) >= MaxBreadcrumbs {
+			break
+		}
+		paths = appendShortestPaths(paths, nodes, hubs, adj, root.ID, target)
+	}
+	return paths
+}
+
+// appendShortestPaths appends every shortest path from root to target to
+// paths, until there are MaxBreadcrumbs of them.
+func appendShortestPaths(paths [][]Node, nodes, hubs map[string]Node, adj map[string][]string, root, target string) [][]Node {
+	// BFS from the root, remembering every predecessor on a shortest path.
+	dist := map[string]int{root: 0}
+	preds := make(map[string][]string)
+	queue := []string{root}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == target {
+			continue
+		}
+		if _, ok := hubs[cur]; !ok {
+			continue
+		}
+		for _, next := range adj[cur] {
+			d, ok := dist[next]
+			if !ok {
+				dist[next] = dist[cur] + 1
+				preds[next] = append(preds[next], cur)
+				queue = append(queue, next)
+			} else if d == dist[cur]+1 {
+				preds[next] = append(preds[next], cur)
+			}
+		}
+	}
+	if _, ok := dist[target]; !ok {
+		return paths
+	}
+
+	// walks the predecessors back from the target.
+	reversed := make([]string, 0, dist[target]+1)
+	var walk func(id string)
+	walk = func(id string) {
+		if len(paths) >= MaxBreadcrumbs {
+			return
+		}
+		reversed = append(reversed, id)
+		if id == root {
+			path := make([]Node, len(reversed))
+			for i, pid := range reversed {
+				path[len(reversed)-1-i] = nodes[pid]
+			}
+			paths = append(paths, path)
+		} else {
+			ps := preds[id]
+			sort.Strings(ps)
+			for _, p := range ps {
+				walk(p)
+			}
+		}
+		reversed = reversed[:len(reversed)-1]
+	}
+	walk(target)
+	return paths
+}
@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hub(id string) Node  { return Node{ID: id, Hub: true, Title: "hub " + id} }
+func note(id string) Node { return Node{ID: id, Title: "note " + id} }
+
+func ids(nodes []Node) []string {
+	res := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, node.ID)
+	}
+	return res
+}
+
+func TestBuildHubTree(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{hub("a"), hub("b"), hub("c"), hub("d"), hub("x"), hub("y"), note("n")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "a", Target: "c"},
+			{Source: "b", Target: "d"},
+			{Source: "c", Target: "d"},
+			{Source: "d", Target: "b"},
+			{Source: "d", Target: "n"},
+			// a cycle nothing leads to.
+			{Source: "x", Target: "y"},
+			{Source: "y", Target: "x"},
+		},
+	}
+	tree := BuildHubTree(g)
+
+	if assert.Len(t, tree.Roots, 2) {
+		a := tree.Roots[0]
+		assert.Equal(t, "a", a.ID)
+		if assert.Len(t, a.Children, 2) {
+			assert.Equal(t, "b", a.Children[0].ID)
+			assert.Equal(t, "c", a.Children[1].ID)
+			if assert.Len(t, a.Children[0].Children, 1) {
+				assert.Equal(t, "d", a.Children[0].Children[0].ID)
+				assert.Empty(t, a.Children[0].Children[0].Children)
+			}
+			assert.Empty(t, a.Children[1].Children)
+		}
+
+		x := tree.Roots[1]
+		assert.Equal(t, "x", x.ID)
+		if assert.Len(t, x.Children, 1) {
+			assert.Equal(t, "y", x.Children[0].ID)
+		}
+	}
+	assert.ElementsMatch(t, []Link{{Source: "d", Target: "b"}, {Source: "y", Target: "x"}}, tree.CycleLinks)
+	assert.ElementsMatch(t, []Link{{Source: "c", Target: "d"}}, tree.ExtraLinks)
+}
+
+func TestFindBreadcrumbs(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{hub("a"), hub("b"), hub("c"), hub("d"), hub("e"), note("n"), note("m")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "b", Target: "c"},
+			{Source: "c", Target: "n"},
+			{Source: "e", Target: "d"},
+			{Source: "d", Target: "n"},
+			// non-hub nodes are never passed through.
+			{Source: "m", Target: "n"},
+		},
+	}
+
+	paths := FindBreadcrumbs(g, "n")
+	got := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		got = append(got, ids(path))
+	}
+	// every root gets its shortest path, however longer than the others.
+	assert.Equal(t, [][]string{
+		{"a", "b", "c", "n"},
+		{"e", "d", "n"},
+	}, got)
+
+	paths = FindBreadcrumbs(g, "b")
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, []string{"a", "b"}, ids(paths[0]))
+	}
+
+	paths = FindBreadcrumbs(g, "a")
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, []string{"a"}, ids(paths[0]))
+	}
+
+	assert.Empty(t, FindBreadcrumbs(g, "m"))
+	assert.Empty(t, FindBreadcrumbs(g, "unknown"))
+}
+
+func TestFindBreadcrumbsAllShortest(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{hub("a"), hub("b"), hub("c"), note("n")},
+		Links: []Link{
+			{Source: "a", Target: "b"},
+			{Source: "a", Target: "c"},
+			{Source: "b", Target: "n"},
+			{Source: "c", Target: "n"},
+		},
+	}
+	paths := FindBreadcrumbs(g, "n")
+	got := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		got = append(got, ids(path))
+	}
+	assert.ElementsMatch(t, [][]string{{"a", "b", "n"}, {"a", "c", "n"}}, got)
+}
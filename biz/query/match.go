@@ -0,0 +1,111 @@
+package query
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+)
+
+// Match evaluates the field filter of a query against an asteroid, for the
+// stores that can't compile it. Graph predicates never match, Split them out first.
+func Match(e Expr, ast *asteroid.Asteroid) bool {
+	switch x := e.(type) {
+	case nil:
+		return true
+	case *And:
+		for _, term := range x.Terms {
+			if !Match(term, ast) {
+				return false
+			}
+		}
+		return true
+	case *Or:
+		for _, term := range x.Terms {
+			if Match(term, ast) {
+				return true
+			}
+		}
+		return false
+	case *Not:
+		return !Match(x.Expr, ast)
+	case *Compare:
+		return x.match(ast)
+	}
+	return false
+}
+
+func (c *Compare) match(ast *asteroid.Asteroid) bool {
+	switch c.Field {
+	case FieldHub:
+		return compareOrdered(c.Op, boolNumber(ast.Hub), boolNumber(c.Value.(bool)))
+	case FieldTitle, FieldContent:
+		text := ast.Title
+		if c.Field == FieldContent {
+			text = ast.Content
+		}
+		if c.Op == OpContains {
+			return strings.Contains(strings.ToLower(text), strings.ToLower(c.Value.(string)))
+		}
+		return compareOrdered(c.Op, strings.Compare(text, c.Value.(string)), 0)
+	case FieldType:
+		return compareNumbers(c.Op, float64(ast.Type), c.Value.(float64))
+	case FieldViews:
+		return compareNumbers(c.Op, float64(ast.ViewCount), c.Value.(float64))
+	case FieldCreated, FieldUpdated:
+		t := ast.CreatedTime
+		if c.Field == FieldUpdated {
+			t = ast.UpdatedTime
+		}
+		return compareOrdered(c.Op, compareTimes(t, c.Value.(time.Time)), 0)
+	}
+	return false
+}
+
+func boolNumber(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareNumbers(op Op, a, b float64) bool {
+	switch {
+	case a < b:
+		return compareOrdered(op, -1, 0)
+	case a > b:
+		return compareOrdered(op, 1, 0)
+	}
+	return compareOrdered(op, 0, 0)
+}
+
+// times are stored to the millisecond, values are compared at the same precision.
+func compareTimes(a, b time.Time) int {
+	am, bm := a.UnixNano()/int64(time.Millisecond), b.UnixNano()/int64(time.Millisecond)
+	switch {
+	case am < bm:
+		return -1
+	case am > bm:
+		return 1
+	}
+	return 0
+}
+
+// compareOrdered applies the operator to two comparable ints.
+func compareOrdered(op Op, a, b int) bool {
+	switch op {
+	case OpEq:
+		return a == b
+	case OpNe:
+		return a != b
+	case OpLt:
+		return a < b
+	case OpLte:
+		return a <= b
+	case OpGt:
+		return a > b
+	case OpGte:
+		return a >= b
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2022, 3, 10, 15, 30, 0, 0, time.UTC)
+	ast := &asteroid.Asteroid{
+		Hub:         true,
+		Type:        2,
+		Title:       "Learning Go",
+		Content:     "channels and goroutines",
+		ViewCount:   12,
+		CreatedTime: time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC),
+		UpdatedTime: time.Date(2022, 3, 9, 8, 0, 0, 0, time.UTC),
+	}
+
+	for input, want := range map[string]bool{
+		`hub = true`:                                true,
+		`hub != true`:                               false,
+		`title ~ "go"`:                              true,
+		`title = "learning go"`:                     false,
+		`content ~ "GOROUTINE" AND views >= 12`:     true,
+		`type = 1 OR views > 12`:                    false,
+		`NOT type = 1`:                              true,
+		`created >= this_month AND updated < today`: true,
+		`updated > 2022-03-09T08:00:00Z`:            false,
+		`updated >= 2022-03-09T08:00:00Z`:           true,
+	} {
+		e, err := Parse(input, now)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, want, Match(e, ast), input)
+		}
+	}
+
+	assert.True(t, Match(nil, ast))
+	assert.False(t, Match(&Linked{Direction: LinksTo}, ast))
+}
@@ -0,0 +1,502 @@
+package query
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+)
+
+// The query language filters the asteroids of an account, for instance
+//
+//	hub = true AND links_to(title ~ "go" AND created >= this_month)
+//
+// Comparisons test an asteroid field against a literal, and combine with AND,
+// OR, NOT and parentheses. links_to(...) and linked_from(...) keep the
+// asteroids linked to or from an asteroid matching the inner query, they may
+// only be combined with AND at the top level, and can't be nested.
+
+// Field is an asteroid field a query can compare.
+type Field string
+
+const (
+	FieldHub     Field = "hub"
+	FieldTitle   Field = "title"
+	FieldContent Field = "content"
+	FieldType    Field = "type"
+	FieldViews   Field = "views"
+	FieldCreated Field = "created"
+	FieldUpdated Field = "updated"
+)
+
+// Kind is the type of the values of a field.
+type Kind int
+
+const (
+	KindBool Kind = iota
+	KindString
+	KindNumber
+	KindTime
+)
+
+var _FieldKinds = map[Field]Kind{
+	FieldHub:     KindBool,
+	FieldTitle:   KindString,
+	FieldContent: KindString,
+	FieldType:    KindNumber,
+	FieldViews:   KindNumber,
+	FieldCreated: KindTime,
+	FieldUpdated: KindTime,
+}
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	OpEq       Op = "="
+	OpNe       Op = "!="
+	OpLt       Op = "<"
+	OpLte      Op = "<="
+	OpGt       Op = ">"
+	OpGte      Op = ">="
+	OpContains Op = "~"
+)
+
+// _KindOps whitelists the operators each kind of field supports.
+var _KindOps = map[Kind][]Op{
+	KindBool:   {OpEq, OpNe},
+	KindString: {OpEq, OpNe, OpContains},
+	KindNumber: {OpEq, OpNe, OpLt, OpLte, OpGt, OpGte},
+	KindTime:   {OpLt, OpLte, OpGt, OpGte},
+}
+
+// LinkDirection tells which end of the REFER link a graph predicate matches.
+type LinkDirection string
+
+const (
+	LinksTo    LinkDirection = "links_to"
+	LinkedFrom LinkDirection = "linked_from"
+)
+
+const (
+	MaxQueryLength = 1000
+	// MaxDepth bounds the nesting of parentheses and operators.
+	MaxDepth = 16
+)
+
+// Expr is a node of a parsed query.
+type Expr interface {
+	expr()
+}
+
+type And struct{ Terms []Expr }
+
+type Or struct{ Terms []Expr }
+
+type Not struct{ Expr Expr }
+
+// Compare tests a field against a value, whose Go type follows the kind of the
+// field: bool, string, float64 or time.Time.
+type Compare struct {
+	Field Field
+	Op    Op
+	Value interface{}
+}
+
+// Linked is a graph predicate, matching the asteroids linked with at least one
+// asteroid matching Query.
+type Linked struct {
+	Direction LinkDirection
+	Query     Expr
+}
+
+func (*And) expr()     {}
+func (*Or) expr()      {}
+func (*Not) expr()     {}
+func (*Compare) expr() {}
+func (*Linked) expr()  {}
+
+// Split separates the graph predicates of a parsed query from the rest, which
+// only filters on fields. The filter is nil when there's nothing to filter.
+func Split(e Expr) (Expr, []*Linked) {
+	switch x := e.(type) {
+	case *Linked:
+		return nil, []*Linked{x}
+	case *And:
+		terms := make([]Expr, 0, len(x.Terms))
+		linked := make([]*Linked, 0)
+		for _, term := range x.Terms {
+			if l, ok := term.(*Linked); ok {
+				linked = append(linked, l)
+			} else {
+				terms = append(terms, term)
+			}
+		}
+		switch len(terms) {
+		case 0:
+			return nil, linked
+		case 1:
+			return terms[0], linked
+		}
+		return &And{Terms: terms}, linked
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the rune offset of the token, for error messages.
+	pos int
+}
+
+func syntaxError(pos int, format string, args ...interface{}) error {
+	msg := fmt.Sprintf("查询语法错误 (第 %d 个字符): ", pos+1) + fmt.Sprintf(format, args...)
+	return bizerr.New().StatusCode(http.StatusBadRequest).Msg(msg).WrapSelf()
+}
+
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	tokens := make([]token, 0)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+					sb.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, syntaxError(start, "字符串没有结束")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' && r != '~' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, syntaxError(start, "未知的运算符 %q", op)
+			}
+			i += utf8.RuneCountInString(op)
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: start})
+		case unicode.IsDigit(r) || r == '-' || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune("-.:+TZ", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			return nil, syntaxError(i, "无法识别的字符 %q", r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	cur    int
+	now    time.Time
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.cur]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.cur]
+	if t.kind != tokenEOF {
+		p.cur++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenIdent && strings.EqualFold(t.text, word) {
+		p.cur++
+		return true
+	}
+	return false
+}
+
+// Parse parses the query and checks it against the whitelist of fields and
+// operators. now is the reference of relative times such as this_month.
+func Parse(input string, now time.Time) (Expr, error) {
+	if utf8.RuneCountInString(input) > MaxQueryLength {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("查询过长").WrapSelf()
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, now: now}
+	if p.peek().kind == tokenEOF {
+		return nil, syntaxError(0, "查询为空")
+	}
+	e, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, syntaxError(t.pos, "多余的 %q", t.text)
+	}
+	if err := checkLinked(e, true); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// checkLinked makes sure graph predicates only appear at the top level, and
+// only joined with AND.
+func checkLinked(e Expr, top bool) error {
+	switch x := e.(type) {
+	case *Linked:
+		if !top {
+			return bizerr.New().StatusCode(http.StatusBadRequest).Msg("links_to 和 linked_from 只能用 AND 连接在查询的最外层").WrapSelf()
+		}
+		return checkLinked(x.Query, false)
+	case *And:
+		for _, term := range x.Terms {
+			if err := checkLinked(term, top); err != nil {
+				return err
+			}
+		}
+	case *Or:
+		for _, term := range x.Terms {
+			if err := checkLinked(term, false); err != nil {
+				return err
+			}
+		}
+	case *Not:
+		return checkLinked(x.Expr, false)
+	}
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (Expr, error) {
+	if depth > MaxDepth {
+		return nil, syntaxError(p.peek().pos, "嵌套过深")
+	}
+	left, err := p.parseAnd(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{left}
+	for p.keyword("OR") {
+		right, err := p.parseAnd(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, right)
+	}
+	if len(terms) == 1 {
+		return left, nil
+	}
+	return &Or{Terms: terms}, nil
+}
+
+func (p *parser) parseAnd(depth int) (Expr, error) {
+	left, err := p.parseNot(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{left}
+	for p.keyword("AND") {
+		right, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, right)
+	}
+	if len(terms) == 1 {
+		return left, nil
+	}
+	return &And{Terms: terms}, nil
+}
+
+func (p *parser) parseNot(depth int) (Expr, error) {
+	if depth > MaxDepth {
+		return nil, syntaxError(p.peek().pos, "嵌套过深")
+	}
+	if p.keyword("NOT") {
+		e, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	}
+	return p.parsePrimary(depth + 1)
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		return syntaxError(t.pos, "应为 %q", text)
+	}
+	return nil
+}
+
+func (p *parser) parsePrimary(depth int) (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		e, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(tokenRParen, ")")
+	case tokenIdent:
+		name := strings.ToLower(t.text)
+		if dir := LinkDirection(name); dir == LinksTo || dir == LinkedFrom {
+			if err := p.expect(tokenLParen, "("); err != nil {
+				return nil, err
+			}
+			inner, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokenRParen, ")"); err != nil {
+				return nil, err
+			}
+			return &Linked{Direction: dir, Query: inner}, nil
+		}
+		return p.parseCompare(t, Field(name))
+	}
+	if t.kind == tokenEOF {
+		return nil, syntaxError(t.pos, "查询不完整")
+	}
+	return nil, syntaxError(t.pos, "意外的 %q", t.text)
+}
+
+func (p *parser) parseCompare(fieldToken token, field Field) (Expr, error) {
+	kind, ok := _FieldKinds[field]
+	if !ok {
+		return nil, syntaxError(fieldToken.pos, "不支持的字段 %q", fieldToken.text)
+	}
+	opToken := p.next()
+	if opToken.kind != tokenOp {
+		return nil, syntaxError(opToken.pos, "字段 %q 后应为运算符", fieldToken.text)
+	}
+	op := Op(opToken.text)
+	allowed := false
+	for _, o := range _KindOps[kind] {
+		allowed = allowed || o == op
+	}
+	if !allowed {
+		return nil, syntaxError(opToken.pos, "字段 %q 不支持运算符 %q", fieldToken.text, opToken.text)
+	}
+
+	valueToken := p.next()
+	value, err := p.parseValue(kind, valueToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Compare{Field: field, Op: op, Value: value}, nil
+}
+
+func (p *parser) parseValue(kind Kind, t token) (interface{}, error) {
+	switch kind {
+	case KindBool:
+		if t.kind == tokenIdent {
+			switch strings.ToLower(t.text) {
+			case "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+		}
+		return nil, syntaxError(t.pos, "应为 true 或 false")
+	case KindString:
+		if t.kind == tokenString {
+			return t.text, nil
+		}
+		return nil, syntaxError(t.pos, "应为带引号的字符串")
+	case KindNumber:
+		if t.kind == tokenNumber {
+			if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, syntaxError(t.pos, "应为数字")
+	default:
+		if tm, ok := p.parseTime(t); ok {
+			return tm, nil
+		}
+		return nil, syntaxError(t.pos, "应为日期 (2006-01-02), 时间 (RFC 3339) 或 today, this_week, this_month, this_year")
+	}
+}
+
+// parseTime reads dates and times in the time zone of now, and the beginning
+// of the current day, week, month or year.
+func (p *parser) parseTime(t token) (time.Time, bool) {
+	now := p.now
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch t.kind {
+	case tokenIdent:
+		switch strings.ToLower(t.text) {
+		case "now":
+			return now, true
+		case "today":
+			return today, true
+		case "this_week":
+			return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7)), true
+		case "this_month":
+			return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), true
+		case "this_year":
+			return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location()), true
+		}
+	case tokenNumber:
+		if tm, err := time.ParseInLocation("2006-01-02", t.text, now.Location()); err == nil {
+			return tm, true
+		}
+		if tm, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return tm, true
+		}
+	}
+	return time.Time{}, false
+}
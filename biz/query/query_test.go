@@ -0,0 +1,92 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	// 2022-03-10 is a Thursday.
+	now := time.Date(2022, 3, 10, 15, 30, 0, 0, time.UTC)
+
+	e, err := Parse(`hub = true AND links_to(title ~ "go \"lang\"" and created >= this_month)`, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &And{Terms: []Expr{
+			&Compare{Field: FieldHub, Op: OpEq, Value: true},
+			&Linked{Direction: LinksTo, Query: &And{Terms: []Expr{
+				&Compare{Field: FieldTitle, Op: OpContains, Value: `go "lang"`},
+				&Compare{Field: FieldCreated, Op: OpGte, Value: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+			}}},
+		}}, e)
+	}
+
+	// AND binds tighter than OR, NOT tighter than AND.
+	e, err = Parse(`type = 1 OR NOT views > 10 AND updated < 2022-01-02`, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Or{Terms: []Expr{
+			&Compare{Field: FieldType, Op: OpEq, Value: float64(1)},
+			&And{Terms: []Expr{
+				&Not{Expr: &Compare{Field: FieldViews, Op: OpGt, Value: float64(10)}},
+				&Compare{Field: FieldUpdated, Op: OpLt, Value: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+			}},
+		}}, e)
+	}
+
+	e, err = Parse(`(created > this_week) AND updated <= 2022-03-09T08:00:00Z`, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &And{Terms: []Expr{
+			&Compare{Field: FieldCreated, Op: OpGt, Value: time.Date(2022, 3, 7, 0, 0, 0, 0, time.UTC)},
+			&Compare{Field: FieldUpdated, Op: OpLte, Value: time.Date(2022, 3, 9, 8, 0, 0, 0, time.UTC)},
+		}}, e)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	now := time.Now()
+	for _, input := range []string{
+		``,
+		`author_id = "x"`,
+		`hub ~ true`,
+		`title > "a"`,
+		`created = today`,
+		`views = "10"`,
+		`title = "unterminated`,
+		`hub = true AND`,
+		`(hub = true`,
+		`hub = true hub = false`,
+		`title = "a" ; drop`,
+		`hub = true OR links_to(hub = true)`,
+		`NOT linked_from(hub = true)`,
+		`links_to(linked_from(hub = true))`,
+	} {
+		_, err := Parse(input, now)
+		assert.Error(t, err, input)
+	}
+
+	deep := ""
+	for i := 0; i < MaxDepth; i++ {
+		deep += "NOT "
+	}
+	_, err := Parse(deep+"hub = true", now)
+	assert.Error(t, err)
+}
+
+func TestSplit(t *testing.T) {
+	hub := &Compare{Field: FieldHub, Op: OpEq, Value: true}
+	to := &Linked{Direction: LinksTo, Query: hub}
+	from := &Linked{Direction: LinkedFrom, Query: hub}
+
+	filter, linked := Split(&And{Terms: []Expr{hub, to, from}})
+	assert.Equal(t, hub, filter)
+	assert.Equal(t, []*Linked{to, from}, linked)
+
+	filter, linked = Split(to)
+	assert.Nil(t, filter)
+	assert.Equal(t, []*Linked{to}, linked)
+
+	filter, linked = Split(hub)
+	assert.Equal(t, hub, filter)
+	assert.Empty(t, linked)
+}
@@ -0,0 +1,81 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+	// Timeout bounds the whole execution of a query, graph predicates included.
+	Timeout = 5 * time.Second
+)
+
+// ErrTooManyMatches is returned by the repo when the inner query of a graph
+// predicate matches more asteroids than it's willing to follow.
+var ErrTooManyMatches = bizerr.New().StatusCode(http.StatusBadRequest).Msg("links_to 或 linked_from 内的查询匹配的节点过多, 请缩小范围").WrapSelf()
+
+type Result struct {
+	Asteroids []*asteroid.Asteroid
+	// Truncated is set when more asteroids than the limit match the query.
+	Truncated bool
+}
+
+type Service struct {
+	logger *zap.Logger
+	repo   Repo
+}
+
+type Repo interface {
+	// Run returns up to limit living asteroids of the account matching e,
+	// without content, most recently updated first.
+	Run(ctx context.Context, accID primitive.ObjectID, e Expr, limit int) ([]*asteroid.Asteroid, error)
+}
+
+func NewService(logger *zap.Logger, repo Repo) *Service {
+	return &Service{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+// Run parses the query and runs it against the asteroids of the current account.
+func (s *Service) Run(ctx context.Context, input string, limit int) (*Result, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	e, err := Parse(input, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	asts, err := s.repo.Run(ctx, auth.FromContext(ctx).ID, e, limit+1)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return nil, bizerr.New().StatusCode(http.StatusRequestTimeout).Msg("查询超时, 请缩小查询范围").WrapSelf()
+		}
+		if errors.Is(err, ErrTooManyMatches) {
+			return nil, err
+		}
+		return nil, errors.WithStack(err)
+	}
+	result := &Result{Asteroids: asts}
+	if len(asts) > limit {
+		result.Asteroids, result.Truncated = asts[:limit], true
+	}
+	return result, nil
+}
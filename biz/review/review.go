@@ -0,0 +1,94 @@
+package review
+
+import (
+	"math"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MinGrade = 0
+	MaxGrade = 5
+
+	// PassGrade is the lowest grade that counts as a successful recall.
+	PassGrade = 3
+
+	DefaultEaseFactor = 2.5
+	MinEaseFactor     = 1.3
+)
+
+// Card is an asteroid enrolled in review, scheduled with the SM-2 algorithm.
+type Card struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	State       bool               `bson:"state"`
+	CreatedTime time.Time          `bson:"created_time"`
+	UpdatedTime time.Time          `bson:"updated_time"`
+
+	OwnerID    primitive.ObjectID `bson:"owner_id"`
+	AsteroidID primitive.ObjectID `bson:"asteroid_id"`
+	Tags       []string           `bson:"tags"`
+
+	Repetitions int       `bson:"repetitions"`
+	IntervalDay int       `bson:"interval_day"`
+	EaseFactor  float64   `bson:"ease_factor"`
+	DueTime     time.Time `bson:"due_time"`
+
+	Stats Stats `bson:"stats"`
+}
+
+type Stats struct {
+	Reviews          int       `bson:"reviews"`
+	Lapses           int       `bson:"lapses"`
+	TotalGrade       int       `bson:"total_grade"`
+	LastGrade        int       `bson:"last_grade"`
+	LastReviewedTime time.Time `bson:"last_reviewed_time"`
+}
+
+func (x *Stats) AverageGrade() float64 {
+	if x.Reviews == 0 {
+		return 0
+	}
+	return float64(x.TotalGrade) / float64(x.Reviews)
+}
+
+// Item is a due card together with the asteroid it reviews.
+type Item struct {
+	Card     *Card
+	Asteroid *asteroid.Asteroid
+}
+
+// Schedule applies a recall grade to the card and moves its due time
+// according to SM-2.
+func (x *Card) Schedule(grade int, now time.Time) {
+	if grade >= PassGrade {
+		switch x.Repetitions {
+		case 0:
+			x.IntervalDay = 1
+		case 1:
+			x.IntervalDay = 6
+		default:
+			x.IntervalDay = int(math.Round(float64(x.IntervalDay) * x.EaseFactor))
+		}
+		x.Repetitions++
+	} else {
+		x.Repetitions = 0
+		x.IntervalDay = 1
+		x.Stats.Lapses++
+	}
+
+	q := float64(MaxGrade - grade)
+	x.EaseFactor += 0.1 - q*(0.08+q*0.02)
+	if x.EaseFactor < MinEaseFactor {
+		x.EaseFactor = MinEaseFactor
+	}
+
+	x.DueTime = now.AddDate(0, 0, x.IntervalDay)
+	x.UpdatedTime = now
+
+	x.Stats.Reviews++
+	x.Stats.TotalGrade += grade
+	x.Stats.LastGrade = grade
+	x.Stats.LastReviewedTime = now
+}
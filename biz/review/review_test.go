@@ -0,0 +1,47 @@
+package review
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC)
+	card := &Card{EaseFactor: DefaultEaseFactor, DueTime: now}
+
+	card.Schedule(5, now)
+	assert.Equal(t, 1, card.Repetitions)
+	assert.Equal(t, 1, card.IntervalDay)
+	assert.InDelta(t, 2.6, card.EaseFactor, 1e-9)
+	assert.Equal(t, now.AddDate(0, 0, 1), card.DueTime)
+
+	card.Schedule(4, now)
+	assert.Equal(t, 2, card.Repetitions)
+	assert.Equal(t, 6, card.IntervalDay)
+	assert.InDelta(t, 2.6, card.EaseFactor, 1e-9)
+
+	card.Schedule(3, now)
+	assert.Equal(t, 3, card.Repetitions)
+	assert.Equal(t, 16, card.IntervalDay)
+	assert.InDelta(t, 2.46, card.EaseFactor, 1e-9)
+
+	card.Schedule(1, now)
+	assert.Equal(t, 0, card.Repetitions)
+	assert.Equal(t, 1, card.IntervalDay)
+	assert.Equal(t, 1, card.Stats.Lapses)
+	assert.Equal(t, 4, card.Stats.Reviews)
+	assert.Equal(t, 1, card.Stats.LastGrade)
+	assert.InDelta(t, 13.0/4, card.Stats.AverageGrade(), 1e-9)
+}
+
+func TestScheduleEaseFactorFloor(t *testing.T) {
+	now := time.Now()
+	card := &Card{EaseFactor: DefaultEaseFactor}
+	for i := 0; i < 10; i++ {
+		card.Schedule(0, now)
+	}
+	assert.Equal(t, MinEaseFactor, card.EaseFactor)
+	assert.Equal(t, 10, card.Stats.Lapses)
+}
@@ -0,0 +1,231 @@
+package review
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/collection"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	_DefaultDueLimit = 50
+	_MaxDueLimit     = 200
+)
+
+type Service struct {
+	logger         *zap.Logger
+	repo           Repo
+	asteroidRepo   asteroid.Repo
+	collectionRepo collection.Repo
+}
+
+type Repo interface {
+	Create(ctx context.Context, card *Card) error
+	Update(ctx context.Context, card *Card) error
+	Delete(ctx context.Context, cardID primitive.ObjectID) error
+	GetByAsteroidID(ctx context.Context, astID primitive.ObjectID) (*Card, error)
+	ListDue(ctx context.Context, ownerID primitive.ObjectID, before time.Time, filter *DueFilter) ([]*Card, error)
+}
+
+// DueFilter narrows the due queue. AsteroidIDs is resolved by the service from
+// a hub or a collection, nil means no restriction.
+type DueFilter struct {
+	AsteroidIDs []primitive.ObjectID
+	Tag         string
+	Limit       int
+}
+
+// DueQuery is what the client asks for, at most one of HubID and CollectionID
+// is expected to be set.
+type DueQuery struct {
+	HubID        *primitive.ObjectID
+	CollectionID *primitive.ObjectID
+	Tag          string
+	Limit        int
+}
+
+func NewService(logger *zap.Logger, repo Repo, asteroidRepo asteroid.Repo, collectionRepo collection.Repo) *Service {
+	return &Service{
+		logger:         logger,
+		repo:           repo,
+		asteroidRepo:   asteroidRepo,
+		collectionRepo: collectionRepo,
+	}
+}
+
+func (s *Service) Enroll(ctx context.Context, astID primitive.ObjectID, tags []string) (*Card, error) {
+	accID := auth.FromContext(ctx).ID
+	if _, err := s.getOwnedAsteroid(ctx, accID, astID); err != nil {
+		return nil, err
+	}
+	_, err := s.repo.GetByAsteroidID(ctx, astID)
+	if err == nil {
+		return nil, bizerr.New().StatusCode(http.StatusConflict).Msg("该节点已加入复习").WrapSelf()
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.WithStack(err)
+	}
+
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	now := time.Now()
+	card := &Card{
+		ID:          primitive.NewObjectID(),
+		State:       true,
+		CreatedTime: now,
+		UpdatedTime: now,
+		OwnerID:     accID,
+		AsteroidID:  astID,
+		Tags:        tags,
+		EaseFactor:  DefaultEaseFactor,
+		DueTime:     now,
+	}
+	if err := s.repo.Create(ctx, card); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return card, nil
+}
+
+func (s *Service) Unenroll(ctx context.Context, astID primitive.ObjectID) error {
+	card, err := s.getOwnedCard(ctx, auth.FromContext(ctx).ID, astID)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(s.repo.Delete(ctx, card.ID))
+}
+
+func (s *Service) Get(ctx context.Context, astID primitive.ObjectID) (*Card, error) {
+	return s.getOwnedCard(ctx, auth.FromContext(ctx).ID, astID)
+}
+
+func (s *Service) Grade(ctx context.Context, astID primitive.ObjectID, grade int) (*Card, error) {
+	if grade < MinGrade || grade > MaxGrade {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("评分必须在 0 到 5 之间").WrapSelf()
+	}
+	card, err := s.getOwnedCard(ctx, auth.FromContext(ctx).ID, astID)
+	if err != nil {
+		return nil, err
+	}
+	card.Schedule(grade, time.Now())
+	if err := s.repo.Update(ctx, card); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return card, nil
+}
+
+// Due returns the cards that are due before the end of today, most overdue first.
+func (s *Service) Due(ctx context.Context, query *DueQuery) ([]*Item, error) {
+	accID := auth.FromContext(ctx).ID
+
+	filter := &DueFilter{Tag: query.Tag, Limit: query.Limit}
+	if filter.Limit <= 0 {
+		filter.Limit = _DefaultDueLimit
+	}
+	if filter.Limit > _MaxDueLimit {
+		filter.Limit = _MaxDueLimit
+	}
+
+	switch {
+	case query.HubID != nil:
+		hub, err := s.getOwnedAsteroid(ctx, accID, *query.HubID)
+		if err != nil {
+			return nil, err
+		}
+		if !hub.Hub {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("指定的节点不是枢纽").WrapSelf()
+		}
+		members, err := s.asteroidRepo.ListLinkedTo(ctx, hub.ID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		filter.AsteroidIDs = make([]primitive.ObjectID, 0, len(members))
+		for _, member := range members {
+			filter.AsteroidIDs = append(filter.AsteroidIDs, member.ID)
+		}
+	case query.CollectionID != nil:
+		col, err := s.collectionRepo.Get(ctx, *query.CollectionID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("收藏夹不存在").WrapSelf()
+			}
+			return nil, errors.WithStack(err)
+		}
+		if col.OwnerID != accID {
+			return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权访问不属于你的收藏夹").WrapSelf()
+		}
+		filter.AsteroidIDs = col.Items
+	}
+	if filter.AsteroidIDs != nil && len(filter.AsteroidIDs) == 0 {
+		return []*Item{}, nil
+	}
+
+	now := time.Now()
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	cards, err := s.repo.ListDue(ctx, accID, endOfToday, filter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(cards) == 0 {
+		return []*Item{}, nil
+	}
+
+	astIDs := make([]primitive.ObjectID, 0, len(cards))
+	for _, card := range cards {
+		astIDs = append(astIDs, card.AsteroidID)
+	}
+	asts, err := s.asteroidRepo.List(ctx, astIDs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	astMap := make(map[primitive.ObjectID]*asteroid.Asteroid, len(asts))
+	for _, ast := range asts {
+		astMap[ast.ID] = ast
+	}
+
+	items := make([]*Item, 0, len(cards))
+	for _, card := range cards {
+		ast, ok := astMap[card.AsteroidID]
+		if !ok || !ast.State {
+			continue
+		}
+		items = append(items, &Item{Card: card, Asteroid: ast})
+	}
+	return items, nil
+}
+
+func (s *Service) getOwnedAsteroid(ctx context.Context, accID, astID primitive.ObjectID) (*asteroid.Asteroid, error) {
+	ast, err := s.asteroidRepo.Get(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要复习的节点不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if ast.AuthorID != accID {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权复习不属于你的节点").WrapSelf()
+	}
+	return ast, nil
+}
+
+func (s *Service) getOwnedCard(ctx context.Context, accID, astID primitive.ObjectID) (*Card, error) {
+	card, err := s.repo.GetByAsteroidID(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("该节点未加入复习").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if card.OwnerID != accID {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权复习不属于你的节点").WrapSelf()
+	}
+	return card, nil
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Completion is an asteroid whose title completes a prefix.
+type Completion struct {
+	ID          primitive.ObjectID
+	Title       string
+	Hub         bool
+	UpdatedTime time.Time
+}
+
+const (
+	DefaultCompletionLimit = 8
+	MaxCompletionLimit     = 20
+	// MaxPrefixLength is how many runes of a prefix are looked up, longer
+	// prefixes only narrow what those find.
+	MaxPrefixLength = 32
+)
+
+// NormalizePrefix joins the words of the prefix by single spaces.
+func NormalizePrefix(prefix string) string {
+	return strings.Join(words(prefix), " ")
+}
+
+// WordSuffixes returns the words of the title from each of its words on,
+// joined by single spaces. A title completes a normalized prefix when one of
+// them starts with it.
+func WordSuffixes(title string) []string {
+	ws := words(title)
+	suffixes := make([]string, 0, len(ws))
+	for i := range ws {
+		suffixes = append(suffixes, strings.Join(ws[i:], " "))
+	}
+	return suffixes
+}
+
+// words splits the text into its lowercased runs of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Completes reports whether the title completes the normalized prefix.
+func Completes(title, prefix string) bool {
+	for _, s := range WordSuffixes(title) {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SortCompletions puts hubs first, then the latest updated.
+func SortCompletions(cs []*Completion) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].Hub != cs[j].Hub {
+			return cs[i].Hub
+		}
+		return cs[i].UpdatedTime.After(cs[j].UpdatedTime)
+	})
+}
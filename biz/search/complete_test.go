@@ -0,0 +1,48 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordSuffixes(t *testing.T) {
+	assert.Equal(t, []string{"learning go channels", "go channels", "channels"}, WordSuffixes("Learning  Go-channels!"))
+	// a run of CJK characters is a single word.
+	assert.Equal(t, []string{"学习图数据库 v2", "v2"}, WordSuffixes("学习图数据库 v2"))
+	assert.Empty(t, WordSuffixes("  --  "))
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	assert.Equal(t, "go lang", NormalizePrefix(" Go-Lang "))
+	assert.Equal(t, "", NormalizePrefix(" -- "))
+}
+
+func TestCompletes(t *testing.T) {
+	assert.True(t, Completes("Learning Go channels", "go cha"))
+	assert.True(t, Completes("Learning Go channels", NormalizePrefix(" LEARN ")))
+	// only words count, whatever separates them.
+	assert.True(t, Completes("Learning Go channels", NormalizePrefix("go-cha")))
+	assert.True(t, Completes("Learning go-channels", NormalizePrefix("go cha")))
+	// the words of the prefix follow each other in the title.
+	assert.False(t, Completes("Concurrency in Go", NormalizePrefix("go con")))
+	assert.False(t, Completes("Learning Go channels", NormalizePrefix("learning channels")))
+	assert.False(t, Completes("Learning Go channels", "hannels"))
+	assert.False(t, Completes("学习图数据库", "数据"))
+}
+
+func TestSortCompletions(t *testing.T) {
+	now := time.Now()
+	cs := []*Completion{
+		{Title: "old", UpdatedTime: now.Add(-time.Hour)},
+		{Title: "hub", Hub: true, UpdatedTime: now.Add(-2 * time.Hour)},
+		{Title: "new", UpdatedTime: now},
+	}
+	SortCompletions(cs)
+	titles := make([]string, 0, len(cs))
+	for _, c := range cs {
+		titles = append(titles, c.Title)
+	}
+	assert.Equal(t, []string{"hub", "new", "old"}, titles)
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	PreTag  = "<em>"
+	PostTag = "</em>"
+)
+
+// Highlight wraps the occurrences of the terms in text with PreTag and PostTag,
+// ignoring case, like the highlighter of Elasticsearch does. It keeps a
+// fragment of at most fragmentSize runes starting a little before the first
+// occurrence, or the first noMatchSize runes when none of the terms occurs.
+func Highlight(text string, terms []string, fragmentSize, noMatchSize int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != string(t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+	if first == -1 {
+		if len(runes) > noMatchSize {
+			runes = runes[:noMatchSize]
+		}
+		return string(runes)
+	}
+
+	// a quarter of the fragment leads up to the first occurrence.
+	start := first - fragmentSize/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + fragmentSize
+	if end > len(runes) {
+		end = len(runes)
+	}
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString(PreTag)
+		}
+		b.WriteRune(runes[i])
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString(PostTag)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,23 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	s := Highlight("Learning Go channels", []string{"go", "channels"}, 100, 50)
+	assert.Equal(t, "Learning <em>Go</em> <em>channels</em>", s)
+
+	// overlapping bigrams end up in a single tag.
+	s = Highlight("学习图数据库", []string{"数据", "据库"}, 100, 50)
+	assert.Equal(t, "学习图<em>数据库</em>", s)
+
+	s = Highlight(strings.Repeat("a", 30)+"go"+strings.Repeat("b", 30), []string{"go"}, 20, 50)
+	assert.Equal(t, strings.Repeat("a", 5)+"<em>go</em>"+strings.Repeat("b", 13), s)
+
+	s = Highlight("nothing to see", []string{"go"}, 100, 7)
+	assert.Equal(t, "nothing", s)
+}
@@ -0,0 +1,133 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ProjectOort/oort-server/biz/collection"
+)
+
+// MaxMultiResultWindow bounds how deep a search of several types can be paged,
+// as every type is asked for all the items up to the end of the page.
+const MaxMultiResultWindow = 200
+
+// MultiQuery searches several entity types of an account at once. The items
+// of every type are interleaved by relevance.
+type MultiQuery struct {
+	Text string
+	Page int
+	Size int
+	// Types are the names of the entity types to search, all of them when empty.
+	Types []string
+}
+
+// TypeCount is how many items of an entity type were found.
+type TypeCount struct {
+	Type  int
+	Name  string
+	Total int64
+}
+
+// MultiResult is a page of the items found, out of Total, with the counts of
+// every entity type searched.
+type MultiResult struct {
+	Items  []*Item
+	Total  int64
+	Counts []*TypeCount
+}
+
+// Interleave merges the items of every type, best scores first. Types score
+// on scales of their own, so the scores of each are divided by its top score
+// first, which the items keep. Ties keep the order of the types, then that of
+// the items within them.
+func Interleave(items ...[]*Item) []*Item {
+	merged := make([]*Item, 0)
+	for _, its := range items {
+		top := 0.0
+		for _, item := range its {
+			if item.Score > top {
+				top = item.Score
+			}
+		}
+		for _, item := range its {
+			if top > 0 {
+				item.Score /= top
+			}
+		}
+		merged = append(merged, its...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	return merged
+}
+
+// SearchCollections searches the collections in memory, an account holding
+// few of them. The score of a collection is how many of the words of the text
+// its name or description holds, ignoring case. The asteroid filters, Hub and
+// Type, do not apply.
+func SearchCollections(cols []*collection.Collection, q *Query) *Result {
+	words := strings.Fields(strings.ToLower(q.Text))
+	type scored struct {
+		col   *collection.Collection
+		score int
+	}
+	found := make([]scored, 0)
+	for _, col := range cols {
+		if !col.State || !q.Created.Contains(col.CreatedTime) || !q.Updated.Contains(col.UpdatedTime) {
+			continue
+		}
+		name, desc := strings.ToLower(col.Name), strings.ToLower(col.Description)
+		score := 0
+		for _, w := range words {
+			if strings.Contains(name, w) || strings.Contains(desc, w) {
+				score++
+			}
+		}
+		// without text, every collection matches with a zero score.
+		if len(words) != 0 && score == 0 {
+			continue
+		}
+		found = append(found, scored{col, score})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		ci, cj := found[i].col, found[j].col
+		switch q.SortBy {
+		case SortByCreatedTime:
+			if !ci.CreatedTime.Equal(cj.CreatedTime) {
+				return ci.CreatedTime.Before(cj.CreatedTime) != q.Desc
+			}
+		case SortByUpdatedTime:
+			if !ci.UpdatedTime.Equal(cj.UpdatedTime) {
+				return ci.UpdatedTime.Before(cj.UpdatedTime) != q.Desc
+			}
+		default:
+			if found[i].score != found[j].score {
+				return found[i].score > found[j].score
+			}
+			return ci.UpdatedTime.After(cj.UpdatedTime)
+		}
+		return ci.ID.Hex() < cj.ID.Hex()
+	})
+
+	res := &Result{Items: make([]*Item, 0), Total: int64(len(found))}
+	skip := q.Skip()
+	if skip > len(found) {
+		skip = len(found)
+	}
+	found = found[skip:]
+	if len(found) > q.Size {
+		found = found[:q.Size]
+	}
+	for _, f := range found {
+		res.Items = append(res.Items, &Item{
+			Type:     TypeCollection,
+			TargetID: f.col.ID.Hex(),
+			Title:    Highlight(f.col.Name, words, 100, 50),
+			Content:  []string{Highlight(f.col.Description, words, 100, 50)},
+			Score:    float64(f.score),
+		})
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/collection"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInterleave(t *testing.T) {
+	// the scores of each type are taken relative to its best one.
+	items := Interleave(
+		[]*Item{{TargetID: "a1", Score: 12.5}, {TargetID: "a2", Score: 2.5}},
+		[]*Item{{TargetID: "c1", Score: 2}, {TargetID: "c2", Score: 1}, {TargetID: "c3", Score: 0}},
+	)
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.TargetID)
+	}
+	assert.Equal(t, []string{"a1", "c1", "c2", "a2", "c3"}, ids)
+	assert.Equal(t, 0.2, items[3].Score)
+}
+
+func TestSearchCollections(t *testing.T) {
+	now := time.Now()
+	cols := []*collection.Collection{
+		{ID: primitive.NewObjectID(), State: true, Name: "Go notes", Description: "channels and goroutines", UpdatedTime: now},
+		{ID: primitive.NewObjectID(), State: true, Name: "Reading list", Description: "books about Go", UpdatedTime: now.Add(-time.Hour)},
+		{ID: primitive.NewObjectID(), State: false, Name: "Go drafts"},
+		{ID: primitive.NewObjectID(), State: true, Name: "图数据库", Description: "学习笔记"},
+	}
+
+	q := &Query{Text: "go channels"}
+	_ = q.Normalize()
+	res := SearchCollections(cols, q)
+	if assert.Len(t, res.Items, 2) {
+		assert.Equal(t, int64(2), res.Total)
+		assert.Equal(t, cols[0].ID.Hex(), res.Items[0].TargetID)
+		assert.Equal(t, 2.0, res.Items[0].Score)
+		assert.Equal(t, "<em>Go</em> notes", res.Items[0].Title)
+		assert.Equal(t, TypeCollection, res.Items[1].Type)
+	}
+
+	q = &Query{Text: "数据"}
+	_ = q.Normalize()
+	res = SearchCollections(cols, q)
+	if assert.Len(t, res.Items, 1) {
+		assert.Equal(t, cols[3].ID.Hex(), res.Items[0].TargetID)
+	}
+
+	q = &Query{Size: 1, Page: 2}
+	_ = q.Normalize()
+	res = SearchCollections(cols, q)
+	assert.Equal(t, int64(3), res.Total)
+	assert.Len(t, res.Items, 1)
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	none := func(context.Context, *Query, primitive.ObjectID) (*Result, error) { return &Result{}, nil }
+	r.Register(TypeAsteroid, "asteroid", none)
+	r.Register(TypeCollection, "collection", none)
+
+	types, err := r.Resolve(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{TypeAsteroid, TypeCollection}, types)
+
+	types, err = r.Resolve([]string{"collection", "asteroid", "collection"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{TypeAsteroid, TypeCollection}, types)
+
+	_, err = r.Resolve([]string{"comment"})
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { r.Register(TypeCollection, "again", none) })
+}
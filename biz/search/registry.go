@@ -0,0 +1,78 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The types of the entities searched, as Item.Type.
+const (
+	TypeAsteroid = iota
+	TypeCollection
+)
+
+// Searcher searches one type of entity of an account. It is given a normalized
+// query, but for its size, which can reach MaxResultWindow.
+type Searcher func(ctx context.Context, q *Query, accID primitive.ObjectID) (*Result, error)
+
+// Registry keeps the searchers of every entity type, in the order they were
+// registered.
+type Registry struct {
+	types     []int
+	names     map[int]string
+	byName    map[string]int
+	searchers map[int]Searcher
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names:     make(map[int]string),
+		byName:    make(map[string]int),
+		searchers: make(map[int]Searcher),
+	}
+}
+
+// Register adds the searcher of an entity type, known to clients by name.
+func (r *Registry) Register(typ int, name string, searcher Searcher) {
+	if _, ok := r.searchers[typ]; ok {
+		panic(fmt.Sprintf("search type %d registered twice", typ))
+	}
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("search type %q registered twice", name))
+	}
+	r.types = append(r.types, typ)
+	r.names[typ] = name
+	r.byName[name] = typ
+	r.searchers[typ] = searcher
+}
+
+func (r *Registry) Name(typ int) string {
+	return r.names[typ]
+}
+
+// Resolve turns the names of entity types into types, in the order they were
+// registered. No names at all stand for every type.
+func (r *Registry) Resolve(names []string) ([]int, error) {
+	if len(names) == 0 {
+		return r.types, nil
+	}
+	wanted := make(map[int]bool, len(names))
+	for _, name := range names {
+		typ, ok := r.byName[name]
+		if !ok {
+			return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的搜索类型").WrapSelf()
+		}
+		wanted[typ] = true
+	}
+	types := make([]int, 0, len(wanted))
+	for _, typ := range r.types {
+		if wanted[typ] {
+			types = append(types, typ)
+		}
+	}
+	return types, nil
+}
@@ -1,8 +1,102 @@
 package search
 
+import (
+	"net/http"
+	"time"
+
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+)
+
 type Item struct {
 	Type     int
 	TargetID string
 	Title    string
 	Content  []string
+	// Score is the relevance of the item to the text, higher first.
+	Score float64
+}
+
+type SortField string
+
+const (
+	SortByRelevance   SortField = "relevance"
+	SortByCreatedTime SortField = "created_time"
+	SortByUpdatedTime SortField = "updated_time"
+)
+
+func (x SortField) Valid() bool {
+	switch x {
+	case SortByRelevance, SortByCreatedTime, SortByUpdatedTime:
+		return true
+	}
+	return false
+}
+
+// TimeRange keeps the times within From and To, both included. Either can be
+// zero to leave that side open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t is within the range.
+func (r TimeRange) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || !t.After(r.To))
+}
+
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 50
+	// MaxResultWindow bounds how deep results can be paged, like the
+	// index.max_result_window of Elasticsearch.
+	MaxResultWindow = 10000
+)
+
+// Query searches the asteroids of an account. Hub, Type and the time ranges
+// narrow the results without changing their scores.
+type Query struct {
+	Text string
+	Page int
+	Size int
+	// SortBy is relevance by default, which always puts the best scores first.
+	SortBy SortField
+	Desc   bool
+
+	Hub     *bool
+	Type    *int
+	Created TimeRange
+	Updated TimeRange
+}
+
+// Normalize fills the defaults of the query and validates it.
+func (q *Query) Normalize() error {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.Size <= 0 {
+		q.Size = DefaultPageSize
+	}
+	if q.Size > MaxPageSize {
+		q.Size = MaxPageSize
+	}
+	if q.Page*q.Size > MaxResultWindow {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("只能查看前 10000 条搜索结果").WrapSelf()
+	}
+	if q.SortBy == "" {
+		q.SortBy = SortByRelevance
+	}
+	if !q.SortBy.Valid() {
+		return bizerr.New().StatusCode(http.StatusBadRequest).Msg("不支持的排序字段").WrapSelf()
+	}
+	return nil
+}
+
+func (q *Query) Skip() int {
+	return (q.Page - 1) * q.Size
+}
+
+// Result is a page of the items found, out of Total.
+type Result struct {
+	Items []*Item
+	Total int64
 }
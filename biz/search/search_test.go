@@ -0,0 +1,38 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryNormalize(t *testing.T) {
+	q := &Query{Text: "go"}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, 1, q.Page)
+		assert.Equal(t, DefaultPageSize, q.Size)
+		assert.Equal(t, SortByRelevance, q.SortBy)
+		assert.Equal(t, 0, q.Skip())
+	}
+
+	q = &Query{Page: 3, Size: 100}
+	if assert.NoError(t, q.Normalize()) {
+		assert.Equal(t, MaxPageSize, q.Size)
+		assert.Equal(t, 2*MaxPageSize, q.Skip())
+	}
+
+	assert.Error(t, (&Query{Page: MaxResultWindow/MaxPageSize + 1, Size: MaxPageSize}).Normalize())
+	assert.Error(t, (&Query{SortBy: "view_count"}).Normalize())
+}
+
+func TestTimeRangeContains(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2022, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	assert.True(t, TimeRange{}.Contains(day(1)))
+	assert.True(t, TimeRange{From: day(2), To: day(4)}.Contains(day(2)))
+	assert.True(t, TimeRange{From: day(2), To: day(4)}.Contains(day(4)))
+	assert.False(t, TimeRange{From: day(2), To: day(4)}.Contains(day(5)))
+	assert.False(t, TimeRange{From: day(2)}.Contains(day(1)))
+	assert.True(t, TimeRange{To: day(2)}.Contains(day(1)))
+}
@@ -3,28 +3,130 @@ package search
 import (
 	"context"
 	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/collection"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
+	"net/http"
 )
 
 type Service struct {
-	logger *zap.Logger
-	repo   Repo
+	logger         *zap.Logger
+	repo           Repo
+	collectionRepo collection.Repo
+	registry       *Registry
 }
 
 type Repo interface {
-	SearchAsteroid(ctx context.Context, text string, authorID primitive.ObjectID) ([]*Item, error)
+	// SearchAsteroid returns a page of the author's living asteroids matching
+	// the query, and counts all of them.
+	SearchAsteroid(ctx context.Context, q *Query, authorID primitive.ObjectID) (*Result, error)
+	// CompleteTitle returns at most limit living asteroids of the author whose
+	// titles complete the normalized prefix, ordered by SortCompletions.
+	//
+	// A title completes a prefix when the words of the prefix start the title
+	// from one of its words on, the last of them possibly cut short. Words are
+	// the runs of letters and digits, lowercased, whatever separates them, so
+	// "go-la" completes "Learning Go lang", while "go con" does not complete
+	// "Concurrency in Go". That is Completes.
+	CompleteTitle(ctx context.Context, prefix string, authorID primitive.ObjectID, limit int) ([]*Completion, error)
 }
 
-func NewService(logger *zap.Logger, repo Repo) *Service {
-	return &Service{
-		logger: logger,
-		repo:   repo,
+func NewService(logger *zap.Logger, repo Repo, collectionRepo collection.Repo) *Service {
+	s := &Service{
+		logger:         logger,
+		repo:           repo,
+		collectionRepo: collectionRepo,
+		registry:       NewRegistry(),
 	}
+	s.Register(TypeAsteroid, "asteroid", repo.SearchAsteroid)
+	s.Register(TypeCollection, "collection", s.searchCollection)
+	return s
 }
 
-func (s *Service) Asteroid(ctx context.Context, text string) ([]*Item, error) {
-	items, err := s.repo.SearchAsteroid(ctx, text, auth.FromContext(ctx).ID)
-	return items, errors.WithStack(err)
+// Register makes another entity type searchable by Search.
+func (s *Service) Register(typ int, name string, searcher Searcher) {
+	s.registry.Register(typ, name, searcher)
+}
+
+func (s *Service) Asteroid(ctx context.Context, q *Query) (*Result, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	result, err := s.repo.SearchAsteroid(ctx, q, auth.FromContext(ctx).ID)
+	return result, errors.WithStack(err)
+}
+
+// CompleteTitle completes the prefix with the titles of the current account's
+// asteroids, for picking the one to link to.
+func (s *Service) CompleteTitle(ctx context.Context, prefix string, limit int) ([]*Completion, error) {
+	prefix = NormalizePrefix(prefix)
+	if prefix == "" {
+		return make([]*Completion, 0), nil
+	}
+	if limit <= 0 {
+		limit = DefaultCompletionLimit
+	}
+	if limit > MaxCompletionLimit {
+		limit = MaxCompletionLimit
+	}
+	completions, err := s.repo.CompleteTitle(ctx, prefix, auth.FromContext(ctx).ID, limit)
+	return completions, errors.WithStack(err)
+}
+
+func (s *Service) searchCollection(ctx context.Context, q *Query, accID primitive.ObjectID) (*Result, error) {
+	cols, err := s.collectionRepo.List(ctx, accID)
+	if err != nil {
+		return nil, err
+	}
+	return SearchCollections(cols, q), nil
+}
+
+// Search searches the entity types of the query, every one of them by
+// default, and interleaves what they found by relevance.
+func (s *Service) Search(ctx context.Context, mq *MultiQuery) (*MultiResult, error) {
+	q := &Query{Text: mq.Text, Page: mq.Page, Size: mq.Size}
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	if q.Page*q.Size > MaxMultiResultWindow {
+		return nil, bizerr.New().StatusCode(http.StatusBadRequest).Msg("同时搜索多种类型时只能查看前 200 条结果").WrapSelf()
+	}
+	types, err := s.registry.Resolve(mq.Types)
+	if err != nil {
+		return nil, err
+	}
+
+	// every type gives its best items up to the end of the page, as any of
+	// them may end up on it.
+	accID := auth.FromContext(ctx).ID
+	window := *q
+	window.Page, window.Size = 1, q.Page*q.Size
+	res := &MultiResult{Counts: make([]*TypeCount, 0, len(types))}
+	found := make([][]*Item, 0, len(types))
+	for _, typ := range types {
+		r, err := s.registry.searchers[typ](ctx, &window, accID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, item := range r.Items {
+			item.Type = typ
+		}
+		found = append(found, r.Items)
+		res.Total += r.Total
+		res.Counts = append(res.Counts, &TypeCount{Type: typ, Name: s.registry.Name(typ), Total: r.Total})
+	}
+
+	items := Interleave(found...)
+	skip := q.Skip()
+	if skip > len(items) {
+		skip = len(items)
+	}
+	items = items[skip:]
+	if len(items) > q.Size {
+		items = items[:q.Size]
+	}
+	res.Items = items
+	return res, nil
 }
@@ -0,0 +1,84 @@
+package suggest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ProjectOort/oort-server/api/middleware/auth"
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	bizerr "github.com/ProjectOort/oort-server/biz/errors"
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type Service struct {
+	logger       *zap.Logger
+	asteroidRepo asteroid.Repo
+	graphRepo    graph.Repo
+}
+
+func NewService(logger *zap.Logger, asteroidRepo asteroid.Repo, graphRepo graph.Repo) *Service {
+	return &Service{
+		logger:       logger,
+		asteroidRepo: asteroidRepo,
+		graphRepo:    graphRepo,
+	}
+}
+
+// Links suggests the asteroids of the current account the given asteroid
+// should link to, best first.
+func (s *Service) Links(ctx context.Context, astID primitive.ObjectID, limit int) ([]*Suggestion, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	accID := auth.FromContext(ctx).ID
+	source, err := s.asteroidRepo.Get(ctx, astID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, bizerr.New().StatusCode(http.StatusNotFound).Msg("你要查看的节点不存在").WrapSelf()
+		}
+		return nil, errors.WithStack(err)
+	}
+	if !asteroid.CanView(accID, source) {
+		return nil, bizerr.New().StatusCode(http.StatusForbidden).Msg("你无权查看不属于你的节点").WrapSelf()
+	}
+
+	corpus, err := s.asteroidRepo.ListByAuthor(ctx, accID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gph, err := s.graphRepo.GetFullGraph(ctx, accID, time.Time{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return Rank(source, corpus, neighborsOf(gph), limit), nil
+}
+
+// neighborsOf lists the distinct neighbors of every node, ignoring the directions.
+func neighborsOf(g *graph.Graph) map[string][]string {
+	seen := make(map[[2]string]struct{}, 2*len(g.Links))
+	neighbors := make(map[string][]string)
+	add := func(a, b string) {
+		if _, ok := seen[[2]string{a, b}]; ok {
+			return
+		}
+		seen[[2]string{a, b}] = struct{}{}
+		neighbors[a] = append(neighbors[a], b)
+	}
+	for _, link := range g.Links {
+		if link.Source == link.Target {
+			continue
+		}
+		add(link.Source, link.Target)
+		add(link.Target, link.Source)
+	}
+	return neighbors
+}
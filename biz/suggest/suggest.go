@@ -0,0 +1,206 @@
+package suggest
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 50
+)
+
+// weights of each signal in the final score, they add up to 1.
+const (
+	_SimilarityWeight = 0.5
+	_MentionWeight    = 0.3
+	_ProximityWeight  = 0.2
+)
+
+// BM25 parameters.
+const (
+	_K1 = 1.2
+	_B  = 0.75
+)
+
+// Suggestion is an asteroid worth linking to, every signal is within [0, 1].
+type Suggestion struct {
+	Asteroid *asteroid.Asteroid
+	Score    float64
+	// Similarity is the BM25 score of the candidate against the source content,
+	// relative to the best candidate.
+	Similarity float64
+	// Mention is 1 when the source mentions the candidate title, and 0.5 when
+	// the candidate mentions the source title.
+	Mention float64
+	// Proximity is the cosine similarity of the neighborhoods of both asteroids.
+	Proximity       float64
+	SharedNeighbors int
+}
+
+// Tokenize splits text into lowercase terms. Latin words and numbers are terms
+// on their own, runs of Han characters are split into overlapping bigrams.
+func Tokenize(text string) []string {
+	terms := make([]string, 0)
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 1 {
+			terms = append(terms, string(word))
+		}
+		word = word[:0]
+	}
+	flushHan := func() {
+		if len(han) == 1 {
+			terms = append(terms, string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			terms = append(terms, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return terms
+}
+
+type document struct {
+	ast   *asteroid.Asteroid
+	terms map[string]int
+	size  int
+}
+
+func newDocument(ast *asteroid.Asteroid) *document {
+	tokens := Tokenize(ast.Title + "\n" + ast.Content)
+	doc := &document{ast: ast, terms: make(map[string]int), size: len(tokens)}
+	for _, token := range tokens {
+		doc.terms[token]++
+	}
+	return doc
+}
+
+// mentions reports whether the content mentions the title, titles shorter
+// than two characters are too ambiguous to count.
+func mentions(content, title string) bool {
+	title = strings.TrimSpace(title)
+	if len([]rune(title)) < 2 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(content), strings.ToLower(title))
+}
+
+// Rank ranks the asteroids of corpus as link candidates for source. The corpus
+// is every asteroid of the account, and neighbors holds the linked asteroids of
+// each of them whatever the direction. The source itself and the asteroids it
+// is already linked to are never suggested.
+func Rank(source *asteroid.Asteroid, corpus []*asteroid.Asteroid, neighbors map[string][]string, limit int) []*Suggestion {
+	sourceID := source.ID.Hex()
+	excluded := map[string]struct{}{sourceID: {}}
+	for _, id := range neighbors[sourceID] {
+		excluded[id] = struct{}{}
+	}
+
+	docs := make([]*document, 0, len(corpus))
+	df := make(map[string]int)
+	totalSize := 0
+	for _, ast := range corpus {
+		doc := newDocument(ast)
+		docs = append(docs, doc)
+		for term := range doc.terms {
+			df[term]++
+		}
+		totalSize += doc.size
+	}
+	if len(docs) == 0 {
+		return []*Suggestion{}
+	}
+	avgSize := float64(totalSize) / float64(len(docs))
+	if avgSize == 0 {
+		avgSize = 1
+	}
+	query := newDocument(source)
+
+	sourceNeighbors := make(map[string]struct{}, len(neighbors[sourceID]))
+	for _, id := range neighbors[sourceID] {
+		sourceNeighbors[id] = struct{}{}
+	}
+
+	suggestions := make([]*Suggestion, 0)
+	maxBM25 := 0.0
+	bm25s := make([]float64, 0)
+	for _, doc := range docs {
+		id := doc.ast.ID.Hex()
+		if _, ok := excluded[id]; ok {
+			continue
+		}
+
+		bm25 := 0.0
+		for term := range query.terms {
+			tf := float64(doc.terms[term])
+			if tf == 0 {
+				continue
+			}
+			n := float64(df[term])
+			idf := math.Log(1 + (float64(len(docs))-n+0.5)/(n+0.5))
+			bm25 += idf * tf * (_K1 + 1) / (tf + _K1*(1-_B+_B*float64(doc.size)/avgSize))
+		}
+		if bm25 > maxBM25 {
+			maxBM25 = bm25
+		}
+
+		s := &Suggestion{Asteroid: doc.ast}
+		if mentions(source.Content, doc.ast.Title) {
+			s.Mention = 1
+		} else if mentions(doc.ast.Content, source.Title) {
+			s.Mention = 0.5
+		}
+		for _, nid := range neighbors[id] {
+			if _, ok := sourceNeighbors[nid]; ok {
+				s.SharedNeighbors++
+			}
+		}
+		if s.SharedNeighbors != 0 {
+			s.Proximity = float64(s.SharedNeighbors) / math.Sqrt(float64(len(sourceNeighbors)*len(neighbors[id])))
+		}
+		suggestions = append(suggestions, s)
+		bm25s = append(bm25s, bm25)
+	}
+
+	ranked := make([]*Suggestion, 0, len(suggestions))
+	for i, s := range suggestions {
+		if maxBM25 > 0 {
+			s.Similarity = bm25s[i] / maxBM25
+		}
+		s.Score = _SimilarityWeight*s.Similarity + _MentionWeight*s.Mention + _ProximityWeight*s.Proximity
+		if s.Score > 0 {
+			ranked = append(ranked, s)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Asteroid.ID.Hex() < ranked[j].Asteroid.ID.Hex()
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
@@ -0,0 +1,59 @@
+package suggest
+
+import (
+	"testing"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"graph", "database", "图数", "数据", "据库", "neo4j"}, Tokenize("Graph database: 图数据库 (Neo4j) a"))
+	assert.Equal(t, []string{"图"}, Tokenize("图"))
+	assert.Empty(t, Tokenize("  ,. "))
+}
+
+func newAsteroid(title, content string) *asteroid.Asteroid {
+	return &asteroid.Asteroid{ID: primitive.NewObjectID(), State: true, Title: title, Content: content}
+}
+
+func TestRank(t *testing.T) {
+	source := newAsteroid("Spaced repetition", "Reviewing cards with the SM-2 algorithm, see Forgetting curve.")
+	curve := newAsteroid("Forgetting curve", "Memory decays over time.")
+	sm2 := newAsteroid("SM-2", "The SM-2 algorithm schedules cards by ease factor.")
+	linked := newAsteroid("Anki", "Anki reviews cards with the SM-2 algorithm.")
+	neighbor := newAsteroid("Flashcards", "Paper flashcards.")
+	unrelated := newAsteroid("Cooking", "Pasta and tomatoes.")
+	corpus := []*asteroid.Asteroid{source, curve, sm2, linked, neighbor, unrelated}
+
+	neighbors := map[string][]string{
+		source.ID.Hex():   {linked.ID.Hex()},
+		linked.ID.Hex():   {source.ID.Hex(), neighbor.ID.Hex()},
+		neighbor.ID.Hex(): {linked.ID.Hex()},
+	}
+
+	suggestions := Rank(source, corpus, neighbors, 10)
+	ids := make([]primitive.ObjectID, 0, len(suggestions))
+	for _, s := range suggestions {
+		ids = append(ids, s.Asteroid.ID)
+		assert.True(t, s.Score > 0 && s.Score <= 1)
+	}
+	// already linked, or sharing nothing, are left out.
+	assert.NotContains(t, ids, source.ID)
+	assert.NotContains(t, ids, linked.ID)
+	assert.NotContains(t, ids, unrelated.ID)
+
+	if assert.Len(t, suggestions, 3) {
+		assert.Equal(t, sm2.ID, suggestions[0].Asteroid.ID)
+		assert.Equal(t, 1.0, suggestions[0].Similarity)
+		assert.Equal(t, 1.0, suggestions[0].Mention)
+		assert.Equal(t, curve.ID, suggestions[1].Asteroid.ID)
+		assert.Equal(t, 1.0, suggestions[1].Mention)
+		assert.Equal(t, neighbor.ID, suggestions[2].Asteroid.ID)
+		assert.Equal(t, 1, suggestions[2].SharedNeighbors)
+		assert.Equal(t, 1.0, suggestions[2].Proximity)
+	}
+
+	assert.Len(t, Rank(source, corpus, neighbors, 1), 1)
+}
@@ -5,9 +5,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/ProjectOort/oort-server/api/middleware/gerrors"
+	"github.com/ProjectOort/oort-server/biz/batch"
 	"github.com/ProjectOort/oort-server/biz/collection"
+	"github.com/ProjectOort/oort-server/biz/comment"
 	"github.com/ProjectOort/oort-server/biz/graph"
+	"github.com/ProjectOort/oort-server/biz/query"
+	"github.com/ProjectOort/oort-server/biz/review"
 	"github.com/ProjectOort/oort-server/biz/search"
+	"github.com/ProjectOort/oort-server/biz/suggest"
 	"github.com/go-playground/locales/zh"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
@@ -24,10 +29,15 @@ import (
 
 	account_handlers "github.com/ProjectOort/oort-server/api/handler/account"
 	asteroid_handlers "github.com/ProjectOort/oort-server/api/handler/asteroid"
+	batch_handlers "github.com/ProjectOort/oort-server/api/handler/batch"
 	collection_handlers "github.com/ProjectOort/oort-server/api/handler/collection"
+	comment_handlers "github.com/ProjectOort/oort-server/api/handler/comment"
 	graph_handlers "github.com/ProjectOort/oort-server/api/handler/graph"
 	index_handlers "github.com/ProjectOort/oort-server/api/handler/index"
+	query_handlers "github.com/ProjectOort/oort-server/api/handler/query"
+	review_handlers "github.com/ProjectOort/oort-server/api/handler/review"
 	search_handlers "github.com/ProjectOort/oort-server/api/handler/search"
+	suggest_handlers "github.com/ProjectOort/oort-server/api/handler/suggest"
 	"github.com/ProjectOort/oort-server/api/middleware/auth"
 	"github.com/ProjectOort/oort-server/api/middleware/requestid"
 	"github.com/ProjectOort/oort-server/biz/account"
@@ -47,6 +57,10 @@ import (
 func main() {
 	cfg := conf.Parse("conf/")
 	logger := initLogger(&cfg.Logger)
+	if len(os.Args) > 1 {
+		runCommand(cfg, logger, os.Args[1])
+		return
+	}
 	validate, trans := initValidator()
 	app := initApp(cfg, logger, trans)
 	cleanup := boostrap(app, logger, cfg, validate)
@@ -134,56 +148,212 @@ func initValidator() (*validator.Validate, ut.Translator) {
 }
 
 func boostrap(app *fiber.App, logger *zap.Logger, cfg *conf.App, validate *validator.Validate) func() {
+	repos, cleanup := initRepos(logger, cfg)
+
+	// services
+	accountService := account.NewService(logger, &cfg.Biz.Account, repos.account)
+	asteroidService := asteroid.NewService(logger, &cfg.Biz.Asteroid, repos.asteroid)
+	collectionService := collection.NewService(logger, repos.collection)
+	graphService := graph.NewService(logger, repos.graph, repos.asteroid, repos.collection)
+	graphAnalyticsService := graph.NewAnalyticsService(logger, repos.graph)
+	searchService := search.NewService(logger, repos.search, repos.collection)
+	reviewService := review.NewService(logger, repos.review, repos.asteroid, repos.collection)
+	commentService := comment.NewService(logger, repos.comment, repos.asteroid)
+	batchService := batch.NewService(logger, repos.batch, repos.asteroid, repos.collection)
+	suggestService := suggest.NewService(logger, repos.asteroid, repos.graph)
+	queryService := query.NewService(logger, repos.query)
+
+	app.Use(pprof.New())
+	app.Use(requestid.New())
+	app.Use(cors.New())
+
+	// routes
+	api := app.Group("/api/")
+	index_handlers.RegisterHandlers(api, cfg)
+	account_handlers.RegisterHandlers(api, logger, validate, accountService)
+
+	api.Use(auth.New(logger, accountService))
+	asteroid_handlers.RegisterHandlers(api, logger, validate, asteroidService)
+	graph_handlers.RegisterHandlers(api, logger, validate, graphService, graphAnalyticsService)
+	collection_handlers.RegisterHandlers(api, logger, validate, collectionService)
+	search_handlers.RegisterHandlers(api, logger, validate, searchService)
+	review_handlers.RegisterHandlers(api, logger, validate, reviewService)
+	comment_handlers.RegisterHandlers(api, logger, validate, commentService)
+	batch_handlers.RegisterHandlers(api, logger, validate, batchService)
+	suggest_handlers.RegisterHandlers(api, logger, validate, suggestService)
+	query_handlers.RegisterHandlers(api, logger, validate, queryService)
+
+	return cleanup
+}
+
+// repositories are the stores behind the services.
+type repositories struct {
+	account    account.Repo
+	asteroid   asteroid.Repo
+	collection collection.Repo
+	graph      graph.Repo
+	search     search.Repo
+	review     review.Repo
+	comment    comment.Repo
+	batch      batch.Repo
+	query      query.Repo
+}
+
+// initRepos builds the repositories of the storage mode in use, and returns
+// them along with the function closing their stores.
+func initRepos(logger *zap.Logger, cfg *conf.App) (*repositories, func()) {
+	switch cfg.Repo.Mode {
+	case "":
+		// Mongo, Neo4j and Elasticsearch, connected below.
+	case conf.ModeEmbedded:
+		return initEmbeddedRepos(logger, cfg)
+	default:
+		panic(fmt.Sprintf("unknown storage mode %q", cfg.Repo.Mode))
+	}
+
 	// clients
+	mongoClient, mongoDatabase := initMongo(cfg)
+	go testMongoConnection(logger, mongoClient)
+	panicIfFailed(repo.EnsureStarIndexes(context.Background(), mongoDatabase))
+
+	var neo4jDriver neo4j.Driver
+	if cfg.Repo.Graph != conf.GraphMongo {
+		neo4jDriver = initNeo4j(cfg)
+		go testNeo4jConnection(logger, neo4jDriver)
+	}
+
+	elasticClient := initElasticsearch(cfg)
+	go testElasticsearchConnection(logger, elasticClient, cfg.Repo.Elasticsearch.URL)
+
+	repos := &repositories{
+		account:    repo.NewAccountRepo(mongoDatabase),
+		collection: repo.NewCollectionRepo(mongoDatabase),
+		search:     repo.NewSearchRepo(elasticClient),
+		review:     repo.NewReviewRepo(mongoDatabase),
+		comment:    repo.NewCommentRepo(mongoDatabase),
+	}
+	repos.asteroid, repos.graph, repos.batch, repos.query = initGraphRepos(cfg, mongoDatabase, neo4jDriver)
+
+	// asteroid writes are indexed for search in the background.
+	searchIndexer := repo.NewSearchIndexer(logger, mongoDatabase, elasticClient)
+	searchIndexer.Start()
+	repos.asteroid = repo.NewIndexedAsteroidRepo(repos.asteroid, searchIndexer)
+	repos.batch = repo.NewIndexedBatchRepo(repos.batch, searchIndexer)
+
+	return repos, func() {
+		searchIndexer.Close()
+		printCloseStatus(logger, "Search indexer", nil)
+		if neo4jDriver != nil {
+			printCloseStatus(logger, "Neo4j driver", neo4jDriver.Close())
+		}
+		printCloseStatus(logger, "Mongo client", mongoClient.Disconnect(context.Background()))
+	}
+}
+
+func initMongo(cfg *conf.App) (*mongo.Client, *mongo.Database) {
 	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Repo.Mongo.URL))
 	panicIfFailed(err)
-	mongoDatabase := mongoClient.Database("oort_server")
-	go testMongoConnection(logger, mongoClient)
+	return mongoClient, mongoClient.Database("oort_server")
+}
 
+func initNeo4j(cfg *conf.App) neo4j.Driver {
 	neo4jDriver, err := neo4j.NewDriver(
 		cfg.Repo.Neo4j.URL,
 		neo4j.BasicAuth(cfg.Repo.Neo4j.Username, cfg.Repo.Neo4j.Password, cfg.Repo.Neo4j.Realm))
 	panicIfFailed(err)
-	go testNeo4jConnection(logger, neo4jDriver)
+	return neo4jDriver
+}
 
+func initElasticsearch(cfg *conf.App) *elastic.Client {
 	elasticClient, err := elastic.NewClient(
 		elastic.SetURL(cfg.Repo.Elasticsearch.URL),
 		elastic.SetBasicAuth(cfg.Repo.Elasticsearch.Username, cfg.Repo.Elasticsearch.Password))
 	panicIfFailed(err)
-	go testElasticsearchConnection(logger, elasticClient, cfg.Repo.Elasticsearch.URL)
+	return elasticClient
+}
 
-	// repositories
-	accountRepo := repo.NewAccountRepo(mongoDatabase)
-	asteroidRepo := repo.NewAsteroidRepo(mongoDatabase, neo4jDriver)
-	graphRepo := repo.NewGraphRepo(mongoDatabase, neo4jDriver)
-	collectionRepo := repo.NewCollectionRepo(mongoDatabase)
-	searchRepo := repo.NewSearchRepo(elasticClient)
+// initEmbeddedRepos keeps everything in a single local file, for running
+// without any other store.
+func initEmbeddedRepos(logger *zap.Logger, cfg *conf.App) (*repositories, func()) {
+	path := cfg.Repo.Embedded.Path
+	if path == "" {
+		path = conf.DefaultEmbeddedPath
+	}
+	boltDB, err := repo.OpenBolt(path)
+	panicIfFailed(err)
+	logger.Named("[START_UP]").Sugar().Infof("Opened the embedded store at %s", path)
 
-	// services
-	accountService := account.NewService(logger, &cfg.Biz.Account, accountRepo)
-	asteroidService := asteroid.NewService(logger, asteroidRepo)
-	collectionService := collection.NewService(logger, collectionRepo)
-	graphService := graph.NewService(logger, graphRepo)
-	searchService := search.NewService(logger, searchRepo)
+	repos := &repositories{
+		account:    repo.NewBoltAccountRepo(boltDB),
+		asteroid:   repo.NewBoltAsteroidRepo(boltDB),
+		collection: repo.NewBoltCollectionRepo(boltDB),
+		graph:      repo.NewBoltGraphRepo(boltDB),
+		search:     repo.NewBoltSearchRepo(boltDB),
+		review:     repo.NewBoltReviewRepo(boltDB),
+		comment:    repo.NewBoltCommentRepo(boltDB),
+		batch:      repo.NewBoltBatchRepo(boltDB),
+		query:      repo.NewBoltQueryRepo(boltDB),
+	}
+	return repos, func() {
+		printCloseStatus(logger, "Embedded store", boltDB.Close())
+	}
+}
 
-	app.Use(pprof.New())
-	app.Use(requestid.New())
-	app.Use(cors.New())
+// initGraphRepos builds the repositories of the graph store in use, Neo4j by default.
+func initGraphRepos(cfg *conf.App, mongoDatabase *mongo.Database, neo4jDriver neo4j.Driver) (asteroid.Repo, graph.Repo, batch.Repo, query.Repo) {
+	switch cfg.Repo.Graph {
+	case "", conf.GraphNeo4j:
+		return repo.NewAsteroidRepo(mongoDatabase, neo4jDriver),
+			repo.NewGraphRepo(mongoDatabase, neo4jDriver),
+			repo.NewBatchRepo(mongoDatabase, neo4jDriver),
+			repo.NewQueryRepo(mongoDatabase, neo4jDriver)
+	case conf.GraphMongo:
+		panicIfFailed(repo.EnsureLinkIndexes(context.Background(), mongoDatabase))
+		return repo.NewMongoAsteroidRepo(mongoDatabase),
+			repo.NewMongoGraphRepo(mongoDatabase),
+			repo.NewMongoBatchRepo(mongoDatabase),
+			repo.NewMongoQueryRepo(mongoDatabase)
+	}
+	panic(fmt.Sprintf("unknown graph store %q", cfg.Repo.Graph))
+}
 
-	// routes
-	api := app.Group("/api/")
-	index_handlers.RegisterHandlers(api, cfg)
-	account_handlers.RegisterHandlers(api, logger, validate, accountService)
+// runCommand runs a maintenance job instead of the server, e.g. `oort-server backfill-graph`:
+//
+//	backfill-graph  copies the asteroids of Mongo to their Neo4j nodes.
+//	reindex-search  rebuilds the asteroid index from Mongo, needed once by an
+//	                index built before title completion, which finds nothing
+//	                in it until then.
+func runCommand(cfg *conf.App, logger *zap.Logger, name string) {
+	log := logger.Named("[COMMAND]").Sugar()
+	switch name {
+	case "backfill-graph":
+		mongoClient, mongoDatabase := initMongo(cfg)
+		neo4jDriver := initNeo4j(cfg)
+		defer func() {
+			printCloseStatus(logger, "Neo4j driver", neo4jDriver.Close())
+			printCloseStatus(logger, "Mongo client", mongoClient.Disconnect(context.Background()))
+		}()
 
-	api.Use(auth.New(logger, accountService))
-	asteroid_handlers.RegisterHandlers(api, logger, validate, asteroidService)
-	graph_handlers.RegisterHandlers(api, logger, validate, graphService)
-	collection_handlers.RegisterHandlers(api, logger, validate, collectionService)
-	search_handlers.RegisterHandlers(api, logger, searchService)
+		written, err := repo.NewAsteroidRepo(mongoDatabase, neo4jDriver).BackfillNodes(context.Background())
+		if err != nil {
+			log.Errorf("Backfill failed after %d asteroids, error:\n%+v", written, err)
+			return
+		}
+		log.Infof("Backfilled %d asteroid nodes", written)
+	case "reindex-search":
+		mongoClient, mongoDatabase := initMongo(cfg)
+		defer func() {
+			printCloseStatus(logger, "Mongo client", mongoClient.Disconnect(context.Background()))
+		}()
 
-	return func() {
-		printCloseStatus(logger, "Neo4j driver", neo4jDriver.Close())
-		printCloseStatus(logger, "Mongo client", mongoClient.Disconnect(context.Background()))
+		index, indexed, err := repo.NewSearchIndexer(logger, mongoDatabase, initElasticsearch(cfg)).Reindex(context.Background())
+		if err != nil {
+			log.Errorf("Reindex into %s failed, error:\n%+v", index, err)
+			return
+		}
+		log.Infof("Reindexed %d asteroids into %s", indexed, index)
+	default:
+		log.Errorf("Unknown command %q, expected backfill-graph or reindex-search", name)
 	}
 }
 
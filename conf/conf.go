@@ -28,11 +28,33 @@ type Logger struct {
 }
 
 type Repo struct {
+	// Mode is "embedded" to keep everything in a single local file, with no
+	// Mongo, Neo4j or Elasticsearch to run. The other stores are used otherwise.
+	Mode     string   `mapstructure:"mode"`
+	Embedded Embedded `mapstructure:"embedded"`
+	// Graph is the store of the links between asteroids, "neo4j" by default, or
+	// "mongo" to run without Neo4j.
+	Graph         string        `mapstructure:"graph"`
 	Mongo         Mongo         `mapstructure:"mongo"`
 	Neo4j         Neo4j         `mapstructure:"neo4j"`
 	Elasticsearch Elasticsearch `mapstructure:"elasticsearch"`
 }
 
+const (
+	GraphNeo4j = "neo4j"
+	GraphMongo = "mongo"
+)
+
+const (
+	ModeEmbedded        = "embedded"
+	DefaultEmbeddedPath = "oort.db"
+)
+
+type Embedded struct {
+	// Path is the file of the embedded store, created if missing, "oort.db" by default.
+	Path string `mapstructure:"path"`
+}
+
 type Mongo struct {
 	URL string `mapstructure:"url"`
 }
@@ -51,7 +73,8 @@ type Elasticsearch struct {
 }
 
 type Biz struct {
-	Account Account `mapstructure:"account"`
+	Account  Account  `mapstructure:"account"`
+	Asteroid Asteroid `mapstructure:"asteroid"`
 }
 
 type Account struct {
@@ -63,6 +86,11 @@ type Account struct {
 	GiteeRedirectURI  string `mapstructure:"gitee_redirect_uri"`
 }
 
+type Asteroid struct {
+	// ClientURL is the client route of an asteroid, "{id}" is replaced by the asteroid ID.
+	ClientURL string `mapstructure:"client_url"`
+}
+
 func Parse(path string) *App {
 	var (
 		v = viper.New()
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ProjectOort/oort-server/biz/account"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ account.Repo = (*BoltAccountRepo)(nil)
+
+type BoltAccountRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltAccountRepo(_bolt *bbolt.DB) *BoltAccountRepo {
+	return &BoltAccountRepo{_bolt: _bolt}
+}
+
+func (r *BoltAccountRepo) Create(ctx context.Context, acc *account.Account) error {
+	return r._bolt.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(_BoltAccount), acc.ID[:], acc)
+	})
+}
+
+func (r *BoltAccountRepo) Get(ctx context.Context, id primitive.ObjectID) (*account.Account, error) {
+	acc := new(account.Account)
+	err := r._bolt.View(func(tx *bbolt.Tx) error {
+		if err := boltGet(tx.Bucket(_BoltAccount), id[:], acc); err != nil {
+			return err
+		}
+		if !acc.State {
+			return mongo.ErrNoDocuments
+		}
+		return nil
+	})
+	return acc, err
+}
+
+func (r *BoltAccountRepo) Update(ctx context.Context, acc *account.Account) error {
+	return r.Create(ctx, acc)
+}
+
+func (r *BoltAccountRepo) GetByGiteeID(ctx context.Context, gid int) (*account.Account, error) {
+	return r.find(func(acc *account.Account) bool { return acc.GiteeID == gid })
+}
+
+func (r *BoltAccountRepo) GetByUserName(ctx context.Context, uname string) (*account.Account, error) {
+	return r.find(func(acc *account.Account) bool { return acc.UserName == uname })
+}
+
+func (r *BoltAccountRepo) GetByEmail(ctx context.Context, email string) (*account.Account, error) {
+	return r.find(func(acc *account.Account) bool { return acc.BindStatus.Email && acc.Email == email })
+}
+
+func (r *BoltAccountRepo) GetByMobile(ctx context.Context, mobile string) (*account.Account, error) {
+	return r.find(func(acc *account.Account) bool { return acc.BindStatus.Mobile && acc.Mobile == mobile })
+}
+
+// find returns the first living account matching.
+func (r *BoltAccountRepo) find(match func(*account.Account) bool) (*account.Account, error) {
+	var found *account.Account
+	err := r._bolt.View(func(tx *bbolt.Tx) error {
+		return boltEach(tx.Bucket(_BoltAccount), nil, func(_, v []byte) error {
+			var acc account.Account
+			if err := bson.Unmarshal(v, &acc); err != nil {
+				return err
+			}
+			if found == nil && acc.State && match(&acc) {
+				found = &acc
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return new(account.Account), mongo.ErrNoDocuments
+	}
+	return found, nil
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/ProjectOort/oort-server/biz/asteroid"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
@@ -16,9 +17,60 @@ import (
 var _ asteroid.Repo = (*AsteroidRepo)(nil)
 
 const (
-	_AsteroidCollection = "asteroid"
+	_AsteroidCollection        = "asteroid"
+	_AsteroidHistoryCollection = "asteroid_history"
+	_AsteroidStarCollection    = "asteroid_star"
 )
 
+// Asteroid nodes keep a copy of the fields graph-shaped reads need, so those
+// are served by Neo4j alone. Every write to these fields in Mongo is mirrored.
+const _CreateAsteroidNodeCypher = "CREATE (a: Asteroid {id: $id, state: $state, authorId: $authorId, " +
+	"hub: $hub, type: $type, title: $title, createdTime: $createdTime, updatedTime: $updatedTime})"
+
+func asteroidNodeParams(a *asteroid.Asteroid) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          a.ID.Hex(),
+		"state":       a.State,
+		"authorId":    a.AuthorID.Hex(),
+		"hub":         a.Hub,
+		"type":        a.Type,
+		"title":       a.Title,
+		"createdTime": localDateTimeOf(a.CreatedTime),
+		"updatedTime": localDateTimeOf(a.UpdatedTime),
+	}
+}
+
+// nodeAsteroid reads an asteroid back from its node, without its content or
+// view statistics, which are only kept in Mongo.
+func nodeAsteroid(node neo4j.Node) *asteroid.Asteroid {
+	ast := new(asteroid.Asteroid)
+	if id, ok := node.Props["id"].(string); ok {
+		ast.ID, _ = primitive.ObjectIDFromHex(id)
+	}
+	if authorID, ok := node.Props["authorId"].(string); ok {
+		ast.AuthorID, _ = primitive.ObjectIDFromHex(authorID)
+	}
+	ast.State, _ = node.Props["state"].(bool)
+	ast.Hub, _ = node.Props["hub"].(bool)
+	ast.Title, _ = node.Props["title"].(string)
+	if typ, ok := node.Props["type"].(int64); ok {
+		ast.Type = int(typ)
+	}
+	ast.CreatedTime = localDateTime(node.Props["createdTime"])
+	ast.UpdatedTime = localDateTime(node.Props["updatedTime"])
+	return ast
+}
+
+// collectAsteroids reads the nodes of the given column of every record.
+func collectAsteroids(result neo4j.Result, column string) ([]*asteroid.Asteroid, error) {
+	asts := make([]*asteroid.Asteroid, 0)
+	for result.Next() {
+		_node_, _ := result.Record().Get(column)
+		asts = append(asts, nodeAsteroid(_node_.(neo4j.Node)))
+	}
+	return asts, result.Err()
+}
+
 type AsteroidRepo struct {
 	_mongo *mongo.Database
 	_neo4j neo4j.Driver
@@ -40,13 +92,7 @@ func (x *AsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFro
 	defer neo4jSession.Close()
 
 	neo4jCallback := func(tx neo4j.Transaction) (interface{}, error) {
-		createNodeCypher := "CREATE (a: Asteroid {id: $id, state: $state, authorId: $authorId, createdTime: $createdTime})"
-		result, err := tx.Run(createNodeCypher, map[string]interface{}{
-			"id":          a.ID.Hex(),
-			"state":       a.State,
-			"authorId":    a.AuthorID.Hex(),
-			"createdTime": neo4j.LocalDateTimeOf(a.CreatedTime),
-		})
+		result, err := tx.Run(_CreateAsteroidNodeCypher, asteroidNodeParams(a))
 		if err != nil {
 			return nil, err
 		}
@@ -62,10 +108,11 @@ func (x *AsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFro
 
 			createLinkCypher := "MATCH (from:Asteroid), (cur:Asteroid) " +
 				"WHERE from.id IN $fromIds AND cur.id = $curId " +
-				"CREATE (from)-[r:REFER]->(cur)"
+				"CREATE (from)-[r:REFER {createdTime: $createdTime}]->(cur)"
 			result, err := tx.Run(createLinkCypher, map[string]interface{}{
-				"fromIds": linkFrom,
-				"curId":   a.ID.Hex(),
+				"fromIds":     linkFrom,
+				"curId":       a.ID.Hex(),
+				"createdTime": localDateTimeOf(a.CreatedTime),
 			})
 			if err != nil {
 				return nil, err
@@ -83,10 +130,11 @@ func (x *AsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFro
 
 			createLinkCypher := "MATCH (to:Asteroid), (cur:Asteroid) " +
 				"WHERE to.id IN $toIds AND cur.id = $curId " +
-				"CREATE (cur)-[r:REFER]->(to)"
+				"CREATE (cur)-[r:REFER {createdTime: $createdTime}]->(to)"
 			result, err := tx.Run(createLinkCypher, map[string]interface{}{
-				"toIds": linkTo,
-				"curId": a.ID.Hex(),
+				"toIds":       linkTo,
+				"curId":       a.ID.Hex(),
+				"createdTime": localDateTimeOf(a.CreatedTime),
 			})
 			if err != nil {
 				return nil, err
@@ -146,10 +194,11 @@ func (x *AsteroidRepo) LinkTo(ctx context.Context, curAstID primitive.ObjectID,
 
 	createLinkCypher := "MATCH (to:Asteroid), (cur:Asteroid) " +
 		"WHERE to.id IN $toIds AND cur.id = $curId " +
-		"CREATE (cur)-[r:REFER]->(to)"
+		"CREATE (cur)-[r:REFER {createdTime: $createdTime}]->(to)"
 	result, err := neo4jSession.Run(createLinkCypher, map[string]interface{}{
-		"toIds": linkTo,
-		"curId": curAstID.Hex(),
+		"toIds":       linkTo,
+		"curId":       curAstID.Hex(),
+		"createdTime": localDateTimeOf(time.Now()),
 	})
 	if err != nil {
 		return err
@@ -169,10 +218,11 @@ func (x *AsteroidRepo) LinkFrom(ctx context.Context, curAstID primitive.ObjectID
 
 	createLinkCypher := "MATCH (from:Asteroid), (cur:Asteroid) " +
 		"WHERE from.id IN $fromIds AND cur.id = $curId " +
-		"CREATE (from)-[r:REFER]->(cur)"
+		"CREATE (from)-[r:REFER {createdTime: $createdTime}]->(cur)"
 	result, err := neo4jSession.Run(createLinkCypher, map[string]interface{}{
-		"fromIds": linkFrom,
-		"curId":   curAstID.Hex(),
+		"fromIds":     linkFrom,
+		"curId":       curAstID.Hex(),
+		"createdTime": localDateTimeOf(time.Now()),
 	})
 	if err != nil {
 		return err
@@ -199,12 +249,16 @@ func (x *AsteroidRepo) Get(ctx context.Context, id primitive.ObjectID) (*asteroi
 	return ast, err
 }
 
-func (x *AsteroidRepo) ListHub(ctx context.Context, authorID primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+func (x *AsteroidRepo) ListHub(ctx context.Context, authorID primitive.ObjectID, opts *asteroid.ListOptions) ([]*asteroid.Asteroid, error) {
+	order := 1
+	if opts.Desc {
+		order = -1
+	}
 	cursor, err := x._mongo.Collection("asteroid").Find(ctx, bson.D{
 		{"author_id", authorID},
 		{"state", true},
 		{"hub", true},
-	})
+	}, options.Find().SetSort(bson.D{{string(opts.SortBy), order}, {"_id", order}}))
 	if err != nil {
 		return nil, err
 	}
@@ -222,6 +276,49 @@ func (x *AsteroidRepo) ListHub(ctx context.Context, authorID primitive.ObjectID)
 	return asts, nil
 }
 
+func (x *AsteroidRepo) ListByAuthor(ctx context.Context, authorID primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
+		{"author_id", authorID},
+		{"state", true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	asts := make([]*asteroid.Asteroid, 0)
+	for result.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := result.Decode(&ast); err != nil {
+			return nil, err
+		}
+		asts = append(asts, &ast)
+	}
+	return asts, result.Err()
+}
+
+func (x *AsteroidRepo) ListByTitles(ctx context.Context, authorID primitive.ObjectID, titles []string) ([]*asteroid.Asteroid, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
+		{"author_id", authorID},
+		{"state", true},
+		{"title", bson.D{{"$in", titles}}},
+	}, options.Find().SetProjection(bson.D{{"content", 0}}))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	asts := make([]*asteroid.Asteroid, 0)
+	for result.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := result.Decode(&ast); err != nil {
+			return nil, err
+		}
+		asts = append(asts, &ast)
+	}
+	return asts, result.Err()
+}
+
 func (x *AsteroidRepo) List(ctx context.Context, aIDs []primitive.ObjectID) ([]*asteroid.Asteroid, error) {
 	result, err := x._mongo.Collection("asteroid").Find(ctx, bson.D{
 		{"_id", bson.D{
@@ -259,83 +356,235 @@ func (x *AsteroidRepo) ListLinkedFrom(ctx context.Context, id primitive.ObjectID
 	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close()
 
-	cypher := "MATCH (a:Asteroid)-[:REFER]->(:Asteroid {id: $id}) RETURN a"
+	cypher := "MATCH (a:Asteroid)-[r:REFER]->(:Asteroid {id: $id}) WHERE r.removedTime IS NULL AND a.state = true " +
+		"RETURN DISTINCT a ORDER BY a.createdTime, a.id"
 
 	result, err := session.Run(cypher, map[string]interface{}{"id": id.Hex()})
 	if err != nil {
 		return nil, err
 	}
+	return collectAsteroids(result, "a")
+}
 
-	// collect ids
-	ids := make([]primitive.ObjectID, 0)
-	for result.Next() {
-		nodeI, _ := result.Record().Get("a")
-		node := nodeI.(neo4j.Node)
+func (x *AsteroidRepo) ListLinkedTo(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
 
-		id, _ := primitive.ObjectIDFromHex(node.Props["id"].(string))
-		ids = append(ids, id)
-	}
+	cypher := "MATCH (:Asteroid {id: $id})-[r:REFER]->(a:Asteroid) WHERE r.removedTime IS NULL AND a.state = true " +
+		"RETURN DISTINCT a ORDER BY a.createdTime, a.id"
 
-	mongoResult, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{{
-		"_id", bson.D{{
-			"$in", ids,
-		}},
-	}}, options.Find().SetProjection(bson.D{
-		{"content", 0},
-	}))
+	result, err := session.Run(cypher, map[string]interface{}{"id": id.Hex()})
 	if err != nil {
 		return nil, err
 	}
-	asts := make([]*asteroid.Asteroid, 0, len(ids))
-	for mongoResult.Next(ctx) {
-		var ast asteroid.Asteroid
-		err := mongoResult.Decode(&ast)
-		if err != nil {
-			return nil, err
+	return collectAsteroids(result, "a")
+}
+
+func (x *AsteroidRepo) RecordView(ctx context.Context, accID, astID primitive.ObjectID, viewedTime time.Time) error {
+	_, err := x._mongo.Collection(_AsteroidCollection).UpdateByID(ctx, astID, bson.D{
+		{"$inc", bson.D{{"view_count", 1}}},
+		{"$set", bson.D{{"last_viewed_time", viewedTime}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// moves the asteroid to the head of the history, and drops the tail beyond
+	// the bound, in a single write so that concurrent views can't interleave.
+	_, err = x._mongo.Collection(_AsteroidHistoryCollection).UpdateByID(ctx, accID, mongo.Pipeline{
+		{{"$set", bson.D{{"items", bson.D{{"$slice", bson.A{
+			bson.D{{"$concatArrays", bson.A{
+				bson.A{bson.D{
+					{"asteroid_id", astID},
+					{"viewed_time", viewedTime},
+				}},
+				bson.D{{"$filter", bson.D{
+					{"input", bson.D{{"$ifNull", bson.A{"$items", bson.A{}}}}},
+					{"cond", bson.D{{"$ne", bson.A{"$$this.asteroid_id", astID}}}},
+				}}},
+			}}},
+			asteroid.MaxViewHistory,
+		}}}}}}},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (x *AsteroidRepo) ListViewed(ctx context.Context, accID primitive.ObjectID, limit int) ([]*asteroid.Asteroid, error) {
+	var history struct {
+		Items []struct {
+			AsteroidID primitive.ObjectID `bson:"asteroid_id"`
+		} `bson:"items"`
+	}
+	err := x._mongo.Collection(_AsteroidHistoryCollection).
+		FindOne(ctx, bson.D{{"_id", accID}},
+			options.FindOne().SetProjection(bson.D{{"items", bson.D{{"$slice", limit}}}})).
+		Decode(&history)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return []*asteroid.Asteroid{}, nil
 		}
-		asts = append(asts, &ast)
+		return nil, err
 	}
-	return asts, nil
+
+	ids := make([]primitive.ObjectID, 0, len(history.Items))
+	for _, item := range history.Items {
+		ids = append(ids, item.AsteroidID)
+	}
+	return x.listInOrder(ctx, ids)
 }
 
-func (x *AsteroidRepo) ListLinkedTo(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
-	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
-	defer session.Close()
+// EnsureStarIndexes creates the unique index of the stars, so that an asteroid
+// starred twice at once is still starred once. Duplicates stored before have to
+// be removed for the index to be built.
+func EnsureStarIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(_AsteroidStarCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"account_id", 1}, {"asteroid_id", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
 
-	cypher := "MATCH (:Asteroid {id: $id})-[:REFER]->(a:Asteroid) RETURN a"
+func (x *AsteroidRepo) Star(ctx context.Context, accID, astID primitive.ObjectID, starredTime time.Time) error {
+	_, err := x._mongo.Collection(_AsteroidStarCollection).UpdateOne(ctx, bson.D{
+		{"account_id", accID},
+		{"asteroid_id", astID},
+	}, bson.D{
+		{"$setOnInsert", bson.D{
+			{"_id", primitive.NewObjectID()},
+			{"created_time", starredTime},
+		}},
+	}, options.Update().SetUpsert(true))
+	// a concurrent star inserted it first.
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
 
-	result, err := session.Run(cypher, map[string]interface{}{"id": id.Hex()})
+func (x *AsteroidRepo) Unstar(ctx context.Context, accID, astID primitive.ObjectID) error {
+	_, err := x._mongo.Collection(_AsteroidStarCollection).DeleteOne(ctx, bson.D{
+		{"account_id", accID},
+		{"asteroid_id", astID},
+	})
+	return err
+}
+
+func (x *AsteroidRepo) ListStarred(ctx context.Context, accID primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	result, err := x._mongo.Collection(_AsteroidStarCollection).Find(ctx, bson.D{
+		{"account_id", accID},
+	}, options.Find().SetSort(bson.D{{"created_time", -1}}))
 	if err != nil {
 		return nil, err
 	}
-	ids := make([]primitive.ObjectID, 0)
-	for result.Next() {
-		nodeI, _ := result.Record().Get("a")
-		node := nodeI.(neo4j.Node)
+	defer result.Close(ctx)
 
-		id, _ := primitive.ObjectIDFromHex(node.Props["id"].(string))
-		ids = append(ids, id)
+	ids := make([]primitive.ObjectID, 0)
+	for result.Next(ctx) {
+		var star struct {
+			AsteroidID primitive.ObjectID `bson:"asteroid_id"`
+		}
+		if err := result.Decode(&star); err != nil {
+			return nil, err
+		}
+		ids = append(ids, star.AsteroidID)
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
 	}
+	return x.listInOrder(ctx, ids)
+}
 
-	mongoResult, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{{
-		"_id", bson.D{{
-			"$in", ids,
-		}},
-	}}, options.Find().SetProjection(bson.D{
-		{"content", 0},
-	}))
+// listInOrder fetches the living asteroids of ids without content, keeping the order of ids.
+func (x *AsteroidRepo) listInOrder(ctx context.Context, ids []primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	if len(ids) == 0 {
+		return []*asteroid.Asteroid{}, nil
+	}
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"state", true},
+	}, options.Find().SetProjection(bson.D{{"content", 0}}))
 	if err != nil {
 		return nil, err
 	}
-	asts := make([]*asteroid.Asteroid, 0, len(ids))
-	for mongoResult.Next(ctx) {
+	defer result.Close(ctx)
+
+	astMap := make(map[primitive.ObjectID]*asteroid.Asteroid, len(ids))
+	for result.Next(ctx) {
 		var ast asteroid.Asteroid
-		err := mongoResult.Decode(&ast)
-		if err != nil {
+		if err := result.Decode(&ast); err != nil {
 			return nil, err
 		}
-		asts = append(asts, &ast)
+		astMap[ast.ID] = &ast
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
 	}
 
+	asts := make([]*asteroid.Asteroid, 0, len(astMap))
+	for _, id := range ids {
+		if ast, ok := astMap[id]; ok {
+			asts = append(asts, ast)
+		}
+	}
 	return asts, nil
 }
+
+// _BackfillBatchSize is how many asteroids a backfill writes to Neo4j at once.
+const _BackfillBatchSize = 500
+
+// BackfillNodes copies the fields asteroid nodes keep from Mongo to every
+// node, creating the nodes Neo4j misses, and returns how many were written.
+// It can be run again at any time.
+func (x *AsteroidRepo) BackfillNodes(ctx context.Context) (int64, error) {
+	cursor, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{},
+		options.Find().SetProjection(bson.D{{"content", 0}}).SetBatchSize(_BackfillBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer session.Close()
+
+	cypher := "UNWIND $rows AS row " +
+		"MERGE (a:Asteroid {id: row.id}) " +
+		"SET a.state = row.state, a.authorId = row.authorId, a.hub = row.hub, a.type = row.type, a.title = row.title, " +
+		"a.createdTime = row.createdTime, a.updatedTime = row.updatedTime"
+	write := func(rows []interface{}) error {
+		_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+			result, err := tx.Run(cypher, map[string]interface{}{"rows": rows})
+			if err != nil {
+				return nil, err
+			}
+			return result.Consume()
+		})
+		return err
+	}
+
+	var written int64
+	rows := make([]interface{}, 0, _BackfillBatchSize)
+	for cursor.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := cursor.Decode(&ast); err != nil {
+			return written, err
+		}
+		rows = append(rows, asteroidNodeParams(&ast))
+		if len(rows) == _BackfillBatchSize {
+			if err := write(rows); err != nil {
+				return written, err
+			}
+			written += int64(len(rows))
+			rows = rows[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return written, err
+	}
+	if len(rows) != 0 {
+		if err := write(rows); err != nil {
+			return written, err
+		}
+		written += int64(len(rows))
+	}
+	return written, nil
+}
@@ -0,0 +1,371 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ asteroid.Repo = (*BoltAsteroidRepo)(nil)
+
+type BoltAsteroidRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltAsteroidRepo(_bolt *bbolt.DB) *BoltAsteroidRepo {
+	return &BoltAsteroidRepo{_bolt: _bolt}
+}
+
+func (x *BoltAsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFromIDs []primitive.ObjectID, linkToIDs []primitive.ObjectID) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		if err := putBoltAsteroid(tx, a); err != nil {
+			return err
+		}
+		for _, id := range linkFromIDs {
+			if err := boltLink(tx, a.AuthorID, id, a.ID, a.CreatedTime); err != nil {
+				return err
+			}
+		}
+		for _, id := range linkToIDs {
+			if err := boltLink(tx, a.AuthorID, a.ID, id, a.CreatedTime); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltAsteroidRepo) LinkTo(ctx context.Context, curAstID primitive.ObjectID, linkToIDs []primitive.ObjectID) error {
+	return x.link(curAstID, func(tx *bbolt.Tx, authorID primitive.ObjectID, now time.Time) error {
+		for _, id := range linkToIDs {
+			if err := boltLink(tx, authorID, curAstID, id, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltAsteroidRepo) LinkFrom(ctx context.Context, curAstID primitive.ObjectID, linkFromIDs []primitive.ObjectID) error {
+	return x.link(curAstID, func(tx *bbolt.Tx, authorID primitive.ObjectID, now time.Time) error {
+		for _, id := range linkFromIDs {
+			if err := boltLink(tx, authorID, id, curAstID, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltAsteroidRepo) link(curAstID primitive.ObjectID, write func(tx *bbolt.Tx, authorID primitive.ObjectID, now time.Time) error) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		cur, err := getBoltAsteroid(tx, curAstID)
+		if err != nil {
+			return err
+		}
+		return write(tx, cur.AuthorID, time.Now())
+	})
+}
+
+func (x *BoltAsteroidRepo) UpdateContent(ctx context.Context, a *asteroid.Asteroid) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		ast, err := getBoltAsteroid(tx, a.ID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+		ast.Content = a.Content
+		return putBoltAsteroid(tx, ast)
+	})
+}
+
+func (x *BoltAsteroidRepo) Get(ctx context.Context, id primitive.ObjectID) (*asteroid.Asteroid, error) {
+	ast := new(asteroid.Asteroid)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		found, err := getBoltAsteroid(tx, id)
+		if err != nil {
+			return err
+		}
+		if !found.State {
+			return mongo.ErrNoDocuments
+		}
+		ast = found
+		return nil
+	})
+	return ast, err
+}
+
+func (x *BoltAsteroidRepo) List(ctx context.Context, aIDs []primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	asts := make([]*asteroid.Asteroid, 0, len(aIDs))
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		for _, id := range aIDs {
+			ast, err := getBoltAsteroid(tx, id)
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			asts = append(asts, ast)
+		}
+		return nil
+	})
+	return asts, err
+}
+
+func (x *BoltAsteroidRepo) ListHub(ctx context.Context, authorID primitive.ObjectID, opts *asteroid.ListOptions) ([]*asteroid.Asteroid, error) {
+	asts, err := x.listByAuthor(authorID, func(ast *asteroid.Asteroid) bool { return ast.Hub })
+	if err != nil {
+		return nil, err
+	}
+	sortAsteroids(asts, opts.SortBy, opts.Desc)
+	return asts, nil
+}
+
+// sortAsteroids sorts by the field, then by ID in the same order.
+func sortAsteroids(asts []*asteroid.Asteroid, field asteroid.SortField, desc bool) {
+	compare := func(a, b *asteroid.Asteroid) int {
+		switch field {
+		case asteroid.SortByCreatedTime:
+			return compareTime(a.CreatedTime, b.CreatedTime)
+		case asteroid.SortByUpdatedTime:
+			return compareTime(a.UpdatedTime, b.UpdatedTime)
+		case asteroid.SortByLastViewedTime:
+			return compareTime(a.LastViewedTime, b.LastViewedTime)
+		case asteroid.SortByViewCount:
+			switch {
+			case a.ViewCount < b.ViewCount:
+				return -1
+			case a.ViewCount > b.ViewCount:
+				return 1
+			}
+		}
+		return 0
+	}
+	sort.Slice(asts, func(i, j int) bool {
+		c := compare(asts[i], asts[j])
+		if c == 0 {
+			c = bytes.Compare(asts[i].ID[:], asts[j].ID[:])
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func (x *BoltAsteroidRepo) ListByTitles(ctx context.Context, authorID primitive.ObjectID, titles []string) ([]*asteroid.Asteroid, error) {
+	wanted := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		wanted[title] = true
+	}
+	asts, err := x.listByAuthor(authorID, func(ast *asteroid.Asteroid) bool { return wanted[ast.Title] })
+	if err != nil {
+		return nil, err
+	}
+	for _, ast := range asts {
+		ast.Content = ""
+	}
+	return asts, nil
+}
+
+func (x *BoltAsteroidRepo) ListByAuthor(ctx context.Context, authorID primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	return x.listByAuthor(authorID, func(*asteroid.Asteroid) bool { return true })
+}
+
+// listByAuthor lists the living asteroids of the author matching, contents included.
+func (x *BoltAsteroidRepo) listByAuthor(authorID primitive.ObjectID, match func(*asteroid.Asteroid) bool) ([]*asteroid.Asteroid, error) {
+	asts := make([]*asteroid.Asteroid, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return eachBoltAsteroid(tx, authorID, func(ast *asteroid.Asteroid) error {
+			if ast.State && match(ast) {
+				asts = append(asts, ast)
+			}
+			return nil
+		})
+	})
+	return asts, err
+}
+
+func (x *BoltAsteroidRepo) ListLinkedFrom(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	return x.listLinked(id, false)
+}
+
+func (x *BoltAsteroidRepo) ListLinkedTo(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	return x.listLinked(id, true)
+}
+
+// listLinked lists the living asteroids at the other end of the links of the
+// asteroid, without content, oldest first.
+func (x *BoltAsteroidRepo) listLinked(id primitive.ObjectID, out bool) ([]*asteroid.Asteroid, error) {
+	var asts []*asteroid.Asteroid
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		ids, err := boltLinked(tx, id, out)
+		if err != nil {
+			return err
+		}
+		asts, err = listBoltInOrder(tx, ids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAsteroids(asts, asteroid.SortByCreatedTime, false)
+	return asts, nil
+}
+
+// boltHistory is the recently viewed asteroids of an account, latest first.
+type boltHistory struct {
+	Items []boltHistoryItem `bson:"items"`
+}
+
+type boltHistoryItem struct {
+	AsteroidID primitive.ObjectID `bson:"asteroid_id"`
+	ViewedTime time.Time          `bson:"viewed_time"`
+}
+
+func (x *BoltAsteroidRepo) RecordView(ctx context.Context, accID, astID primitive.ObjectID, viewedTime time.Time) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		ast, err := getBoltAsteroid(tx, astID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if ast != nil {
+			ast.ViewCount++
+			ast.LastViewedTime = viewedTime
+			if err := boltPut(tx.Bucket(_BoltAsteroid), ast.ID[:], ast); err != nil {
+				return err
+			}
+		}
+
+		// moves the asteroid to the head of the history, and drops the tail beyond the bound.
+		bucket := tx.Bucket(_BoltAsteroidHistory)
+		var history boltHistory
+		if err := boltGet(bucket, accID[:], &history); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		items := []boltHistoryItem{{AsteroidID: astID, ViewedTime: viewedTime}}
+		for _, item := range history.Items {
+			if item.AsteroidID != astID {
+				items = append(items, item)
+			}
+		}
+		if len(items) > asteroid.MaxViewHistory {
+			items = items[:asteroid.MaxViewHistory]
+		}
+		history.Items = items
+		return boltPut(bucket, accID[:], &history)
+	})
+}
+
+func (x *BoltAsteroidRepo) ListViewed(ctx context.Context, accID primitive.ObjectID, limit int) ([]*asteroid.Asteroid, error) {
+	var asts []*asteroid.Asteroid
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		var history boltHistory
+		if err := boltGet(tx.Bucket(_BoltAsteroidHistory), accID[:], &history); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if len(history.Items) > limit {
+			history.Items = history.Items[:limit]
+		}
+		ids := make([]primitive.ObjectID, 0, len(history.Items))
+		for _, item := range history.Items {
+			ids = append(ids, item.AsteroidID)
+		}
+		var err error
+		asts, err = listBoltInOrder(tx, ids)
+		return err
+	})
+	return asts, err
+}
+
+// boltStar is an asteroid an account starred, keyed by both their IDs.
+type boltStar struct {
+	CreatedTime time.Time `bson:"created_time"`
+}
+
+func (x *BoltAsteroidRepo) Star(ctx context.Context, accID, astID primitive.ObjectID, starredTime time.Time) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(_BoltAsteroidStar)
+		if bucket.Get(joinKey(accID, astID)) != nil {
+			return nil
+		}
+		return boltPut(bucket, joinKey(accID, astID), &boltStar{CreatedTime: starredTime})
+	})
+}
+
+func (x *BoltAsteroidRepo) Unstar(ctx context.Context, accID, astID primitive.ObjectID) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(_BoltAsteroidStar).Delete(joinKey(accID, astID))
+	})
+}
+
+func (x *BoltAsteroidRepo) ListStarred(ctx context.Context, accID primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	var asts []*asteroid.Asteroid
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		type starred struct {
+			id   primitive.ObjectID
+			time time.Time
+		}
+		stars := make([]starred, 0)
+		err := boltEach(tx.Bucket(_BoltAsteroidStar), accID[:], func(k, v []byte) error {
+			var star boltStar
+			if err := bson.Unmarshal(v, &star); err != nil {
+				return err
+			}
+			stars = append(stars, starred{id: keyID(k, 1), time: star.CreatedTime})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(stars, func(i, j int) bool { return stars[i].time.After(stars[j].time) })
+
+		ids := make([]primitive.ObjectID, 0, len(stars))
+		for _, star := range stars {
+			ids = append(ids, star.id)
+		}
+		asts, err = listBoltInOrder(tx, ids)
+		return err
+	})
+	return asts, err
+}
+
+// listBoltInOrder reads the living asteroids of ids without content, keeping the order of ids.
+func listBoltInOrder(tx *bbolt.Tx, ids []primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	asts := make([]*asteroid.Asteroid, 0, len(ids))
+	for _, id := range ids {
+		ast, err := getBoltAsteroid(tx, id)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ast.State {
+			ast.Content = ""
+			asts = append(asts, ast)
+		}
+	}
+	return asts, nil
+}
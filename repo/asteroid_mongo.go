@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compile-time interface implementation check.
+var _ asteroid.Repo = (*MongoAsteroidRepo)(nil)
+
+// MongoAsteroidRepo keeps the links between asteroids in Mongo, for the
+// deployments running without Neo4j. Everything else is shared with AsteroidRepo.
+type MongoAsteroidRepo struct {
+	*AsteroidRepo
+}
+
+func NewMongoAsteroidRepo(_mongo *mongo.Database) *MongoAsteroidRepo {
+	return &MongoAsteroidRepo{
+		AsteroidRepo: NewAsteroidRepo(_mongo, nil),
+	}
+}
+
+func (x *MongoAsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFromIDs []primitive.ObjectID, linkToIDs []primitive.ObjectID) error {
+	_, err := x._mongo.Collection(_AsteroidCollection).InsertOne(ctx, a)
+	if err != nil {
+		return err
+	}
+	models := make([]mongo.WriteModel, 0, len(linkFromIDs)+len(linkToIDs))
+	for _, id := range linkFromIDs {
+		models = append(models, linkModel(a.AuthorID, id, a.ID, a.CreatedTime))
+	}
+	for _, id := range linkToIDs {
+		models = append(models, linkModel(a.AuthorID, a.ID, id, a.CreatedTime))
+	}
+	return x.writeLinks(ctx, models)
+}
+
+func (x *MongoAsteroidRepo) LinkTo(ctx context.Context, curAstID primitive.ObjectID, linkToIDs []primitive.ObjectID) error {
+	authorID, err := x.authorOf(ctx, curAstID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(linkToIDs))
+	for _, id := range linkToIDs {
+		models = append(models, linkModel(authorID, curAstID, id, now))
+	}
+	return x.writeLinks(ctx, models)
+}
+
+func (x *MongoAsteroidRepo) LinkFrom(ctx context.Context, curAstID primitive.ObjectID, linkFromIDs []primitive.ObjectID) error {
+	authorID, err := x.authorOf(ctx, curAstID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(linkFromIDs))
+	for _, id := range linkFromIDs {
+		models = append(models, linkModel(authorID, id, curAstID, now))
+	}
+	return x.writeLinks(ctx, models)
+}
+
+func (x *MongoAsteroidRepo) writeLinks(ctx context.Context, models []mongo.WriteModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := x._mongo.Collection(_LinkCollection).BulkWrite(ctx, models)
+	return err
+}
+
+func (x *MongoAsteroidRepo) authorOf(ctx context.Context, astID primitive.ObjectID) (primitive.ObjectID, error) {
+	var ast asteroid.Asteroid
+	err := x._mongo.Collection(_AsteroidCollection).
+		FindOne(ctx, bson.D{{"_id", astID}}, options.FindOne().SetProjection(bson.D{{"author_id", 1}})).
+		Decode(&ast)
+	return ast.AuthorID, err
+}
+
+func (x *MongoAsteroidRepo) ListLinkedFrom(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	return x.listLinked(ctx, id, false)
+}
+
+func (x *MongoAsteroidRepo) ListLinkedTo(ctx context.Context, id primitive.ObjectID) ([]*asteroid.Asteroid, error) {
+	return x.listLinked(ctx, id, true)
+}
+
+// listLinked lists the living asteroids at the other end of the links of the
+// asteroid, without content, oldest first.
+func (x *MongoAsteroidRepo) listLinked(ctx context.Context, id primitive.ObjectID, out bool) ([]*asteroid.Asteroid, error) {
+	ids, err := findLinkedIDs(ctx, x._mongo, []primitive.ObjectID{id}, out)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*asteroid.Asteroid{}, nil
+	}
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"state", true},
+	}, options.Find().SetProjection(bson.D{{"content", 0}}).SetSort(bson.D{{"created_time", 1}, {"_id", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	asts := make([]*asteroid.Asteroid, 0, len(ids))
+	for result.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := result.Decode(&ast); err != nil {
+			return nil, err
+		}
+		asts = append(asts, &ast)
+	}
+	return asts, result.Err()
+}
@@ -0,0 +1,311 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ProjectOort/oort-server/biz/batch"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ batch.Repo = (*BatchRepo)(nil)
+
+type BatchRepo struct {
+	_mongo *mongo.Database
+	_neo4j neo4j.Driver
+}
+
+func NewBatchRepo(_mongo *mongo.Database, _neo4j neo4j.Driver) *BatchRepo {
+	return &BatchRepo{
+		_mongo: _mongo,
+		_neo4j: _neo4j,
+	}
+}
+
+// Apply stages every mutation in a Mongo transaction and a Neo4j transaction,
+// aborting both if anything goes wrong. Both transactions are committed only
+// once everything is staged, Mongo first since a failed Mongo commit is the
+// one that can still be rolled back on the Neo4j side. Should Neo4j then fail
+// to commit, the documents the batch touched are put back in Mongo as they
+// were before it, which also undoes whatever was written to them meanwhile.
+//
+// Mongo transactions need a replica set deployment.
+func (x *BatchRepo) Apply(ctx context.Context, muts []*batch.Mutation) error {
+	neo4jSession := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer neo4jSession.Close()
+	neo4jTx, err := neo4jSession.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	// rolls back unless committed.
+	defer neo4jTx.Close()
+
+	mongoSession, err := x._mongo.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer mongoSession.EndSession(ctx)
+	if err := mongoSession.StartTransaction(); err != nil {
+		return err
+	}
+
+	before := newMongoSnapshot()
+	err = mongo.WithSession(ctx, mongoSession, func(sessCtx mongo.SessionContext) error {
+		for _, mut := range muts {
+			if err := before.record(sessCtx, x._mongo, mut); err != nil {
+				return err
+			}
+			if err := x.applyMongo(sessCtx, mut); err != nil {
+				return err
+			}
+			if err := x.applyNeo4j(neo4jTx, mut); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = mongoSession.AbortTransaction(context.Background())
+		return err
+	}
+
+	if err := mongoSession.CommitTransaction(ctx); err != nil {
+		return err
+	}
+	if err := neo4jTx.Commit(); err != nil {
+		// undoes the batch even if the request is gone meanwhile.
+		if undoErr := before.restore(context.Background(), x._mongo); undoErr != nil {
+			return errors.Wrapf(batch.ErrDiverged, "neo4j commit: %v, mongo undo: %v", err, undoErr)
+		}
+		return errors.Wrapf(batch.ErrRolledBack, "neo4j commit: %v", err)
+	}
+	return nil
+}
+
+// mongoSnapshot keeps the documents a batch touches as they were before it,
+// nil for the ones it creates.
+type mongoSnapshot struct {
+	asteroids   map[primitive.ObjectID]bson.Raw
+	collections map[primitive.ObjectID]bson.Raw
+}
+
+func newMongoSnapshot() *mongoSnapshot {
+	return &mongoSnapshot{
+		asteroids:   make(map[primitive.ObjectID]bson.Raw),
+		collections: make(map[primitive.ObjectID]bson.Raw),
+	}
+}
+
+// record keeps the documents the mutation is about to change, unless an
+// earlier mutation of the batch changed them already.
+func (s *mongoSnapshot) record(ctx context.Context, db *mongo.Database, mut *batch.Mutation) error {
+	var (
+		docs       map[primitive.ObjectID]bson.Raw
+		collection string
+		id         primitive.ObjectID
+	)
+	switch mut.Type {
+	case batch.OpCreate:
+		if _, ok := s.asteroids[mut.AsteroidID]; !ok {
+			s.asteroids[mut.AsteroidID] = nil
+		}
+		return nil
+	case batch.OpUpdate:
+		docs, collection, id = s.asteroids, _AsteroidCollection, mut.AsteroidID
+	case batch.OpCollectionPush, batch.OpCollectionPop:
+		docs, collection, id = s.collections, _CollectionCollection, mut.CollectionID
+	default:
+		return nil
+	}
+	if _, ok := docs[id]; ok {
+		return nil
+	}
+	raw, err := db.Collection(collection).FindOne(ctx, bson.D{{"_id", id}}).DecodeBytes()
+	if err != nil {
+		return err
+	}
+	docs[id] = raw
+	return nil
+}
+
+// restore puts the documents back as they were, in a transaction of its own.
+func (s *mongoSnapshot) restore(ctx context.Context, db *mongo.Database) error {
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		for collection, docs := range map[string]map[primitive.ObjectID]bson.Raw{
+			_AsteroidCollection:   s.asteroids,
+			_CollectionCollection: s.collections,
+		} {
+			for id, raw := range docs {
+				var err error
+				if raw == nil {
+					_, err = db.Collection(collection).DeleteOne(sessCtx, bson.D{{"_id", id}})
+				} else {
+					_, err = db.Collection(collection).ReplaceOne(sessCtx, bson.D{{"_id", id}}, raw)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (x *BatchRepo) applyMongo(ctx context.Context, mut *batch.Mutation) error {
+	switch mut.Type {
+	case batch.OpCreate:
+		_, err := x._mongo.Collection(_AsteroidCollection).InsertOne(ctx, mut.Asteroid)
+		return err
+	case batch.OpUpdate:
+		fields := bson.D{{"updated_time", mut.UpdatedTime}}
+		if mut.Hub != nil {
+			fields = append(fields, bson.E{Key: "hub", Value: *mut.Hub})
+		}
+		if mut.Title != nil {
+			fields = append(fields, bson.E{Key: "title", Value: *mut.Title})
+		}
+		if mut.Content != nil {
+			fields = append(fields, bson.E{Key: "content", Value: *mut.Content})
+		}
+		_, err := x._mongo.Collection(_AsteroidCollection).UpdateByID(ctx, mut.AsteroidID, bson.D{{"$set", fields}})
+		return err
+	case batch.OpCollectionPush:
+		_, err := x._mongo.Collection(_CollectionCollection).UpdateByID(ctx, mut.CollectionID, bson.D{
+			{"$addToSet", bson.D{{"items", mut.ItemID}}},
+			{"$set", bson.D{{"updated_time", mut.UpdatedTime}}},
+		})
+		return err
+	case batch.OpCollectionPop:
+		_, err := x._mongo.Collection(_CollectionCollection).UpdateByID(ctx, mut.CollectionID, bson.D{
+			{"$pull", bson.D{{"items", mut.ItemID}}},
+			{"$set", bson.D{{"updated_time", mut.UpdatedTime}}},
+		})
+		return err
+	}
+	return nil
+}
+
+func (x *BatchRepo) applyNeo4j(tx neo4j.Transaction, mut *batch.Mutation) error {
+	var (
+		cypher string
+		params map[string]interface{}
+	)
+	switch mut.Type {
+	case batch.OpCreate:
+		cypher, params = _CreateAsteroidNodeCypher, asteroidNodeParams(mut.Asteroid)
+	case batch.OpUpdate:
+		// mirrors the fields the node keeps a copy of, null leaves them as they are.
+		cypher = "MATCH (a:Asteroid {id: $id}) " +
+			"SET a.hub = coalesce($hub, a.hub), a.title = coalesce($title, a.title), a.updatedTime = $updatedTime"
+		params = map[string]interface{}{
+			"id":          mut.AsteroidID.Hex(),
+			"hub":         nil,
+			"title":       nil,
+			"updatedTime": localDateTimeOf(mut.UpdatedTime),
+		}
+		if mut.Hub != nil {
+			params["hub"] = *mut.Hub
+		}
+		if mut.Title != nil {
+			params["title"] = *mut.Title
+		}
+	case batch.OpLink:
+		// removed links are kept for the history, so MERGE can't tell them apart.
+		cypher = "MATCH (from:Asteroid {id: $fromId}), (to:Asteroid {id: $toId}) " +
+			"WHERE NOT EXISTS { MATCH (from)-[r:REFER]->(to) WHERE r.removedTime IS NULL } " +
+			"CREATE (from)-[:REFER {createdTime: $time}]->(to)"
+		params = map[string]interface{}{
+			"fromId": mut.From.Hex(),
+			"toId":   mut.To.Hex(),
+			"time":   localDateTimeOf(mut.UpdatedTime),
+		}
+	case batch.OpUnlink:
+		cypher = "MATCH (:Asteroid {id: $fromId})-[r:REFER]->(:Asteroid {id: $toId}) " +
+			"WHERE r.removedTime IS NULL " +
+			"SET r.removedTime = $time"
+		params = map[string]interface{}{
+			"fromId": mut.From.Hex(),
+			"toId":   mut.To.Hex(),
+			"time":   localDateTimeOf(mut.UpdatedTime),
+		}
+	default:
+		return nil
+	}
+	result, err := tx.Run(cypher, params)
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume()
+	return err
+}
+
+// compile-time interface implementation check.
+var _ batch.Repo = (*MongoBatchRepo)(nil)
+
+// MongoBatchRepo applies batches to the links collection instead of Neo4j,
+// for the deployments running without it.
+type MongoBatchRepo struct {
+	*BatchRepo
+}
+
+func NewMongoBatchRepo(_mongo *mongo.Database) *MongoBatchRepo {
+	return &MongoBatchRepo{
+		BatchRepo: NewBatchRepo(_mongo, nil),
+	}
+}
+
+// Apply stages every mutation in a single Mongo transaction.
+//
+// Mongo transactions need a replica set deployment.
+func (x *MongoBatchRepo) Apply(ctx context.Context, muts []*batch.Mutation) error {
+	mongoSession, err := x._mongo.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer mongoSession.EndSession(ctx)
+
+	_, err = mongoSession.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		for _, mut := range muts {
+			if err := x.applyMongo(sessCtx, mut); err != nil {
+				return nil, err
+			}
+			if err := x.applyLinks(sessCtx, mut); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (x *MongoBatchRepo) applyLinks(ctx context.Context, mut *batch.Mutation) error {
+	var model mongo.WriteModel
+	switch mut.Type {
+	case batch.OpLink:
+		var from struct {
+			AuthorID primitive.ObjectID `bson:"author_id"`
+		}
+		err := x._mongo.Collection(_AsteroidCollection).FindOne(ctx, bson.D{{"_id", mut.From}}).Decode(&from)
+		if err != nil {
+			return err
+		}
+		model = linkModel(from.AuthorID, mut.From, mut.To, mut.UpdatedTime)
+	case batch.OpUnlink:
+		model = unlinkModel(mut.From, mut.To, mut.UpdatedTime)
+	default:
+		return nil
+	}
+	_, err := x._mongo.Collection(_LinkCollection).BulkWrite(ctx, []mongo.WriteModel{model})
+	return err
+}
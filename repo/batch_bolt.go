@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ProjectOort/oort-server/biz/batch"
+	"github.com/ProjectOort/oort-server/biz/collection"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ batch.Repo = (*BoltBatchRepo)(nil)
+
+type BoltBatchRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltBatchRepo(_bolt *bbolt.DB) *BoltBatchRepo {
+	return &BoltBatchRepo{_bolt: _bolt}
+}
+
+// Apply stages every mutation in a single write transaction.
+func (x *BoltBatchRepo) Apply(ctx context.Context, muts []*batch.Mutation) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		for _, mut := range muts {
+			if err := x.apply(tx, mut); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltBatchRepo) apply(tx *bbolt.Tx, mut *batch.Mutation) error {
+	switch mut.Type {
+	case batch.OpCreate:
+		return putBoltAsteroid(tx, mut.Asteroid)
+	case batch.OpUpdate:
+		ast, err := getBoltAsteroid(tx, mut.AsteroidID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+		ast.UpdatedTime = mut.UpdatedTime
+		if mut.Hub != nil {
+			ast.Hub = *mut.Hub
+		}
+		if mut.Title != nil {
+			ast.Title = *mut.Title
+		}
+		if mut.Content != nil {
+			ast.Content = *mut.Content
+		}
+		return putBoltAsteroid(tx, ast)
+	case batch.OpLink:
+		from, err := getBoltAsteroid(tx, mut.From)
+		if err != nil {
+			return err
+		}
+		return boltLink(tx, from.AuthorID, mut.From, mut.To, mut.UpdatedTime)
+	case batch.OpUnlink:
+		return boltUnlink(tx, mut.From, mut.To, mut.UpdatedTime)
+	case batch.OpCollectionPush:
+		return updateBoltCollection(tx, mut.CollectionID, func(c *collection.Collection) {
+			c.UpdatedTime = mut.UpdatedTime
+			for _, id := range c.Items {
+				if id == mut.ItemID {
+					return
+				}
+			}
+			c.Items = append(c.Items, mut.ItemID)
+		})
+	case batch.OpCollectionPop:
+		return updateBoltCollection(tx, mut.CollectionID, func(c *collection.Collection) {
+			c.Items = removeID(c.Items, mut.ItemID)
+			c.UpdatedTime = mut.UpdatedTime
+		})
+	}
+	return nil
+}
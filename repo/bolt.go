@@ -0,0 +1,335 @@
+package repo
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/search"
+	"github.com/ProjectOort/oort-server/biz/suggest"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The buckets of the embedded store, see conf.ModeEmbedded. Records are kept
+// as BSON under their object ID, so they share their encoding with Mongo.
+//
+// The embedded store serves a single person on a laptop, lookups by anything
+// else than an ID scan their bucket, except for the asteroids of an author,
+// the links of an asteroid, the terms of the search and the words of titles,
+// which are indexed.
+var (
+	_BoltAccount          = []byte("account")
+	_BoltAsteroid         = []byte("asteroid")
+	_BoltAsteroidByAuthor = []byte("asteroid_by_author") // author ID + asteroid ID
+	_BoltAsteroidHistory  = []byte("asteroid_history")
+	_BoltAsteroidStar     = []byte("asteroid_star") // account ID + asteroid ID
+	_BoltCollection       = []byte("collection")
+	_BoltReviewCard       = []byte("review_card")
+	_BoltComment          = []byte("comment")
+	_BoltGraphLayout      = []byte("graph_layout")
+	// _BoltLink keeps every link, removed ones included, as a linkDoc.
+	_BoltLink = []byte("links")
+	// _BoltLinkOut and _BoltLinkIn are the adjacency of the existing links,
+	// from ID + to ID and to ID + from ID respectively, both to the link ID.
+	_BoltLinkOut = []byte("link_out")
+	_BoltLinkIn  = []byte("link_in")
+	// _BoltTerm is the inverted index of the search, term + 0 + asteroid ID.
+	_BoltTerm = []byte("term")
+	// _BoltAsteroidTerms keeps the terms each asteroid is indexed under, so
+	// they can be dropped when it changes.
+	_BoltAsteroidTerms = []byte("asteroid_terms")
+	// _BoltTitle is the completion index of the titles of living asteroids,
+	// author ID + word suffix + 0 + asteroid ID.
+	_BoltTitle = []byte("title_suffix")
+	// _BoltTitleLegacy kept the word suffixes as they were written in the
+	// title, and is dropped for _BoltTitle to be built again.
+	_BoltTitleLegacy = []byte("title_prefix")
+)
+
+var _BoltBuckets = [][]byte{
+	_BoltAccount, _BoltAsteroid, _BoltAsteroidByAuthor, _BoltAsteroidHistory, _BoltAsteroidStar,
+	_BoltCollection, _BoltReviewCard, _BoltComment, _BoltGraphLayout,
+	_BoltLink, _BoltLinkOut, _BoltLinkIn, _BoltTerm, _BoltAsteroidTerms, _BoltTitle,
+}
+
+// OpenBolt opens the embedded store at path, creating the file and its buckets if missing.
+func OpenBolt(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range _BoltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if err := tx.DeleteBucket(_BoltTitleLegacy); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		// files written before the completion index existed get it built.
+		if k, _ := tx.Bucket(_BoltTitle).Cursor().First(); k != nil {
+			return nil
+		}
+		return boltEach(tx.Bucket(_BoltAsteroid), nil, func(_, v []byte) error {
+			var ast asteroid.Asteroid
+			if err := bson.Unmarshal(v, &ast); err != nil {
+				return err
+			}
+			return indexTitle(tx, nil, &ast)
+		})
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// boltGet decodes the record under the key. Services tell missing records by
+// mongo.ErrNoDocuments, whichever store is in use.
+func boltGet(b *bbolt.Bucket, key []byte, v interface{}) error {
+	data := b.Get(key)
+	if data == nil {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(data, v)
+}
+
+func boltPut(b *bbolt.Bucket, key []byte, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// boltEach calls fn with every record of the bucket whose key starts with
+// prefix, in key order, all of them for a nil prefix.
+func boltEach(b *bbolt.Bucket, prefix []byte, fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinKey(ids ...primitive.ObjectID) []byte {
+	key := make([]byte, 0, len(ids)*len(primitive.NilObjectID))
+	for _, id := range ids {
+		key = append(key, id[:]...)
+	}
+	return key
+}
+
+// keyID reads the i-th object ID of a key made by joinKey.
+func keyID(key []byte, i int) primitive.ObjectID {
+	var id primitive.ObjectID
+	copy(id[:], key[i*len(id):])
+	return id
+}
+
+// getBoltAsteroid reads the asteroid whatever its state.
+func getBoltAsteroid(tx *bbolt.Tx, id primitive.ObjectID) (*asteroid.Asteroid, error) {
+	ast := new(asteroid.Asteroid)
+	if err := boltGet(tx.Bucket(_BoltAsteroid), id[:], ast); err != nil {
+		return nil, err
+	}
+	return ast, nil
+}
+
+// putBoltAsteroid writes the asteroid along with its indexes.
+func putBoltAsteroid(tx *bbolt.Tx, ast *asteroid.Asteroid) error {
+	old, err := getBoltAsteroid(tx, ast.ID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err := indexTitle(tx, old, ast); err != nil {
+		return err
+	}
+	if err := boltPut(tx.Bucket(_BoltAsteroid), ast.ID[:], ast); err != nil {
+		return err
+	}
+	if err := tx.Bucket(_BoltAsteroidByAuthor).Put(joinKey(ast.AuthorID, ast.ID), nil); err != nil {
+		return err
+	}
+	return indexTerms(tx, ast)
+}
+
+// eachBoltAsteroid calls fn with every asteroid of the author, whatever its
+// state, in the order of their IDs.
+func eachBoltAsteroid(tx *bbolt.Tx, authorID primitive.ObjectID, fn func(*asteroid.Asteroid) error) error {
+	return boltEach(tx.Bucket(_BoltAsteroidByAuthor), authorID[:], func(k, _ []byte) error {
+		ast, err := getBoltAsteroid(tx, keyID(k, 1))
+		if err != nil {
+			return err
+		}
+		return fn(ast)
+	})
+}
+
+// termKey is the posting of the asteroid under the term. Terms never hold a
+// zero byte, which ends them.
+func termKey(term string, id primitive.ObjectID) []byte {
+	key := make([]byte, 0, len(term)+1+len(id))
+	key = append(key, term...)
+	key = append(key, 0)
+	return append(key, id[:]...)
+}
+
+// indexTerms replaces the postings of the asteroid by the terms of its title
+// and content.
+func indexTerms(tx *bbolt.Tx, ast *asteroid.Asteroid) error {
+	postings, docTerms := tx.Bucket(_BoltTerm), tx.Bucket(_BoltAsteroidTerms)
+
+	var old struct {
+		Terms []string `bson:"terms"`
+	}
+	if err := boltGet(docTerms, ast.ID[:], &old); err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	for _, term := range old.Terms {
+		if err := postings.Delete(termKey(term, ast.ID)); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, term := range suggest.Tokenize(ast.Title + "\n" + ast.Content) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for _, term := range terms {
+		if err := postings.Put(termKey(term, ast.ID), nil); err != nil {
+			return err
+		}
+	}
+	return boltPut(docTerms, ast.ID[:], bson.D{{"terms", terms}})
+}
+
+// titleKey is the entry of the asteroid under a word suffix of its title,
+// cut to search.MaxPrefixLength runes. Titles never hold a zero byte.
+func titleKey(authorID primitive.ObjectID, suffix string, id primitive.ObjectID) []byte {
+	if runes := []rune(suffix); len(runes) > search.MaxPrefixLength {
+		suffix = string(runes[:search.MaxPrefixLength])
+	}
+	key := make([]byte, 0, len(authorID)+len(suffix)+1+len(id))
+	key = append(key, authorID[:]...)
+	key = append(key, suffix...)
+	key = append(key, 0)
+	return append(key, id[:]...)
+}
+
+// indexTitle replaces the completion entries of the old version of the
+// asteroid, nil if there is none, by those of the new one.
+func indexTitle(tx *bbolt.Tx, old, ast *asteroid.Asteroid) error {
+	titles := tx.Bucket(_BoltTitle)
+	if old != nil && old.State {
+		for _, suffix := range search.WordSuffixes(old.Title) {
+			if err := titles.Delete(titleKey(old.AuthorID, suffix, old.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	if !ast.State {
+		return nil
+	}
+	for _, suffix := range search.WordSuffixes(ast.Title) {
+		if err := titles.Put(titleKey(ast.AuthorID, suffix, ast.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltLink creates the link unless it already exists.
+func boltLink(tx *bbolt.Tx, authorID, from, to primitive.ObjectID, createdTime time.Time) error {
+	out := tx.Bucket(_BoltLinkOut)
+	if out.Get(joinKey(from, to)) != nil {
+		return nil
+	}
+	doc := linkDoc{
+		ID:          primitive.NewObjectID(),
+		AuthorID:    authorID,
+		From:        from,
+		To:          to,
+		Ends:        []primitive.ObjectID{from, to},
+		CreatedTime: createdTime,
+	}
+	if err := boltPut(tx.Bucket(_BoltLink), doc.ID[:], &doc); err != nil {
+		return err
+	}
+	if err := out.Put(joinKey(from, to), doc.ID[:]); err != nil {
+		return err
+	}
+	return tx.Bucket(_BoltLinkIn).Put(joinKey(to, from), doc.ID[:])
+}
+
+// boltUnlink removes the link if it exists. Like in the other stores, the link
+// itself is kept for the history.
+func boltUnlink(tx *bbolt.Tx, from, to primitive.ObjectID, removedTime time.Time) error {
+	out := tx.Bucket(_BoltLinkOut)
+	if out.Get(joinKey(from, to)) == nil {
+		return nil
+	}
+	// values are only valid until the next write, the ID is needed past it.
+	linkID := append([]byte(nil), out.Get(joinKey(from, to))...)
+	links := tx.Bucket(_BoltLink)
+	var doc linkDoc
+	if err := boltGet(links, linkID, &doc); err != nil {
+		return err
+	}
+	doc.RemovedTime = &removedTime
+	if err := boltPut(links, linkID, &doc); err != nil {
+		return err
+	}
+	if err := out.Delete(joinKey(from, to)); err != nil {
+		return err
+	}
+	return tx.Bucket(_BoltLinkIn).Delete(joinKey(to, from))
+}
+
+// boltLinked lists the other end of the existing links of the asteroid.
+// out follows the links from it, otherwise it follows them back.
+func boltLinked(tx *bbolt.Tx, id primitive.ObjectID, out bool) ([]primitive.ObjectID, error) {
+	bucket := _BoltLinkIn
+	if out {
+		bucket = _BoltLinkOut
+	}
+	linked := make([]primitive.ObjectID, 0)
+	err := boltEach(tx.Bucket(bucket), id[:], func(k, _ []byte) error {
+		linked = append(linked, keyID(k, 1))
+		return nil
+	})
+	return linked, err
+}
+
+// eachBoltLink calls fn with every link of the author, removed ones included.
+func eachBoltLink(tx *bbolt.Tx, authorID primitive.ObjectID, fn func(*linkDoc) error) error {
+	return boltEach(tx.Bucket(_BoltLink), nil, func(_, v []byte) error {
+		var doc linkDoc
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return err
+		}
+		if doc.AuthorID != authorID {
+			return nil
+		}
+		return fn(&doc)
+	})
+}
+
+// linkExistsAt tells whether the link exists at asOf, or now when asOf is zero.
+func linkExistsAt(doc *linkDoc, asOf time.Time) bool {
+	if asOf.IsZero() {
+		return doc.RemovedTime == nil
+	}
+	return !doc.CreatedTime.After(asOf) && (doc.RemovedTime == nil || doc.RemovedTime.After(asOf))
+}
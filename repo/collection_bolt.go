@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ProjectOort/oort-server/biz/collection"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ collection.Repo = (*BoltCollectionRepo)(nil)
+
+type BoltCollectionRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltCollectionRepo(_bolt *bbolt.DB) *BoltCollectionRepo {
+	return &BoltCollectionRepo{_bolt: _bolt}
+}
+
+func (x *BoltCollectionRepo) Get(ctx context.Context, collectionID primitive.ObjectID) (*collection.Collection, error) {
+	var c collection.Collection
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(_BoltCollection), collectionID[:], &c)
+	})
+	return &c, err
+}
+
+func (x *BoltCollectionRepo) Create(ctx context.Context, col *collection.Collection) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(_BoltCollection), col.ID[:], col)
+	})
+}
+
+func (x *BoltCollectionRepo) Update(ctx context.Context, col *collection.Collection) (*collection.Collection, error) {
+	return nil, x.update(col.ID, func(c *collection.Collection) {
+		c.UpdatedTime = col.UpdatedTime
+		if col.Name != "" {
+			c.Name = col.Name
+		}
+		if col.Description != "" {
+			c.Description = col.Description
+		}
+	})
+}
+
+func (x *BoltCollectionRepo) Delete(ctx context.Context, collectionID primitive.ObjectID) error {
+	return x.update(collectionID, func(c *collection.Collection) {
+		c.State = false
+	})
+}
+
+// update applies fn to the collection, if it exists.
+func (x *BoltCollectionRepo) update(collectionID primitive.ObjectID, fn func(*collection.Collection)) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return updateBoltCollection(tx, collectionID, fn)
+	})
+}
+
+func updateBoltCollection(tx *bbolt.Tx, collectionID primitive.ObjectID, fn func(*collection.Collection)) error {
+	bucket := tx.Bucket(_BoltCollection)
+	var c collection.Collection
+	if err := boltGet(bucket, collectionID[:], &c); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	fn(&c)
+	return boltPut(bucket, collectionID[:], &c)
+}
+
+func (x *BoltCollectionRepo) List(ctx context.Context, ownerID primitive.ObjectID) ([]*collection.Collection, error) {
+	cols := make([]*collection.Collection, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return boltEach(tx.Bucket(_BoltCollection), nil, func(_, v []byte) error {
+			var col collection.Collection
+			if err := bson.Unmarshal(v, &col); err != nil {
+				return err
+			}
+			if col.OwnerID == ownerID && col.State {
+				col.Items = nil
+				cols = append(cols, &col)
+			}
+			return nil
+		})
+	})
+	return cols, err
+}
+
+func (x *BoltCollectionRepo) PushItem(ctx context.Context, collectionID primitive.ObjectID, itemID primitive.ObjectID) error {
+	return x.update(collectionID, func(c *collection.Collection) {
+		c.Items = append(c.Items, itemID)
+	})
+}
+
+func (x *BoltCollectionRepo) PopItem(ctx context.Context, collectionID primitive.ObjectID, itemID primitive.ObjectID) error {
+	return x.update(collectionID, func(c *collection.Collection) {
+		c.Items = removeID(c.Items, itemID)
+	})
+}
+
+// removeID drops every occurrence of id, like $pull.
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	kept := ids[:0]
+	for _, v := range ids {
+		if v != id {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func (x *BoltCollectionRepo) ListItems(ctx context.Context, collectionID primitive.ObjectID) ([]*collection.Item, error) {
+	items := make([]*collection.Item, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		var col collection.Collection
+		if err := boltGet(tx.Bucket(_BoltCollection), collectionID[:], &col); err != nil {
+			return err
+		}
+		for _, id := range col.Items {
+			ast, err := getBoltAsteroid(tx, id)
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ast.Content = ""
+			items = append(items, &collection.Item{Asteroid: *ast})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
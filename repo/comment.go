@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/comment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compile-time interface implementation check.
+var _ comment.Repo = (*CommentRepo)(nil)
+
+const (
+	_CommentCollection = "comment"
+)
+
+type CommentRepo struct {
+	_mongo *mongo.Database
+}
+
+func NewCommentRepo(_mongo *mongo.Database) *CommentRepo {
+	return &CommentRepo{_mongo: _mongo}
+}
+
+func (x *CommentRepo) Create(ctx context.Context, cmt *comment.Comment) error {
+	_, err := x._mongo.Collection(_CommentCollection).InsertOne(ctx, cmt)
+	return err
+}
+
+func (x *CommentRepo) UpdateContent(ctx context.Context, cmt *comment.Comment) error {
+	_, err := x._mongo.Collection(_CommentCollection).UpdateByID(ctx, cmt.ID, bson.D{{
+		"$set", bson.D{
+			{"content", cmt.Content},
+			{"updated_time", cmt.UpdatedTime},
+		},
+	}})
+	return err
+}
+
+func (x *CommentRepo) UpdateResolved(ctx context.Context, cmt *comment.Comment) error {
+	_, err := x._mongo.Collection(_CommentCollection).UpdateByID(ctx, cmt.ID, bson.D{{
+		"$set", bson.D{
+			{"resolved", cmt.Resolved},
+			{"resolver_id", cmt.ResolverID},
+			{"resolved_time", cmt.ResolvedTime},
+			{"updated_time", cmt.UpdatedTime},
+		},
+	}})
+	return err
+}
+
+func (x *CommentRepo) Delete(ctx context.Context, cmtID primitive.ObjectID) error {
+	_, err := x._mongo.Collection(_CommentCollection).UpdateMany(ctx, bson.D{
+		{"$or", bson.A{
+			bson.D{{"_id", cmtID}},
+			bson.D{{"parent_id", cmtID}},
+		}},
+	}, bson.D{{
+		"$set", bson.D{
+			{"state", false},
+			{"updated_time", time.Now()},
+		},
+	}})
+	return err
+}
+
+func (x *CommentRepo) Get(ctx context.Context, cmtID primitive.ObjectID) (*comment.Comment, error) {
+	cmt := new(comment.Comment)
+	err := x._mongo.Collection(_CommentCollection).FindOne(ctx, bson.D{
+		{"_id", cmtID},
+		{"state", true},
+	}).Decode(cmt)
+	return cmt, err
+}
+
+func (x *CommentRepo) ListThreads(ctx context.Context, astID primitive.ObjectID, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	filter := bson.D{
+		{"asteroid_id", astID},
+		{"parent_id", nil},
+		{"state", true},
+	}
+	if opts.Resolved != nil {
+		filter = append(filter, bson.E{Key: "resolved", Value: *opts.Resolved})
+	}
+	return x.list(ctx, filter, opts)
+}
+
+func (x *CommentRepo) ListReplies(ctx context.Context, threadID primitive.ObjectID, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	return x.list(ctx, bson.D{
+		{"parent_id", threadID},
+		{"state", true},
+	}, opts)
+}
+
+func (x *CommentRepo) list(ctx context.Context, filter bson.D, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	total, err := x._mongo.Collection(_CommentCollection).CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := x._mongo.Collection(_CommentCollection).Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{"created_time", 1}}).
+			SetSkip(opts.Skip()).
+			SetLimit(int64(opts.Size)))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer result.Close(ctx)
+
+	cmts := make([]*comment.Comment, 0)
+	for result.Next(ctx) {
+		var cmt comment.Comment
+		if err := result.Decode(&cmt); err != nil {
+			return nil, 0, err
+		}
+		cmts = append(cmts, &cmt)
+	}
+	return cmts, total, result.Err()
+}
+
+func (x *CommentRepo) CountReplies(ctx context.Context, threadIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	result, err := x._mongo.Collection(_CommentCollection).Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.D{
+			{"parent_id", bson.D{{"$in", threadIDs}}},
+			{"state", true},
+		}}},
+		{{"$group", bson.D{
+			{"_id", "$parent_id"},
+			{"count", bson.D{{"$sum", 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	counts := make(map[primitive.ObjectID]int64, len(threadIDs))
+	for result.Next(ctx) {
+		var row struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int64              `bson:"count"`
+		}
+		if err := result.Decode(&row); err != nil {
+			return nil, err
+		}
+		counts[row.ID] = row.Count
+	}
+	return counts, result.Err()
+}
@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/comment"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ comment.Repo = (*BoltCommentRepo)(nil)
+
+type BoltCommentRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltCommentRepo(_bolt *bbolt.DB) *BoltCommentRepo {
+	return &BoltCommentRepo{_bolt: _bolt}
+}
+
+func (x *BoltCommentRepo) Create(ctx context.Context, cmt *comment.Comment) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(_BoltComment), cmt.ID[:], cmt)
+	})
+}
+
+func (x *BoltCommentRepo) UpdateContent(ctx context.Context, cmt *comment.Comment) error {
+	return x.update(func(c *comment.Comment) bool {
+		if c.ID != cmt.ID {
+			return false
+		}
+		c.Content = cmt.Content
+		c.UpdatedTime = cmt.UpdatedTime
+		return true
+	})
+}
+
+func (x *BoltCommentRepo) UpdateResolved(ctx context.Context, cmt *comment.Comment) error {
+	return x.update(func(c *comment.Comment) bool {
+		if c.ID != cmt.ID {
+			return false
+		}
+		c.Resolved = cmt.Resolved
+		c.ResolverID = cmt.ResolverID
+		c.ResolvedTime = cmt.ResolvedTime
+		c.UpdatedTime = cmt.UpdatedTime
+		return true
+	})
+}
+
+func (x *BoltCommentRepo) Delete(ctx context.Context, cmtID primitive.ObjectID) error {
+	now := time.Now()
+	return x.update(func(c *comment.Comment) bool {
+		if c.ID != cmtID && (c.ParentID == nil || *c.ParentID != cmtID) {
+			return false
+		}
+		c.State = false
+		c.UpdatedTime = now
+		return true
+	})
+}
+
+// update writes back the comments fn changed, fn tells whether it did.
+func (x *BoltCommentRepo) update(fn func(*comment.Comment) bool) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(_BoltComment)
+		changed := make([]*comment.Comment, 0)
+		err := boltEach(bucket, nil, func(_, v []byte) error {
+			var cmt comment.Comment
+			if err := bson.Unmarshal(v, &cmt); err != nil {
+				return err
+			}
+			if fn(&cmt) {
+				changed = append(changed, &cmt)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// writing while iterating would move the cursor.
+		for _, cmt := range changed {
+			if err := boltPut(bucket, cmt.ID[:], cmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (x *BoltCommentRepo) Get(ctx context.Context, cmtID primitive.ObjectID) (*comment.Comment, error) {
+	cmt := new(comment.Comment)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		if err := boltGet(tx.Bucket(_BoltComment), cmtID[:], cmt); err != nil {
+			return err
+		}
+		if !cmt.State {
+			return mongo.ErrNoDocuments
+		}
+		return nil
+	})
+	return cmt, err
+}
+
+func (x *BoltCommentRepo) ListThreads(ctx context.Context, astID primitive.ObjectID, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	return x.list(func(c *comment.Comment) bool {
+		return c.AsteroidID == astID && c.ParentID == nil &&
+			(opts.Resolved == nil || c.Resolved == *opts.Resolved)
+	}, opts)
+}
+
+func (x *BoltCommentRepo) ListReplies(ctx context.Context, threadID primitive.ObjectID, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	return x.list(func(c *comment.Comment) bool {
+		return c.ParentID != nil && *c.ParentID == threadID
+	}, opts)
+}
+
+// list returns a page of the living comments matching, oldest first, and counts all of them.
+func (x *BoltCommentRepo) list(match func(*comment.Comment) bool, opts *comment.ListOptions) ([]*comment.Comment, int64, error) {
+	cmts, err := x.find(match)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(cmts, func(i, j int) bool { return cmts[i].CreatedTime.Before(cmts[j].CreatedTime) })
+
+	total := int64(len(cmts))
+	skip := opts.Skip()
+	if skip > total {
+		skip = total
+	}
+	cmts = cmts[skip:]
+	if opts.Size > 0 && len(cmts) > opts.Size {
+		cmts = cmts[:opts.Size]
+	}
+	return cmts, total, nil
+}
+
+func (x *BoltCommentRepo) CountReplies(ctx context.Context, threadIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	threads := make(map[primitive.ObjectID]bool, len(threadIDs))
+	for _, id := range threadIDs {
+		threads[id] = true
+	}
+	replies, err := x.find(func(c *comment.Comment) bool {
+		return c.ParentID != nil && threads[*c.ParentID]
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[primitive.ObjectID]int64, len(threadIDs))
+	for _, reply := range replies {
+		counts[*reply.ParentID]++
+	}
+	return counts, nil
+}
+
+// find lists the living comments matching.
+func (x *BoltCommentRepo) find(match func(*comment.Comment) bool) ([]*comment.Comment, error) {
+	cmts := make([]*comment.Comment, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return boltEach(tx.Bucket(_BoltComment), nil, func(_, v []byte) error {
+			var cmt comment.Comment
+			if err := bson.Unmarshal(v, &cmt); err != nil {
+				return err
+			}
+			if cmt.State && match(&cmt) {
+				cmts = append(cmts, &cmt)
+			}
+			return nil
+		})
+	})
+	return cmts, err
+}
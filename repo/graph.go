@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
 
 	"github.com/ProjectOort/oort-server/biz/asteroid"
 	"github.com/ProjectOort/oort-server/biz/graph"
@@ -13,6 +15,25 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// compile-time interface implementation check.
+var _ graph.Repo = (*GraphRepo)(nil)
+
+const (
+	_GraphLayoutCollection = "graph_layout"
+	// _StreamBatchSize is how many records a streamed graph reads at once from each store.
+	_StreamBatchSize = 500
+)
+
+func graphNode(ast *asteroid.Asteroid) graph.Node {
+	return graph.Node{
+		ID:          ast.ID.Hex(),
+		Hub:         ast.Hub,
+		Title:       ast.Title,
+		CreatedTime: ast.CreatedTime,
+		UpdatedTime: ast.UpdatedTime,
+	}
+}
+
 type GraphRepo struct {
 	_mongo *mongo.Database
 	_neo4j neo4j.Driver
@@ -25,145 +46,559 @@ func NewGraphRepo(_mongo *mongo.Database, _neo4j neo4j.Driver) *GraphRepo {
 	}
 }
 
-func (x *GraphRepo) GetGraphByAsteroidID(ctx context.Context, astID primitive.ObjectID, depth int) (*graph.Graph, error) {
+// Links are never deleted, unlinking sets their removedTime instead. A link r
+// exists at $asOf, or now when $asOf is null, when it was created no later and
+// removed after. Links created before their time was recorded always existed.
+const _LinkExists = "(r.removedTime IS NULL OR ($asOf IS NOT NULL AND r.removedTime > $asOf)) AND " +
+	"($asOf IS NULL OR r.createdTime IS NULL OR r.createdTime <= $asOf)"
+
+// asOfParam is the $asOf parameter of the time, null for the zero time.
+func asOfParam(asOf time.Time) interface{} {
+	if asOf.IsZero() {
+		return nil
+	}
+	return localDateTimeOf(asOf)
+}
+
+// localDateTimeOf keeps the wall clock of the time in the local time zone,
+// whatever zone it comes in, so times from clients or decoded from Mongo in
+// UTC compare as the same instants as those of time.Now.
+func localDateTimeOf(t time.Time) neo4j.LocalDateTime {
+	return neo4j.LocalDateTimeOf(t.In(time.Local))
+}
+
+// localDateTime reads back a time stored with localDateTimeOf, which only
+// keeps the wall clock of the local time zone.
+func localDateTime(v interface{}) time.Time {
+	ldt, ok := v.(neo4j.LocalDateTime)
+	if !ok {
+		return time.Time{}
+	}
+	t := ldt.Time()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+var _NeighborCyphers = map[graph.Direction]string{
+	graph.DirectionOut:  "MATCH (a:Asteroid)-[r:REFER]->(b:Asteroid) ",
+	graph.DirectionIn:   "MATCH (a:Asteroid)<-[r:REFER]-(b:Asteroid) ",
+	graph.DirectionBoth: "MATCH (a:Asteroid)-[r:REFER]-(b:Asteroid) ",
+}
+
+func (x *GraphRepo) GetGraphByAsteroidID(ctx context.Context, accID primitive.ObjectID, q *graph.NeighborhoodQuery) (*graph.Graph, error) {
+	return x.expand(ctx, accID, []string{q.AsteroidID.Hex()}, q.Depth, q.Direction, q.Limit, q.AsOf)
+}
+
+func (x *GraphRepo) GetGraphByAsteroidIDs(ctx context.Context, accID primitive.ObjectID, ids []primitive.ObjectID, q *graph.CollectionQuery) (*graph.Graph, error) {
+	seeds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		seeds = append(seeds, id.Hex())
+	}
+	return x.expand(ctx, accID, seeds, q.Hops, q.Direction, q.Limit, time.Time{})
+}
+
+// expand walks breadth first from the seeds, which are at distance zero, and
+// returns the visited nodes along with the links among them.
+func (x *GraphRepo) expand(ctx context.Context, accID primitive.ObjectID, seeds []string, depth int, direction graph.Direction, limit int, asOf time.Time) (*graph.Graph, error) {
 	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close()
 
-	cypher := fmt.Sprintf("MATCH p = (:Asteroid {id: $id})-[:REFER*1..%d]-(:Asteroid) RETURN p", depth)
+	// every hop only asks for the unvisited neighbors of the frontier, so the
+	// work stays proportional to the nodes returned instead of the paths.
+	cypher := _NeighborCyphers[direction] +
+		"WHERE a.id IN $frontier AND NOT b.id IN $visited AND b.authorId = $authorId AND b.state = true " +
+		"AND ($asOf IS NULL OR b.createdTime <= $asOf) AND " + _LinkExists + " " +
+		"RETURN DISTINCT b.id AS id ORDER BY id LIMIT $limit"
+	asOfValue := asOfParam(asOf)
 
-	result, err := session.Run(cypher, map[string]interface{}{
-		"id":    astID.Hex(),
-		"depth": depth,
-	})
+	truncated := false
+	if len(seeds) > limit {
+		seeds, truncated = seeds[:limit], true
+	}
+	ids := append([]string{}, seeds...)
+	distances := make(map[string]int, len(seeds))
+	for _, id := range seeds {
+		distances[id] = 0
+	}
+	frontier := seeds
+	for hop := 1; hop <= depth && len(frontier) != 0 && !truncated; hop++ {
+		// asks for one more node than fits, to know whether any was left out.
+		remaining := limit - len(ids)
+		result, err := session.Run(cypher, map[string]interface{}{
+			"frontier": frontier,
+			"visited":  ids,
+			"authorId": accID.Hex(),
+			"limit":    remaining + 1,
+			"asOf":     asOfValue,
+		})
+		if err != nil {
+			return nil, err
+		}
+		next := make([]string, 0)
+		for result.Next() {
+			_id_, _ := result.Record().Get("id")
+			next = append(next, _id_.(string))
+		}
+		if err := result.Err(); err != nil {
+			return nil, err
+		}
+		if len(next) > remaining {
+			next = next[:remaining]
+			truncated = true
+		}
+		for _, id := range next {
+			distances[id] = hop
+			ids = append(ids, id)
+		}
+		frontier = next
+	}
+
+	linkCypher := "MATCH (a:Asteroid)-[r:REFER]->(b:Asteroid) " +
+		"WHERE a.id IN $ids AND b.id IN $ids AND " + _LinkExists + " " +
+		"RETURN a.id AS source, b.id AS target, r.createdTime AS createdTime"
+	linkResult, err := session.Run(linkCypher, map[string]interface{}{"ids": ids, "asOf": asOfValue})
 	if err != nil {
 		return nil, err
 	}
+	g := graph.Graph{Links: make([]graph.Link, 0), Truncated: truncated}
+	if g.Links, err = collectLinks(linkResult); err != nil {
+		return nil, err
+	}
 
-	var g graph.Graph
-	nodeSet := make(map[int64]primitive.ObjectID)
-	type linkPair struct {
-		source int64
-		target int64
+	if g.Nodes, err = listNodes(session, ids); err != nil {
+		return nil, err
 	}
-	linkSet := make(map[linkPair]struct{})
+	for i := range g.Nodes {
+		distance := distances[g.Nodes[i].ID]
+		g.Nodes[i].Distance = &distance
+	}
+	return &g, nil
+}
 
-	for result.Next() {
-		_p, _ := result.Record().Get("p")
-		p := _p.(neo4j.Path)
-		for _, node := range p.Nodes {
-			idHex, err := primitive.ObjectIDFromHex(node.Props["id"].(string))
-			if err != nil {
-				return nil, err
+// _AccountNodesCypher matches the account's living asteroids that existed at
+// $asOf, or now when $asOf is null.
+const _AccountNodesCypher = "MATCH (a:Asteroid) " +
+	"WHERE a.authorId = $authorId AND a.state = true AND ($asOf IS NULL OR a.createdTime <= $asOf) " +
+	"RETURN a ORDER BY a.createdTime, a.id"
+
+func (x *GraphRepo) GetFullGraph(ctx context.Context, accID primitive.ObjectID, asOf time.Time) (*graph.Graph, error) {
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
+
+	params := map[string]interface{}{
+		"authorId": accID.Hex(),
+		"asOf":     asOfParam(asOf),
+	}
+	nodeResult, err := session.Run(_AccountNodesCypher, params)
+	if err != nil {
+		return nil, err
+	}
+	asts, err := collectAsteroids(nodeResult, "a")
+	if err != nil {
+		return nil, err
+	}
+	g := graph.Graph{Nodes: make([]graph.Node, 0, len(asts))}
+	for _, ast := range asts {
+		g.Nodes = append(g.Nodes, graphNode(ast))
+	}
+
+	cypher := "MATCH (a1:Asteroid)-[r:REFER]->(a2:Asteroid) " +
+		"WHERE a1.authorId=$authorId AND a2.authorId=$authorId AND " + _LinkExists + " " +
+		"RETURN a1.id AS source, a2.id AS target, r.createdTime AS createdTime"
+
+	linkResult, err := session.Run(cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	if g.Links, err = collectLinks(linkResult); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (x *GraphRepo) StreamFullGraph(ctx context.Context, accID primitive.ObjectID, v graph.Visitor) error {
+	// a session only streams one result at a time, so nodes and links get their own.
+	nodeSession := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead, FetchSize: _StreamBatchSize})
+	defer nodeSession.Close()
+	nodeResult, err := nodeSession.Run(_AccountNodesCypher, map[string]interface{}{
+		"authorId": accID.Hex(),
+		"asOf":     nil,
+	})
+	if err != nil {
+		return err
+	}
+
+	linkSession := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead, FetchSize: _StreamBatchSize})
+	defer linkSession.Close()
+
+	cypher := "MATCH (a1:Asteroid)-[r:REFER]->(a2:Asteroid) " +
+		"WHERE a1.authorId = $authorId AND a2.authorId = $authorId AND a1.state = true AND a2.state = true " +
+		"AND r.removedTime IS NULL " +
+		"RETURN a1.id AS source, a2.id AS target, r.createdTime AS createdTime"
+	linkResult, err := linkSession.Run(cypher, map[string]interface{}{"authorId": accID.Hex()})
+	if err != nil {
+		return err
+	}
+
+	// takes one record from each side in turn, both are fetched in batches.
+	nodesDone, linksDone := false, false
+	for !nodesDone || !linksDone {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !nodesDone {
+			if nodeResult.Next() {
+				_a_, _ := nodeResult.Record().Get("a")
+				if err := v.VisitNode(graphNode(nodeAsteroid(_a_.(neo4j.Node)))); err != nil {
+					return err
+				}
+			} else if err := nodeResult.Err(); err != nil {
+				return err
+			} else {
+				nodesDone = true
 			}
-			nodeSet[node.Id] = idHex
 		}
-		for _, rel := range p.Relationships {
-			linkSet[linkPair{source: rel.StartId, target: rel.EndId}] = struct{}{}
+		if !linksDone {
+			if linkResult.Next() {
+				record := linkResult.Record()
+				_source_, _ := record.Get("source")
+				_target_, _ := record.Get("target")
+				_createdTime_, _ := record.Get("createdTime")
+				err := v.VisitLink(graph.Link{
+					Source:      _source_.(string),
+					Target:      _target_.(string),
+					CreatedTime: localDateTime(_createdTime_),
+				})
+				if err != nil {
+					return err
+				}
+			} else if err := linkResult.Err(); err != nil {
+				return err
+			} else {
+				linksDone = true
+			}
 		}
 	}
+	return nil
+}
 
-	for link := range linkSet {
-		g.Links = append(g.Links,
-			graph.Link{
-				Source: nodeSet[link.source].Hex(),
-				Target: nodeSet[link.target].Hex(),
-			},
-		)
+// collectLinks reads the source, target and createdTime columns of every record.
+func collectLinks(result neo4j.Result) ([]graph.Link, error) {
+	links := make([]graph.Link, 0)
+	for result.Next() {
+		record := result.Record()
+		_source_, _ := record.Get("source")
+		_target_, _ := record.Get("target")
+		_createdTime_, _ := record.Get("createdTime")
+		links = append(links, graph.Link{
+			Source:      _source_.(string),
+			Target:      _target_.(string),
+			CreatedTime: localDateTime(_createdTime_),
+		})
 	}
+	return links, result.Err()
+}
+
+func (x *GraphRepo) ListEvents(ctx context.Context, accID primitive.ObjectID) ([]graph.Event, error) {
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
 
-	ids := make([]primitive.ObjectID, 0, len(nodeSet))
-	for _, id := range nodeSet {
-		ids = append(ids, id)
+	nodeResult, err := session.Run("MATCH (a:Asteroid) WHERE a.authorId = $authorId AND a.state = true "+
+		"RETURN a.createdTime AS createdTime", map[string]interface{}{"authorId": accID.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]graph.Event, 0)
+	for nodeResult.Next() {
+		_createdTime_, _ := nodeResult.Record().Get("createdTime")
+		events = append(events, graph.Event{Kind: graph.EventNodeCreated, Time: localDateTime(_createdTime_)})
+	}
+	if err := nodeResult.Err(); err != nil {
+		return nil, err
 	}
 
-	mongoResult, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{{
-		"_id", bson.D{{
-			"$in", ids,
-		}},
-	}})
+	// links created before their time was recorded are dated after their latest end.
+	cypher := "MATCH (a:Asteroid)-[r:REFER]->(b:Asteroid) " +
+		"WHERE a.authorId = $authorId AND b.authorId = $authorId AND a.state = true AND b.state = true " +
+		"RETURN coalesce(r.createdTime, CASE WHEN a.createdTime > b.createdTime THEN a.createdTime ELSE b.createdTime END) AS createdTime, " +
+		"r.removedTime AS removedTime"
+	linkResult, err := session.Run(cypher, map[string]interface{}{"authorId": accID.Hex()})
 	if err != nil {
 		return nil, err
 	}
+	for linkResult.Next() {
+		_createdTime_, _ := linkResult.Record().Get("createdTime")
+		_removedTime_, _ := linkResult.Record().Get("removedTime")
+		events = append(events, graph.Event{Kind: graph.EventLinkCreated, Time: localDateTime(_createdTime_)})
+		if _removedTime_ != nil {
+			events = append(events, graph.Event{Kind: graph.EventLinkRemoved, Time: localDateTime(_removedTime_)})
+		}
+	}
+	return events, linkResult.Err()
+}
+
+var _HygieneConditions = map[graph.HygieneKind]string{
+	graph.HygieneOrphan: "NOT EXISTS { MATCH (a)-[r:REFER]-() WHERE r.removedTime IS NULL }",
+	graph.HygieneDeadEnd: "EXISTS { MATCH (a)<-[r:REFER]-() WHERE r.removedTime IS NULL } AND " +
+		"NOT EXISTS { MATCH (a)-[r:REFER]->() WHERE r.removedTime IS NULL }",
+	// $reachable is listed by reachableFromHubs beforehand.
+	graph.HygieneUnreachable: "NOT a.id IN $reachable",
+	graph.HygieneEmptyHub:    "a.hub = true AND NOT EXISTS { MATCH (a)-[r:REFER]->() WHERE r.removedTime IS NULL }",
+}
+
+func (x *GraphRepo) ListHygiene(ctx context.Context, accID primitive.ObjectID, kind graph.HygieneKind, skip, limit int) ([]graph.Node, int64, error) {
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
 
-	for mongoResult.Next(ctx) {
-		var ast asteroid.Asteroid
-		err := mongoResult.Decode(&ast)
+	match := "MATCH (a:Asteroid) " +
+		"WHERE a.authorId = $authorId AND a.state = true AND " + _HygieneConditions[kind] + " "
+	params := map[string]interface{}{
+		"authorId": accID.Hex(),
+		"skip":     skip,
+		"limit":    limit,
+	}
+	if kind == graph.HygieneUnreachable {
+		reachable, err := reachableFromHubs(session, accID)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		g.Nodes = append(g.Nodes, graph.Node{
-			ID:    ast.ID.Hex(),
-			Hub:   ast.Hub,
-			Title: ast.Title,
-		})
+		params["reachable"] = reachable
 	}
 
-	if len(g.Nodes) == 0 {
-		ast := new(asteroid.Asteroid)
-		err := x._mongo.Collection("asteroid").FindOne(ctx, bson.D{
-			{"_id", astID},
-			{"state", true},
-		}).Decode(&ast)
+	countResult, err := session.Run(match+"RETURN count(a) AS total", params)
+	if err != nil {
+		return nil, 0, err
+	}
+	countRecord, err := countResult.Single()
+	if err != nil {
+		return nil, 0, err
+	}
+	_total_, _ := countRecord.Get("total")
+	total := _total_.(int64)
+
+	pageResult, err := session.Run(match+"RETURN a ORDER BY a.createdTime, a.id SKIP $skip LIMIT $limit", params)
+	if err != nil {
+		return nil, 0, err
+	}
+	asts, err := collectAsteroids(pageResult, "a")
+	if err != nil {
+		return nil, 0, err
+	}
+	nodes := make([]graph.Node, 0, len(asts))
+	for _, ast := range asts {
+		nodes = append(nodes, graphNode(ast))
+	}
+	return nodes, total, nil
+}
+
+// reachableFromHubs lists the living asteroids the hubs of the account lead to,
+// hubs included, walking the links one hop at a time like graph.FindHygiene
+// does, so every asteroid is visited once.
+func reachableFromHubs(session neo4j.Session, accID primitive.ObjectID) ([]string, error) {
+	hubResult, err := session.Run("MATCH (h:Asteroid) "+
+		"WHERE h.authorId = $authorId AND h.state = true AND h.hub = true "+
+		"RETURN h.id AS id", map[string]interface{}{"authorId": accID.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	frontier := make([]string, 0)
+	for hubResult.Next() {
+		_id_, _ := hubResult.Record().Get("id")
+		frontier = append(frontier, _id_.(string))
+	}
+	if err := hubResult.Err(); err != nil {
+		return nil, err
+	}
+
+	cypher := "MATCH (a:Asteroid)-[r:REFER]->(b:Asteroid) " +
+		"WHERE a.id IN $frontier AND NOT b.id IN $visited AND b.authorId = $authorId AND b.state = true " +
+		"AND r.removedTime IS NULL " +
+		"RETURN DISTINCT b.id AS id"
+	visited := append([]string{}, frontier...)
+	for len(frontier) != 0 {
+		result, err := session.Run(cypher, map[string]interface{}{
+			"frontier": frontier,
+			"visited":  visited,
+			"authorId": accID.Hex(),
+		})
 		if err != nil {
 			return nil, err
 		}
-		g.Nodes = append(g.Nodes, graph.Node{
-			ID:    ast.ID.Hex(),
-			Hub:   ast.Hub,
-			Title: ast.Title,
-		})
+		next := make([]string, 0)
+		for result.Next() {
+			_id_, _ := result.Record().Get("id")
+			next = append(next, _id_.(string))
+		}
+		if err := result.Err(); err != nil {
+			return nil, err
+		}
+		visited = append(visited, next...)
+		frontier = next
 	}
-	return &g, nil
+	return visited, nil
 }
 
-func (x *GraphRepo) GetFullGraph(ctx context.Context, accID primitive.ObjectID) (*graph.Graph, error) {
-	nodeResult, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
-		{"author_id", accID},
-		{"state", true},
-	}, options.Find().SetProjection(bson.D{
-		{"content", 0},
-	}))
+func (x *GraphRepo) GetHubGraph(ctx context.Context, accID primitive.ObjectID) (*graph.Graph, error) {
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
+
+	hubResult, err := session.Run("MATCH (h:Asteroid) "+
+		"WHERE h.authorId = $authorId AND h.state = true AND h.hub = true "+
+		"RETURN h ORDER BY h.createdTime, h.id", map[string]interface{}{"authorId": accID.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	hubs, err := collectAsteroids(hubResult, "h")
+	if err != nil {
+		return nil, err
+	}
+
+	g := graph.Graph{Nodes: make([]graph.Node, 0, len(hubs)), Links: make([]graph.Link, 0)}
+	seen := make(map[string]struct{}, len(hubs))
+	for _, hub := range hubs {
+		g.Nodes = append(g.Nodes, graphNode(hub))
+		seen[hub.ID.Hex()] = struct{}{}
+	}
+
+	cypher := "MATCH (h:Asteroid)-[r:REFER]->(t:Asteroid) " +
+		"WHERE h.authorId = $authorId AND h.state = true AND h.hub = true " +
+		"AND t.authorId = $authorId AND t.state = true AND r.removedTime IS NULL " +
+		"RETURN h.id AS source, t"
+	result, err := session.Run(cypher, map[string]interface{}{"authorId": accID.Hex()})
 	if err != nil {
 		return nil, err
 	}
-	var g graph.Graph
-	for nodeResult.Next(ctx) {
-		var ast asteroid.Asteroid
-		err := nodeResult.Decode(&ast)
+	for result.Next() {
+		_source_, _ := result.Record().Get("source")
+		_t_, _ := result.Record().Get("t")
+		target := graphNode(nodeAsteroid(_t_.(neo4j.Node)))
+		g.Links = append(g.Links, graph.Link{Source: _source_.(string), Target: target.ID})
+		if _, ok := seen[target.ID]; !ok {
+			seen[target.ID] = struct{}{}
+			g.Nodes = append(g.Nodes, target)
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// FindPaths lets Neo4j search the shortest path alone. Several paths are
+// searched in memory with graph.SearchPaths, as matching variable-length
+// patterns would list every path before keeping the shortest.
+func (x *GraphRepo) FindPaths(ctx context.Context, accID primitive.ObjectID, q *graph.PathQuery) ([]*graph.Graph, error) {
+	if q.Limit > 1 {
+		g, err := x.GetFullGraph(ctx, accID, time.Time{})
 		if err != nil {
 			return nil, err
 		}
-		g.Nodes = append(g.Nodes, graph.Node{
-			ID:    ast.ID.Hex(),
-			Hub:   ast.Hub,
-			Title: ast.Title,
-		})
+		return graph.SearchPaths(g, q), nil
 	}
 
 	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer session.Close()
 
-	cypher := "MATCH (a1:Asteroid)-[:REFER]->(a2:Asteroid) " +
-		"WHERE a1.authorId=$authorId AND a2.authorId=$authorId " +
-		"RETURN a1, a2"
+	relTypes := make([]string, 0, len(q.RelationTypes))
+	for _, typ := range q.RelationTypes {
+		relTypes = append(relTypes, string(typ))
+	}
+	arrow := "-"
+	if q.Directed {
+		arrow = "->"
+	}
+	rel := fmt.Sprintf("-[:%s*1..%d]%s", strings.Join(relTypes, "|"), q.MaxLength, arrow)
+	cypher := "MATCH (a:Asteroid {id: $from}), (b:Asteroid {id: $to}) " +
+		"MATCH p = shortestPath((a)" + rel + "(b)) " +
+		"WHERE all(n IN nodes(p) WHERE n.authorId = $authorId AND n.state = true) " +
+		"AND all(r IN relationships(p) WHERE r.removedTime IS NULL) " +
+		"RETURN p"
 
-	linkResult, err := session.Run(cypher, map[string]interface{}{
+	result, err := session.Run(cypher, map[string]interface{}{
+		"from":     q.From.Hex(),
+		"to":       q.To.Hex(),
 		"authorId": accID.Hex(),
 	})
 	if err != nil {
 		return nil, err
 	}
-	for linkResult.Next() {
-		_a1_, _ := linkResult.Record().Get("a1")
-		_a2_, _ := linkResult.Record().Get("a2")
-		a1 := _a1_.(neo4j.Node)
-		a2 := _a2_.(neo4j.Node)
-		a1ID := a1.Props["id"].(string)
-		a2ID := a2.Props["id"].(string)
-		g.Links = append(g.Links, graph.Link{
-			Source: a1ID,
-			Target: a2ID,
-		})
+
+	paths := make([]*graph.Graph, 0, q.Limit)
+	for result.Next() {
+		_p, _ := result.Record().Get("p")
+		p := _p.(neo4j.Path)
+
+		g := &graph.Graph{
+			Nodes: make([]graph.Node, 0, len(p.Nodes)),
+			Links: make([]graph.Link, 0, len(p.Relationships)),
+		}
+		nodeIDs := make(map[int64]string, len(p.Nodes))
+		for _, node := range p.Nodes {
+			n := graphNode(nodeAsteroid(node))
+			nodeIDs[node.Id] = n.ID
+			g.Nodes = append(g.Nodes, n)
+		}
+		for _, rel := range p.Relationships {
+			g.Links = append(g.Links, graph.Link{
+				Source: nodeIDs[rel.StartId],
+				Target: nodeIDs[rel.EndId],
+			})
+		}
+		paths = append(paths, g)
 	}
-	return &g, nil
+	return paths, result.Err()
+}
+
+func (x *GraphRepo) GetLayout(ctx context.Context, accID primitive.ObjectID) (*graph.Layout, error) {
+	var layout graph.Layout
+	err := x._mongo.Collection(_GraphLayoutCollection).FindOne(ctx, bson.D{{"_id", accID}}).Decode(&layout)
+	if err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+func (x *GraphRepo) SaveLayout(ctx context.Context, layout *graph.Layout) error {
+	_, err := x._mongo.Collection(_GraphLayoutCollection).ReplaceOne(ctx,
+		bson.D{{"_id", layout.AccountID}},
+		layout,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (x *GraphRepo) SetPosition(ctx context.Context, accID primitive.ObjectID, astID string, pos *graph.Position) error {
+	_, err := x._mongo.Collection(_GraphLayoutCollection).UpdateOne(ctx, bson.D{{"_id", accID}}, bson.D{
+		{"$set", bson.D{
+			{"positions." + astID, pos},
+			{"updated_time", time.Now()},
+		}},
+	})
+	return err
+}
+
+// listNodes reads the nodes of the given hex IDs, keeping their order.
+func listNodes(session neo4j.Session, hexIDs []string) ([]graph.Node, error) {
+	if len(hexIDs) == 0 {
+		return []graph.Node{}, nil
+	}
+	result, err := session.Run("MATCH (a:Asteroid) WHERE a.id IN $ids RETURN a", map[string]interface{}{"ids": hexIDs})
+	if err != nil {
+		return nil, err
+	}
+	asts, err := collectAsteroids(result, "a")
+	if err != nil {
+		return nil, err
+	}
+
+	nodeMap := make(map[string]graph.Node, len(asts))
+	for _, ast := range asts {
+		nodeMap[ast.ID.Hex()] = graphNode(ast)
+	}
+	nodes := make([]graph.Node, 0, len(nodeMap))
+	for _, hexID := range hexIDs {
+		if node, ok := nodeMap[hexID]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
 }
@@ -0,0 +1,384 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ graph.Repo = (*BoltGraphRepo)(nil)
+
+// BoltGraphRepo answers graph queries from the embedded store. Neighborhoods
+// and the hub graph follow the adjacency buckets, the rest loads the whole
+// graph of the account and computes in memory, hygiene groups and paths
+// included. At 20,000 asteroids and twice as many links such a request takes
+// about a third of a second, the most the store is meant to serve.
+type BoltGraphRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltGraphRepo(_bolt *bbolt.DB) *BoltGraphRepo {
+	return &BoltGraphRepo{_bolt: _bolt}
+}
+
+func (x *BoltGraphRepo) GetGraphByAsteroidID(ctx context.Context, accID primitive.ObjectID, q *graph.NeighborhoodQuery) (*graph.Graph, error) {
+	return x.expand(accID, []primitive.ObjectID{q.AsteroidID}, q.Depth, q.Direction, q.Limit, q.AsOf)
+}
+
+func (x *BoltGraphRepo) GetGraphByAsteroidIDs(ctx context.Context, accID primitive.ObjectID, ids []primitive.ObjectID, q *graph.CollectionQuery) (*graph.Graph, error) {
+	return x.expand(accID, ids, q.Hops, q.Direction, q.Limit, time.Time{})
+}
+
+// expand walks breadth first from the seeds, which are at distance zero, and
+// returns the visited nodes along with the links among them. The current graph
+// is walked through the adjacency index, a past one through the links existing then.
+func (x *BoltGraphRepo) expand(accID primitive.ObjectID, seeds []primitive.ObjectID, depth int, direction graph.Direction, limit int, asOf time.Time) (*graph.Graph, error) {
+	g := graph.Graph{Nodes: make([]graph.Node, 0), Links: make([]graph.Link, 0)}
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		neighbors := func(id primitive.ObjectID) ([]primitive.ObjectID, error) {
+			var linked []primitive.ObjectID
+			if direction != graph.DirectionIn {
+				out, err := boltLinked(tx, id, true)
+				if err != nil {
+					return nil, err
+				}
+				linked = append(linked, out...)
+			}
+			if direction != graph.DirectionOut {
+				in, err := boltLinked(tx, id, false)
+				if err != nil {
+					return nil, err
+				}
+				linked = append(linked, in...)
+			}
+			return linked, nil
+		}
+		var links []*linkDoc
+		if !asOf.IsZero() {
+			var err error
+			if links, err = listBoltLinks(tx, accID, asOf); err != nil {
+				return err
+			}
+			adjacency := make(map[primitive.ObjectID][]primitive.ObjectID)
+			for _, link := range links {
+				if direction != graph.DirectionIn {
+					adjacency[link.From] = append(adjacency[link.From], link.To)
+				}
+				if direction != graph.DirectionOut {
+					adjacency[link.To] = append(adjacency[link.To], link.From)
+				}
+			}
+			neighbors = func(id primitive.ObjectID) ([]primitive.ObjectID, error) {
+				return adjacency[id], nil
+			}
+		}
+		// only the account's asteroids existing at asOf are walked through.
+		nodes := make(map[primitive.ObjectID]graph.Node)
+		visit := func(id primitive.ObjectID) (bool, error) {
+			ast, err := getBoltAsteroid(tx, id)
+			if err == mongo.ErrNoDocuments {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if ast.AuthorID != accID || !ast.State || (!asOf.IsZero() && ast.CreatedTime.After(asOf)) {
+				return false, nil
+			}
+			nodes[id] = graphNode(ast)
+			return true, nil
+		}
+
+		if len(seeds) > limit {
+			seeds, g.Truncated = seeds[:limit], true
+		}
+		distances := make(map[primitive.ObjectID]int, len(seeds))
+		ids := make([]primitive.ObjectID, 0, len(seeds))
+		for _, id := range seeds {
+			if _, ok := distances[id]; ok {
+				continue
+			}
+			distances[id] = 0
+			ok, err := visit(id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				ids = append(ids, id)
+			}
+		}
+		frontier := ids
+		for hop := 1; hop <= depth && len(frontier) != 0 && !g.Truncated; hop++ {
+			next := make([]primitive.ObjectID, 0)
+			for _, id := range frontier {
+				linked, err := neighbors(id)
+				if err != nil {
+					return err
+				}
+				for _, n := range linked {
+					if _, ok := distances[n]; ok {
+						continue
+					}
+					distances[n] = hop
+					ok, err := visit(n)
+					if err != nil {
+						return err
+					}
+					if ok {
+						next = append(next, n)
+					}
+				}
+			}
+			// keeps the same nodes as the other stores when some are left out.
+			sort.Slice(next, func(i, j int) bool { return next[i].Hex() < next[j].Hex() })
+			if remaining := limit - len(ids); len(next) > remaining {
+				next, g.Truncated = next[:remaining], true
+			}
+			ids = append(ids, next...)
+			frontier = next
+		}
+
+		kept := make(map[primitive.ObjectID]bool, len(ids))
+		for _, id := range ids {
+			node := nodes[id]
+			distance := distances[id]
+			node.Distance = &distance
+			g.Nodes = append(g.Nodes, node)
+			kept[id] = true
+		}
+		if asOf.IsZero() {
+			for _, id := range ids {
+				err := boltEach(tx.Bucket(_BoltLinkOut), id[:], func(k, v []byte) error {
+					if !kept[keyID(k, 1)] {
+						return nil
+					}
+					var doc linkDoc
+					if err := boltGet(tx.Bucket(_BoltLink), v, &doc); err != nil {
+						return err
+					}
+					g.Links = append(g.Links, graphLink(&doc))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, link := range links {
+			if kept[link.From] && kept[link.To] {
+				g.Links = append(g.Links, graphLink(link))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// listBoltLinks lists the links of the account existing at asOf, or now when asOf is zero.
+func listBoltLinks(tx *bbolt.Tx, accID primitive.ObjectID, asOf time.Time) ([]*linkDoc, error) {
+	links := make([]*linkDoc, 0)
+	err := eachBoltLink(tx, accID, func(doc *linkDoc) error {
+		if linkExistsAt(doc, asOf) {
+			links = append(links, doc)
+		}
+		return nil
+	})
+	return links, err
+}
+
+// listBoltNodes lists the nodes of the account's living asteroids matching, oldest first.
+func listBoltNodes(tx *bbolt.Tx, accID primitive.ObjectID, match func(*asteroid.Asteroid) bool) ([]graph.Node, error) {
+	asts := make([]*asteroid.Asteroid, 0)
+	err := eachBoltAsteroid(tx, accID, func(ast *asteroid.Asteroid) error {
+		if ast.State && match(ast) {
+			asts = append(asts, ast)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAsteroids(asts, asteroid.SortByCreatedTime, false)
+	nodes := make([]graph.Node, 0, len(asts))
+	for _, ast := range asts {
+		nodes = append(nodes, graphNode(ast))
+	}
+	return nodes, nil
+}
+
+func (x *BoltGraphRepo) GetFullGraph(ctx context.Context, accID primitive.ObjectID, asOf time.Time) (*graph.Graph, error) {
+	var g graph.Graph
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		var err error
+		g.Nodes, err = listBoltNodes(tx, accID, func(ast *asteroid.Asteroid) bool {
+			return asOf.IsZero() || !ast.CreatedTime.After(asOf)
+		})
+		if err != nil {
+			return err
+		}
+		links, err := listBoltLinks(tx, accID, asOf)
+		if err != nil {
+			return err
+		}
+		g.Links = make([]graph.Link, 0, len(links))
+		for _, link := range links {
+			g.Links = append(g.Links, graphLink(link))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (x *BoltGraphRepo) StreamFullGraph(ctx context.Context, accID primitive.ObjectID, v graph.Visitor) error {
+	return x._bolt.View(func(tx *bbolt.Tx) error {
+		err := eachBoltAsteroid(tx, accID, func(ast *asteroid.Asteroid) error {
+			if !ast.State {
+				return nil
+			}
+			return v.VisitNode(graphNode(ast))
+		})
+		if err != nil {
+			return err
+		}
+		return eachBoltLink(tx, accID, func(doc *linkDoc) error {
+			if doc.RemovedTime != nil {
+				return nil
+			}
+			return v.VisitLink(graphLink(doc))
+		})
+	})
+}
+
+func (x *BoltGraphRepo) ListEvents(ctx context.Context, accID primitive.ObjectID) ([]graph.Event, error) {
+	events := make([]graph.Event, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		err := eachBoltAsteroid(tx, accID, func(ast *asteroid.Asteroid) error {
+			if ast.State {
+				events = append(events, graph.Event{Kind: graph.EventNodeCreated, Time: ast.CreatedTime})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return eachBoltLink(tx, accID, func(doc *linkDoc) error {
+			events = append(events, graph.Event{Kind: graph.EventLinkCreated, Time: doc.CreatedTime})
+			if doc.RemovedTime != nil {
+				events = append(events, graph.Event{Kind: graph.EventLinkRemoved, Time: *doc.RemovedTime})
+			}
+			return nil
+		})
+	})
+	return events, err
+}
+
+func (x *BoltGraphRepo) ListHygiene(ctx context.Context, accID primitive.ObjectID, kind graph.HygieneKind, skip, limit int) ([]graph.Node, int64, error) {
+	g, err := x.GetFullGraph(ctx, accID, time.Time{})
+	if err != nil {
+		return nil, 0, err
+	}
+	nodes, total := pageHygiene(g, kind, skip, limit)
+	return nodes, total, nil
+}
+
+func (x *BoltGraphRepo) GetHubGraph(ctx context.Context, accID primitive.ObjectID) (*graph.Graph, error) {
+	g := graph.Graph{Links: make([]graph.Link, 0)}
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		var err error
+		g.Nodes, err = listBoltNodes(tx, accID, func(ast *asteroid.Asteroid) bool { return ast.Hub })
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(g.Nodes))
+		for _, hub := range g.Nodes {
+			seen[hub.ID] = true
+		}
+		hubs := g.Nodes
+		for _, hub := range hubs {
+			targets, err := boltLinked(tx, mustObjectID(hub.ID), true)
+			if err != nil {
+				return err
+			}
+			for _, id := range targets {
+				target, err := getBoltAsteroid(tx, id)
+				if err == mongo.ErrNoDocuments {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if target.AuthorID != accID || !target.State {
+					continue
+				}
+				if !seen[target.ID.Hex()] {
+					seen[target.ID.Hex()] = true
+					g.Nodes = append(g.Nodes, graphNode(target))
+				}
+				g.Links = append(g.Links, graph.Link{Source: hub.ID, Target: target.ID.Hex()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (x *BoltGraphRepo) FindPaths(ctx context.Context, accID primitive.ObjectID, q *graph.PathQuery) ([]*graph.Graph, error) {
+	g, err := x.GetFullGraph(ctx, accID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return graph.SearchPaths(g, q), nil
+}
+
+func (x *BoltGraphRepo) GetLayout(ctx context.Context, accID primitive.ObjectID) (*graph.Layout, error) {
+	var layout graph.Layout
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return boltGet(tx.Bucket(_BoltGraphLayout), accID[:], &layout)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+func (x *BoltGraphRepo) SaveLayout(ctx context.Context, layout *graph.Layout) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(_BoltGraphLayout), layout.AccountID[:], layout)
+	})
+}
+
+func (x *BoltGraphRepo) SetPosition(ctx context.Context, accID primitive.ObjectID, astID string, pos *graph.Position) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(_BoltGraphLayout)
+		var layout graph.Layout
+		if err := boltGet(bucket, accID[:], &layout); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+		if layout.Positions == nil {
+			layout.Positions = make(map[string]*graph.Position)
+		}
+		layout.Positions[astID] = pos
+		layout.UpdatedTime = time.Now()
+		return boltPut(bucket, accID[:], &layout)
+	})
+}
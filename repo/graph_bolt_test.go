@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBoltFindPaths(t *testing.T) {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "oort.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	asteroids := NewBoltAsteroidRepo(db)
+	authorID := primitive.NewObjectID()
+
+	create := func(title string, linkFrom ...primitive.ObjectID) primitive.ObjectID {
+		ast := &asteroid.Asteroid{
+			ID:          primitive.NewObjectID(),
+			State:       true,
+			AuthorID:    authorID,
+			Title:       title,
+			CreatedTime: time.Now(),
+			UpdatedTime: time.Now(),
+		}
+		require.NoError(t, asteroids.Create(ctx, ast, linkFrom, nil))
+		return ast.ID
+	}
+	// f -> a -> z, f -> b -> c -> z, and a loop between a and b.
+	f := create("f")
+	a := create("a", f)
+	b := create("b", f, a)
+	c := create("c", b)
+	z := create("z", a, c)
+	require.NoError(t, asteroids.LinkTo(ctx, b, []primitive.ObjectID{a}))
+
+	q := &graph.PathQuery{From: f, To: z, Directed: true, Limit: 5}
+	require.NoError(t, q.Normalize())
+	paths, err := NewBoltGraphRepo(db).FindPaths(ctx, authorID, q)
+	require.NoError(t, err)
+	hexes := func(ids ...primitive.ObjectID) []string {
+		s := make([]string, 0, len(ids))
+		for _, id := range ids {
+			s = append(s, id.Hex())
+		}
+		return s
+	}
+	got := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		nodes := make([]string, 0, len(p.Nodes))
+		for _, n := range p.Nodes {
+			nodes = append(nodes, n.ID)
+		}
+		got = append(got, nodes)
+	}
+	// paths of the same length come in the order of the IDs, a was created before c.
+	assert.Equal(t, [][]string{
+		hexes(f, a, z),
+		hexes(f, b, a, z),
+		hexes(f, b, c, z),
+		hexes(f, a, b, c, z),
+	}, got)
+
+	// undirected, z also reaches back to c and a.
+	q = &graph.PathQuery{From: z, To: f, Limit: 1}
+	require.NoError(t, q.Normalize())
+	paths, err = NewBoltGraphRepo(db).FindPaths(ctx, authorID, q)
+	require.NoError(t, err)
+	if assert.Len(t, paths, 1) {
+		assert.Len(t, paths[0].Links, 2)
+	}
+}
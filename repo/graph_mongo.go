@@ -0,0 +1,589 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compile-time interface implementation check.
+var _ graph.Repo = (*MongoGraphRepo)(nil)
+
+// MongoGraphRepo answers graph queries from the links collection, for the
+// deployments running without Neo4j. Layouts are shared with GraphRepo.
+type MongoGraphRepo struct {
+	*GraphRepo
+}
+
+func NewMongoGraphRepo(_mongo *mongo.Database) *MongoGraphRepo {
+	return &MongoGraphRepo{
+		GraphRepo: NewGraphRepo(_mongo, nil),
+	}
+}
+
+func (x *MongoGraphRepo) GetGraphByAsteroidID(ctx context.Context, accID primitive.ObjectID, q *graph.NeighborhoodQuery) (*graph.Graph, error) {
+	return x.expand(ctx, accID, []primitive.ObjectID{q.AsteroidID}, q.Depth, q.Direction, q.Limit, q.AsOf)
+}
+
+func (x *MongoGraphRepo) GetGraphByAsteroidIDs(ctx context.Context, accID primitive.ObjectID, ids []primitive.ObjectID, q *graph.CollectionQuery) (*graph.Graph, error) {
+	return x.expand(ctx, accID, ids, q.Hops, q.Direction, q.Limit, time.Time{})
+}
+
+// expand walks up to depth hops from the seeds one hop at a time, and keeps
+// the limit nearest nodes, the seeds first. Like GraphRepo.expand, every hop
+// only reads up to the nodes still fitting, so the work stays proportional to
+// the nodes returned.
+//
+// $graphLookup can't do that: it has no limit per hop, and gathers every link
+// within maxDepth into the array of a single document before anything can be
+// cut. On a well linked account that outgrows the 16MB document limit and the
+// 100MB memory cap of the stage, which can't spill to disk.
+func (x *MongoGraphRepo) expand(ctx context.Context, accID primitive.ObjectID, seeds []primitive.ObjectID, depth int, direction graph.Direction, limit int, asOf time.Time) (*graph.Graph, error) {
+	truncated := false
+	if len(seeds) > limit {
+		seeds, truncated = seeds[:limit], true
+	}
+	visited := append([]primitive.ObjectID{}, seeds...)
+	distances := make(map[primitive.ObjectID]int, len(seeds))
+	for _, id := range seeds {
+		distances[id] = 0
+	}
+
+	frontier := seeds
+	for hop := 1; hop <= depth && len(frontier) != 0 && !truncated; hop++ {
+		linked, err := x.neighborIDs(ctx, accID, frontier, direction, asOf)
+		if err != nil {
+			return nil, err
+		}
+		// asks for one more node than fits, to know whether any was left out.
+		remaining := limit - len(visited)
+		filter := bson.D{
+			{"_id", bson.D{{"$in", linked}, {"$nin", visited}}},
+			{"author_id", accID},
+			{"state", true},
+		}
+		if !asOf.IsZero() {
+			filter = append(filter, bson.E{Key: "created_time", Value: bson.D{{"$lte", asOf}}})
+		}
+		result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, filter, options.Find().
+			SetProjection(bson.D{{"_id", 1}}).
+			SetSort(bson.D{{"_id", 1}}).
+			SetLimit(int64(remaining+1)))
+		if err != nil {
+			return nil, err
+		}
+		var found []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := result.All(ctx, &found); err != nil {
+			return nil, err
+		}
+		if len(found) > remaining {
+			found, truncated = found[:remaining], true
+		}
+		next := make([]primitive.ObjectID, 0, len(found))
+		for _, f := range found {
+			distances[f.ID] = hop
+			visited = append(visited, f.ID)
+			next = append(next, f.ID)
+		}
+		frontier = next
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(distances))
+	for id := range distances {
+		ids = append(ids, id)
+	}
+	filter := bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"author_id", accID},
+		{"state", true},
+	}
+	if !asOf.IsZero() {
+		filter = append(filter, bson.E{Key: "created_time", Value: bson.D{{"$lte", asOf}}})
+	}
+	nodes, err := x.findNodes(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		di, dj := distances[mustObjectID(nodes[i].ID)], distances[mustObjectID(nodes[j].ID)]
+		if di != dj {
+			return di < dj
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	g := graph.Graph{Nodes: nodes, Truncated: truncated}
+	kept := make([]primitive.ObjectID, 0, len(nodes))
+	for i := range g.Nodes {
+		id := mustObjectID(g.Nodes[i].ID)
+		distance := distances[id]
+		g.Nodes[i].Distance = &distance
+		kept = append(kept, id)
+	}
+	linkFilter := append(bson.D{
+		{"from", bson.D{{"$in", kept}}},
+		{"to", bson.D{{"$in", kept}}},
+	}, linkExistsFilter(asOf)...)
+	if g.Links, err = findLinks(ctx, x._mongo, linkFilter); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// neighborIDs lists the asteroids one existing link away from the frontier in
+// the direction, through the indexes on from, to and ends. The frontier
+// itself can be among them when both ways are followed.
+func (x *MongoGraphRepo) neighborIDs(ctx context.Context, accID primitive.ObjectID, frontier []primitive.ObjectID, direction graph.Direction, asOf time.Time) ([]primitive.ObjectID, error) {
+	end, other := "from", "to"
+	switch direction {
+	case graph.DirectionIn:
+		end, other = other, end
+	case graph.DirectionBoth:
+		end, other = "ends", "ends"
+	}
+	filter := append(bson.D{
+		{end, bson.D{{"$in", frontier}}},
+		{"author_id", accID},
+	}, linkExistsFilter(asOf)...)
+	result, err := x._mongo.Collection(_LinkCollection).Distinct(ctx, other, filter)
+	if err != nil {
+		return nil, err
+	}
+	linked := make([]primitive.ObjectID, 0, len(result))
+	for _, v := range result {
+		if id, ok := v.(primitive.ObjectID); ok {
+			linked = append(linked, id)
+		}
+	}
+	return linked, nil
+}
+
+func mustObjectID(hexID string) primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(hexID)
+	return id
+}
+
+// findNodes reads the nodes of the asteroids matching the filter, oldest first.
+func (x *MongoGraphRepo) findNodes(ctx context.Context, filter bson.D) ([]graph.Node, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, filter, options.Find().
+		SetProjection(bson.D{{"content", 0}}).
+		SetSort(bson.D{{"created_time", 1}, {"_id", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	nodes := make([]graph.Node, 0)
+	for result.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := result.Decode(&ast); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, graphNode(&ast))
+	}
+	return nodes, result.Err()
+}
+
+func (x *MongoGraphRepo) GetFullGraph(ctx context.Context, accID primitive.ObjectID, asOf time.Time) (*graph.Graph, error) {
+	filter := bson.D{
+		{"author_id", accID},
+		{"state", true},
+	}
+	if !asOf.IsZero() {
+		filter = append(filter, bson.E{Key: "created_time", Value: bson.D{{"$lte", asOf}}})
+	}
+	nodes, err := x.findNodes(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	links, err := findLinks(ctx, x._mongo, append(bson.D{{"author_id", accID}}, linkExistsFilter(asOf)...))
+	if err != nil {
+		return nil, err
+	}
+	// like GraphRepo, links to asteroids left out are left out too.
+	kept := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		kept[node.ID] = true
+	}
+	alive := make([]graph.Link, 0, len(links))
+	for _, link := range links {
+		if kept[link.Source] && kept[link.Target] {
+			alive = append(alive, link)
+		}
+	}
+	return &graph.Graph{Nodes: nodes, Links: alive}, nil
+}
+
+// removedIDs lists the account's removed asteroids, which links can still
+// point to.
+func (x *MongoGraphRepo) removedIDs(ctx context.Context, accID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Distinct(ctx, "_id", bson.D{
+		{"author_id", accID},
+		{"state", false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(result))
+	for _, v := range result {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (x *MongoGraphRepo) StreamFullGraph(ctx context.Context, accID primitive.ObjectID, v graph.Visitor) error {
+	nodeResult, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{
+		{"author_id", accID},
+		{"state", true},
+	}, options.Find().SetProjection(bson.D{{"content", 0}}).SetBatchSize(_StreamBatchSize))
+	if err != nil {
+		return err
+	}
+	defer nodeResult.Close(ctx)
+
+	// the nodes aren't kept as they are streamed, so the links to removed
+	// asteroids are filtered out by the store, like GraphRepo does.
+	removed, err := x.removedIDs(ctx, accID)
+	if err != nil {
+		return err
+	}
+	linkResult, err := x._mongo.Collection(_LinkCollection).Find(ctx, bson.D{
+		{"author_id", accID},
+		{"removed_time", nil},
+		{"from", bson.D{{"$nin", removed}}},
+		{"to", bson.D{{"$nin", removed}}},
+	}, options.Find().SetBatchSize(_StreamBatchSize))
+	if err != nil {
+		return err
+	}
+	defer linkResult.Close(ctx)
+
+	// takes one record from each side in turn, both are fetched in batches.
+	nodesDone, linksDone := false, false
+	for !nodesDone || !linksDone {
+		if !nodesDone {
+			if nodeResult.Next(ctx) {
+				var ast asteroid.Asteroid
+				if err := nodeResult.Decode(&ast); err != nil {
+					return err
+				}
+				if err := v.VisitNode(graphNode(&ast)); err != nil {
+					return err
+				}
+			} else if err := nodeResult.Err(); err != nil {
+				return err
+			} else {
+				nodesDone = true
+			}
+		}
+		if !linksDone {
+			if linkResult.Next(ctx) {
+				var doc linkDoc
+				if err := linkResult.Decode(&doc); err != nil {
+					return err
+				}
+				if err := v.VisitLink(graphLink(&doc)); err != nil {
+					return err
+				}
+			} else if err := linkResult.Err(); err != nil {
+				return err
+			} else {
+				linksDone = true
+			}
+		}
+	}
+	return nil
+}
+
+func (x *MongoGraphRepo) ListEvents(ctx context.Context, accID primitive.ObjectID) ([]graph.Event, error) {
+	nodes, err := x.findNodes(ctx, bson.D{
+		{"author_id", accID},
+		{"state", true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]graph.Event, 0, len(nodes))
+	for _, node := range nodes {
+		events = append(events, graph.Event{Kind: graph.EventNodeCreated, Time: node.CreatedTime})
+	}
+
+	result, err := x._mongo.Collection(_LinkCollection).Find(ctx, bson.D{{"author_id", accID}})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+	for result.Next(ctx) {
+		var doc linkDoc
+		if err := result.Decode(&doc); err != nil {
+			return nil, err
+		}
+		events = append(events, graph.Event{Kind: graph.EventLinkCreated, Time: doc.CreatedTime})
+		if doc.RemovedTime != nil {
+			events = append(events, graph.Event{Kind: graph.EventLinkRemoved, Time: *doc.RemovedTime})
+		}
+	}
+	return events, result.Err()
+}
+
+// _MongoHygieneConditions match the asteroids of a hygiene group, once their
+// existing links out and in were looked up. Like GraphRepo, links to removed
+// asteroids count.
+var _MongoHygieneConditions = map[graph.HygieneKind]bson.D{
+	graph.HygieneOrphan:   {{"out", bson.A{}}, {"in", bson.A{}}},
+	graph.HygieneDeadEnd:  {{"out", bson.A{}}, {"in.0", bson.D{{"$exists", true}}}},
+	graph.HygieneEmptyHub: {{"hub", true}, {"out", bson.A{}}},
+}
+
+// ListHygiene looks up the links of the account's asteroids in the database,
+// which only returns the page. The unreachable group walks the links from the
+// hubs first, through their IDs only.
+func (x *MongoGraphRepo) ListHygiene(ctx context.Context, accID primitive.ObjectID, kind graph.HygieneKind, skip, limit int) ([]graph.Node, int64, error) {
+	pipeline := mongo.Pipeline{{{"$match", bson.D{{"author_id", accID}, {"state", true}}}}}
+	if kind == graph.HygieneUnreachable {
+		reachable, err := x.reachableFromHubs(ctx, accID)
+		if err != nil {
+			return nil, 0, err
+		}
+		pipeline = append(pipeline, bson.D{{"$match", bson.D{{"_id", bson.D{{"$nin", reachable}}}}}})
+	} else {
+		for _, end := range []struct{ field, as string }{{"from", "out"}, {"to", "in"}} {
+			pipeline = append(pipeline,
+				bson.D{{"$lookup", bson.D{
+					{"from", _LinkCollection},
+					{"localField", "_id"},
+					{"foreignField", end.field},
+					{"as", end.as},
+				}}},
+				bson.D{{"$addFields", bson.D{{end.as, bson.D{{"$filter", bson.D{
+					{"input", "$" + end.as},
+					{"cond", bson.D{{"$eq", bson.A{"$$this.removed_time", nil}}}},
+				}}}}}}},
+			)
+		}
+		pipeline = append(pipeline, bson.D{{"$match", _MongoHygieneConditions[kind]}})
+	}
+	pipeline = append(pipeline, bson.D{{"$facet", bson.D{
+		{"total", bson.A{bson.D{{"$count", "n"}}}},
+		{"page", bson.A{
+			bson.D{{"$sort", bson.D{{"created_time", 1}, {"_id", 1}}}},
+			bson.D{{"$skip", skip}},
+			bson.D{{"$limit", limit}},
+			bson.D{{"$project", bson.D{{"content", 0}, {"out", 0}, {"in", 0}}}},
+		}},
+	}}})
+
+	result, err := x._mongo.Collection(_AsteroidCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	var facets []struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Page []*asteroid.Asteroid `bson:"page"`
+	}
+	if err := result.All(ctx, &facets); err != nil {
+		return nil, 0, err
+	}
+	nodes := make([]graph.Node, 0)
+	var total int64
+	if len(facets) != 0 {
+		if len(facets[0].Total) != 0 {
+			total = facets[0].Total[0].N
+		}
+		for _, ast := range facets[0].Page {
+			nodes = append(nodes, graphNode(ast))
+		}
+	}
+	return nodes, total, nil
+}
+
+// reachableFromHubs lists the asteroids the hubs of the account lead to, hubs
+// included, one hop at a time like graph.FindHygiene does.
+func (x *MongoGraphRepo) reachableFromHubs(ctx context.Context, accID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Distinct(ctx, "_id", bson.D{
+		{"author_id", accID},
+		{"state", true},
+		{"hub", true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	frontier := make([]primitive.ObjectID, 0, len(result))
+	for _, v := range result {
+		if id, ok := v.(primitive.ObjectID); ok {
+			frontier = append(frontier, id)
+		}
+	}
+	distances, err := x.distances(ctx, accID, frontier, graph.DirectionOut, -1)
+	if err != nil {
+		return nil, err
+	}
+	reachable := make([]primitive.ObjectID, 0, len(distances))
+	for id := range distances {
+		reachable = append(reachable, id)
+	}
+	return reachable, nil
+}
+
+// distances walks up to depth hops from the seeds through the account's
+// living asteroids, or as far as the links go when depth is negative, and
+// returns how many hops away every asteroid met is. Only IDs are read.
+func (x *MongoGraphRepo) distances(ctx context.Context, accID primitive.ObjectID, seeds []primitive.ObjectID, direction graph.Direction, depth int) (map[primitive.ObjectID]int, error) {
+	distances := make(map[primitive.ObjectID]int, len(seeds))
+	for _, id := range seeds {
+		distances[id] = 0
+	}
+	frontier := seeds
+	for hop := 1; (depth < 0 || hop <= depth) && len(frontier) != 0; hop++ {
+		linked, err := x.neighborIDs(ctx, accID, frontier, direction, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		unseen := make([]primitive.ObjectID, 0, len(linked))
+		for _, id := range linked {
+			if _, ok := distances[id]; !ok {
+				unseen = append(unseen, id)
+			}
+		}
+		living, err := x._mongo.Collection(_AsteroidCollection).Distinct(ctx, "_id", bson.D{
+			{"_id", bson.D{{"$in", unseen}}},
+			{"author_id", accID},
+			{"state", true},
+		})
+		if err != nil {
+			return nil, err
+		}
+		frontier = make([]primitive.ObjectID, 0, len(living))
+		for _, v := range living {
+			if id, ok := v.(primitive.ObjectID); ok {
+				distances[id] = hop
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return distances, nil
+}
+
+// pageHygiene returns a page of the nodes of the graph in the hygiene group,
+// and the size of the whole group, for the stores grouping the graph in memory.
+func pageHygiene(g *graph.Graph, kind graph.HygieneKind, skip, limit int) ([]graph.Node, int64) {
+	nodes := graph.FindHygiene(g, kind)
+	total := int64(len(nodes))
+	if skip > len(nodes) {
+		skip = len(nodes)
+	}
+	nodes = nodes[skip:]
+	if len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return nodes, total
+}
+
+func (x *MongoGraphRepo) GetHubGraph(ctx context.Context, accID primitive.ObjectID) (*graph.Graph, error) {
+	hubs, err := x.findNodes(ctx, bson.D{
+		{"author_id", accID},
+		{"state", true},
+		{"hub", true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	hubIDs := make([]primitive.ObjectID, 0, len(hubs))
+	for _, hub := range hubs {
+		hubIDs = append(hubIDs, mustObjectID(hub.ID))
+	}
+	links, err := findLinks(ctx, x._mongo, bson.D{
+		{"author_id", accID},
+		{"from", bson.D{{"$in", hubIDs}}},
+		{"removed_time", nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	targetIDs := make([]primitive.ObjectID, 0, len(links))
+	for _, link := range links {
+		targetIDs = append(targetIDs, mustObjectID(link.Target))
+	}
+	targets, err := x.findNodes(ctx, bson.D{
+		{"_id", bson.D{{"$in", targetIDs}}},
+		{"author_id", accID},
+		{"state", true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := graph.Graph{Nodes: hubs, Links: make([]graph.Link, 0, len(links))}
+	seen := make(map[string]bool, len(hubs)+len(targets))
+	for _, hub := range hubs {
+		seen[hub.ID] = true
+	}
+	for _, target := range targets {
+		if !seen[target.ID] {
+			seen[target.ID] = true
+			g.Nodes = append(g.Nodes, target)
+		}
+	}
+	for _, link := range links {
+		if seen[link.Target] {
+			g.Links = append(g.Links, graph.Link{Source: link.Source, Target: link.Target})
+		}
+	}
+	return &g, nil
+}
+
+// FindPaths only loads the asteroids whose hops from both ends add up to no
+// more than q.MaxLength, as no other can be on a path short enough, then
+// searches them in memory.
+func (x *MongoGraphRepo) FindPaths(ctx context.Context, accID primitive.ObjectID, q *graph.PathQuery) ([]*graph.Graph, error) {
+	forward, backward := graph.DirectionBoth, graph.DirectionBoth
+	if q.Directed {
+		forward, backward = graph.DirectionOut, graph.DirectionIn
+	}
+	fromDistances, err := x.distances(ctx, accID, []primitive.ObjectID{q.From}, forward, q.MaxLength)
+	if err != nil {
+		return nil, err
+	}
+	toDistances, err := x.distances(ctx, accID, []primitive.ObjectID{q.To}, backward, q.MaxLength)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0)
+	for id, fromDistance := range fromDistances {
+		if toDistance, ok := toDistances[id]; ok && fromDistance+toDistance <= q.MaxLength {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []*graph.Graph{}, nil
+	}
+
+	g := graph.Graph{}
+	if g.Nodes, err = x.findNodes(ctx, bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"author_id", accID},
+		{"state", true},
+	}); err != nil {
+		return nil, err
+	}
+	if g.Links, err = findLinks(ctx, x._mongo, bson.D{
+		{"from", bson.D{{"$in", ids}}},
+		{"to", bson.D{{"$in", ids}}},
+		{"removed_time", nil},
+	}); err != nil {
+		return nil, err
+	}
+	return graph.SearchPaths(&g, q), nil
+}
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/graph"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// _LinkCollection keeps the REFER edges between asteroids when Mongo is the
+// graph store, see conf.GraphMongo.
+const _LinkCollection = "links"
+
+// linkDoc is a REFER edge. Like in Neo4j, links are never deleted, unlinking
+// sets their removed time instead.
+type linkDoc struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// AuthorID owns both ends, links only join asteroids of the same account.
+	AuthorID primitive.ObjectID `bson:"author_id"`
+	From     primitive.ObjectID `bson:"from"`
+	To       primitive.ObjectID `bson:"to"`
+	// Ends holds both From and To, so links can be followed both ways at once.
+	Ends        []primitive.ObjectID `bson:"ends"`
+	CreatedTime time.Time            `bson:"created_time"`
+	RemovedTime *time.Time           `bson:"removed_time"`
+}
+
+// EnsureLinkIndexes creates the indexes of the links collection. At most one
+// existing link can join two asteroids, so concurrent links are not stored twice.
+// Duplicates stored before have to be removed for the unique index to be built.
+func EnsureLinkIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(_LinkCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"from", 1}, {"to", 1}}},
+		{Keys: bson.D{{"to", 1}}},
+		{Keys: bson.D{{"ends", 1}}},
+		{Keys: bson.D{{"author_id", 1}}},
+		// removed_time is part of the keys only to tell the index from the one above.
+		{
+			Keys: bson.D{{"from", 1}, {"to", 1}, {"removed_time", 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{"removed_time", bson.D{{"$type", "null"}}}}),
+		},
+	})
+	return err
+}
+
+// linkExistsFilter matches the links existing at asOf, or now when asOf is zero.
+func linkExistsFilter(asOf time.Time) bson.D {
+	if asOf.IsZero() {
+		return bson.D{{"removed_time", nil}}
+	}
+	return bson.D{
+		{"created_time", bson.D{{"$lte", asOf}}},
+		{"$or", bson.A{
+			bson.D{{"removed_time", nil}},
+			bson.D{{"removed_time", bson.D{{"$gt", asOf}}}},
+		}},
+	}
+}
+
+// linkModel creates the link unless it already exists.
+func linkModel(authorID, from, to primitive.ObjectID, createdTime time.Time) mongo.WriteModel {
+	return mongo.NewUpdateOneModel().
+		SetFilter(bson.D{
+			{"from", from},
+			{"to", to},
+			{"removed_time", nil},
+		}).
+		SetUpdate(bson.D{{"$setOnInsert", bson.D{
+			{"_id", primitive.NewObjectID()},
+			{"author_id", authorID},
+			{"ends", bson.A{from, to}},
+			{"created_time", createdTime},
+			// kept explicitly, the unique index only covers links whose removed time is null.
+			{"removed_time", nil},
+		}}}).
+		SetUpsert(true)
+}
+
+// unlinkModel removes the link if it exists.
+func unlinkModel(from, to primitive.ObjectID, removedTime time.Time) mongo.WriteModel {
+	return mongo.NewUpdateManyModel().
+		SetFilter(bson.D{
+			{"from", from},
+			{"to", to},
+			{"removed_time", nil},
+		}).
+		SetUpdate(bson.D{{"$set", bson.D{{"removed_time", removedTime}}}})
+}
+
+func graphLink(doc *linkDoc) graph.Link {
+	return graph.Link{
+		Source:      doc.From.Hex(),
+		Target:      doc.To.Hex(),
+		CreatedTime: doc.CreatedTime,
+	}
+}
+
+func findLinks(ctx context.Context, db *mongo.Database, filter bson.D) ([]graph.Link, error) {
+	result, err := db.Collection(_LinkCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	links := make([]graph.Link, 0)
+	for result.Next(ctx) {
+		var doc linkDoc
+		if err := result.Decode(&doc); err != nil {
+			return nil, err
+		}
+		links = append(links, graphLink(&doc))
+	}
+	return links, result.Err()
+}
+
+// findLinkedIDs lists the other end of the existing links whose end is one of ids.
+// out follows the links from ids, otherwise it follows them back.
+func findLinkedIDs(ctx context.Context, db *mongo.Database, ids []primitive.ObjectID, out bool) ([]primitive.ObjectID, error) {
+	end, other := "from", "to"
+	if !out {
+		end, other = other, end
+	}
+	result, err := db.Collection(_LinkCollection).Distinct(ctx, other, bson.D{
+		{end, bson.D{{"$in", ids}}},
+		{"removed_time", nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	linked := make([]primitive.ObjectID, 0, len(result))
+	for _, v := range result {
+		if id, ok := v.(primitive.ObjectID); ok {
+			linked = append(linked, id)
+		}
+	}
+	return linked, nil
+}
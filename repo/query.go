@@ -0,0 +1,276 @@
+package repo
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/query"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compile-time interface implementation check.
+var _ query.Repo = (*QueryRepo)(nil)
+
+// _MaxLinkedTargets bounds how many asteroids the inner query of a graph
+// predicate may match.
+const _MaxLinkedTargets = 5000
+
+var _QueryFields = map[query.Field]string{
+	query.FieldHub:     "hub",
+	query.FieldTitle:   "title",
+	query.FieldContent: "content",
+	query.FieldType:    "type",
+	query.FieldViews:   "view_count",
+	query.FieldCreated: "created_time",
+	query.FieldUpdated: "updated_time",
+}
+
+var _QueryOps = map[query.Op]string{
+	query.OpEq:  "$eq",
+	query.OpNe:  "$ne",
+	query.OpLt:  "$lt",
+	query.OpLte: "$lte",
+	query.OpGt:  "$gt",
+	query.OpGte: "$gte",
+}
+
+// Only the ids of the matched asteroids go through the cypher, the other
+// asteroid end of the link is always bound by $ids.
+var _LinkedCyphers = map[query.LinkDirection]string{
+	query.LinksTo: "MATCH (a:Asteroid)-[r:REFER]->(b:Asteroid) " +
+		"WHERE b.id IN $ids AND a.authorId = $authorId AND b.authorId = $authorId AND r.removedTime IS NULL " +
+		"RETURN DISTINCT a.id AS id",
+	query.LinkedFrom: "MATCH (a:Asteroid)<-[r:REFER]-(b:Asteroid) " +
+		"WHERE b.id IN $ids AND a.authorId = $authorId AND b.authorId = $authorId AND r.removedTime IS NULL " +
+		"RETURN DISTINCT a.id AS id",
+}
+
+type QueryRepo struct {
+	_mongo *mongo.Database
+	_neo4j neo4j.Driver
+	// follow returns the hex IDs of the asteroids linked in the direction with
+	// one of the targets, from the graph store in use.
+	follow func(ctx context.Context, accID primitive.ObjectID, direction query.LinkDirection, targets []primitive.ObjectID) ([]string, error)
+}
+
+func NewQueryRepo(_mongo *mongo.Database, _neo4j neo4j.Driver) *QueryRepo {
+	x := &QueryRepo{
+		_mongo: _mongo,
+		_neo4j: _neo4j,
+	}
+	x.follow = x.followNeo4j
+	return x
+}
+
+// NewMongoQueryRepo follows the links of the links collection, for the
+// deployments running without Neo4j.
+func NewMongoQueryRepo(_mongo *mongo.Database) *QueryRepo {
+	x := &QueryRepo{
+		_mongo: _mongo,
+	}
+	x.follow = x.followMongo
+	return x
+}
+
+// compileFilter turns the field filter of a query into a mongo filter of the
+// account's living asteroids.
+func compileFilter(accID primitive.ObjectID, e query.Expr) bson.D {
+	filter := bson.D{
+		{"author_id", accID},
+		{"state", true},
+	}
+	if e != nil {
+		filter = append(filter, bson.E{Key: "$and", Value: bson.A{compileExpr(e)}})
+	}
+	return filter
+}
+
+func compileExpr(e query.Expr) bson.D {
+	switch x := e.(type) {
+	case *query.And:
+		return bson.D{{"$and", compileTerms(x.Terms)}}
+	case *query.Or:
+		return bson.D{{"$or", compileTerms(x.Terms)}}
+	case *query.Not:
+		return bson.D{{"$nor", bson.A{compileExpr(x.Expr)}}}
+	case *query.Compare:
+		field := _QueryFields[x.Field]
+		if x.Op == query.OpContains {
+			return bson.D{{field, primitive.Regex{Pattern: regexp.QuoteMeta(x.Value.(string)), Options: "i"}}}
+		}
+		return bson.D{{field, bson.D{{_QueryOps[x.Op], x.Value}}}}
+	}
+	// graph predicates never reach the field filter, match nothing just in case.
+	return bson.D{{"_id", bson.D{{"$exists", false}}}}
+}
+
+func compileTerms(terms []query.Expr) bson.A {
+	a := make(bson.A, 0, len(terms))
+	for _, term := range terms {
+		a = append(a, compileExpr(term))
+	}
+	return a
+}
+
+// remaining is what's left of the context deadline, used as the timeout of
+// the stores that don't follow the context.
+func remaining(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return query.Timeout
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return time.Millisecond
+	}
+	return d
+}
+
+func (x *QueryRepo) Run(ctx context.Context, accID primitive.ObjectID, e query.Expr, limit int) ([]*asteroid.Asteroid, error) {
+	filter, linked := query.Split(e)
+
+	var candidates []string
+	for i, l := range linked {
+		ids, err := x.linked(ctx, accID, l)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			candidates = ids
+		} else {
+			candidates = intersect(candidates, ids)
+		}
+		if len(candidates) == 0 {
+			return []*asteroid.Asteroid{}, nil
+		}
+	}
+
+	mongoFilter := compileFilter(accID, filter)
+	if len(linked) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(candidates))
+		for _, id := range candidates {
+			if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+				ids = append(ids, oid)
+			}
+		}
+		mongoFilter = append(mongoFilter, bson.E{Key: "_id", Value: bson.D{{"$in", ids}}})
+	}
+
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, mongoFilter, options.Find().
+		SetProjection(bson.D{{"content", 0}}).
+		SetSort(bson.D{{"updated_time", -1}, {"_id", -1}}).
+		SetLimit(int64(limit)).
+		SetMaxTime(remaining(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	asts := make([]*asteroid.Asteroid, 0)
+	for result.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := result.Decode(&ast); err != nil {
+			return nil, err
+		}
+		asts = append(asts, &ast)
+	}
+	return asts, result.Err()
+}
+
+// linked returns the ids of the account's asteroids satisfying the graph predicate.
+func (x *QueryRepo) linked(ctx context.Context, accID primitive.ObjectID, l *query.Linked) ([]string, error) {
+	result, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, compileFilter(accID, l.Query), options.Find().
+		SetProjection(bson.D{{"_id", 1}}).
+		SetLimit(_MaxLinkedTargets+1).
+		SetMaxTime(remaining(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	targets := make([]primitive.ObjectID, 0)
+	for result.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := result.Decode(&doc); err != nil {
+			return nil, err
+		}
+		targets = append(targets, doc.ID)
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) > _MaxLinkedTargets {
+		return nil, query.ErrTooManyMatches
+	}
+	if len(targets) == 0 {
+		return []string{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ids, err := x.follow(ctx, accID, l.Direction, targets)
+	if err != nil {
+		return nil, err
+	}
+	return ids, ctx.Err()
+}
+
+func (x *QueryRepo) followNeo4j(ctx context.Context, accID primitive.ObjectID, direction query.LinkDirection, targets []primitive.ObjectID) ([]string, error) {
+	hexIDs := make([]string, 0, len(targets))
+	for _, id := range targets {
+		hexIDs = append(hexIDs, id.Hex())
+	}
+
+	session := x._neo4j.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
+
+	records, err := session.Run(_LinkedCyphers[direction], map[string]interface{}{
+		"ids":      hexIDs,
+		"authorId": accID.Hex(),
+	}, neo4j.WithTxTimeout(remaining(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for records.Next() {
+		id, _ := records.Record().Get("id")
+		ids = append(ids, id.(string))
+	}
+	return ids, records.Err()
+}
+
+func (x *QueryRepo) followMongo(ctx context.Context, accID primitive.ObjectID, direction query.LinkDirection, targets []primitive.ObjectID) ([]string, error) {
+	// links_to looks for the sources of the links to the targets.
+	linked, err := findLinkedIDs(ctx, x._mongo, targets, direction == query.LinkedFrom)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(linked))
+	for _, id := range linked {
+		ids = append(ids, id.Hex())
+	}
+	return ids, nil
+}
+
+func intersect(a, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, id := range b {
+		set[id] = struct{}{}
+	}
+	kept := make([]string, 0)
+	for _, id := range a {
+		if _, ok := set[id]; ok {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/query"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// compile-time interface implementation check.
+var _ query.Repo = (*BoltQueryRepo)(nil)
+
+// BoltQueryRepo evaluates queries against every asteroid of the account, and
+// follows graph predicates through the adjacency index.
+type BoltQueryRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltQueryRepo(_bolt *bbolt.DB) *BoltQueryRepo {
+	return &BoltQueryRepo{_bolt: _bolt}
+}
+
+func (x *BoltQueryRepo) Run(ctx context.Context, accID primitive.ObjectID, e query.Expr, limit int) ([]*asteroid.Asteroid, error) {
+	filter, linked := query.Split(e)
+	asts := make([]*asteroid.Asteroid, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		var candidates map[primitive.ObjectID]bool
+		for _, l := range linked {
+			ids, err := x.linked(ctx, tx, accID, l)
+			if err != nil {
+				return err
+			}
+			if candidates != nil {
+				for id := range candidates {
+					if !ids[id] {
+						delete(candidates, id)
+					}
+				}
+			} else {
+				candidates = ids
+			}
+			if len(candidates) == 0 {
+				return nil
+			}
+		}
+
+		return eachBoltAsteroid(tx, accID, func(ast *asteroid.Asteroid) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if ast.State && (candidates == nil || candidates[ast.ID]) && query.Match(filter, ast) {
+				ast.Content = ""
+				asts = append(asts, ast)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAsteroids(asts, asteroid.SortByUpdatedTime, true)
+	if len(asts) > limit {
+		asts = asts[:limit]
+	}
+	return asts, nil
+}
+
+// linked returns the ids of the account's asteroids satisfying the graph predicate.
+func (x *BoltQueryRepo) linked(ctx context.Context, tx *bbolt.Tx, accID primitive.ObjectID, l *query.Linked) (map[primitive.ObjectID]bool, error) {
+	targets := make([]primitive.ObjectID, 0)
+	err := eachBoltAsteroid(tx, accID, func(ast *asteroid.Asteroid) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ast.State && query.Match(l.Query, ast) {
+			targets = append(targets, ast.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) > _MaxLinkedTargets {
+		return nil, query.ErrTooManyMatches
+	}
+
+	// links_to looks for the sources of the links to the targets.
+	ids := make(map[primitive.ObjectID]bool)
+	for _, target := range targets {
+		linked, err := boltLinked(tx, target, l.Direction == query.LinkedFrom)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range linked {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/review"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compile-time interface implementation check.
+var _ review.Repo = (*ReviewRepo)(nil)
+
+const (
+	_ReviewCardCollection = "review_card"
+)
+
+type ReviewRepo struct {
+	_mongo *mongo.Database
+}
+
+func NewReviewRepo(_mongo *mongo.Database) *ReviewRepo {
+	return &ReviewRepo{_mongo: _mongo}
+}
+
+func (x *ReviewRepo) Create(ctx context.Context, card *review.Card) error {
+	_, err := x._mongo.Collection(_ReviewCardCollection).InsertOne(ctx, card)
+	return err
+}
+
+func (x *ReviewRepo) Update(ctx context.Context, card *review.Card) error {
+	_, err := x._mongo.Collection(_ReviewCardCollection).UpdateByID(ctx, card.ID, bson.D{{
+		"$set", bson.D{
+			{"updated_time", card.UpdatedTime},
+			{"repetitions", card.Repetitions},
+			{"interval_day", card.IntervalDay},
+			{"ease_factor", card.EaseFactor},
+			{"due_time", card.DueTime},
+			{"stats", card.Stats},
+		},
+	}})
+	return err
+}
+
+func (x *ReviewRepo) Delete(ctx context.Context, cardID primitive.ObjectID) error {
+	_, err := x._mongo.Collection(_ReviewCardCollection).UpdateByID(ctx, cardID, bson.D{{
+		"$set", bson.D{
+			{"state", false},
+			{"updated_time", time.Now()},
+		},
+	}})
+	return err
+}
+
+func (x *ReviewRepo) GetByAsteroidID(ctx context.Context, astID primitive.ObjectID) (*review.Card, error) {
+	card := new(review.Card)
+	err := x._mongo.Collection(_ReviewCardCollection).FindOne(ctx, bson.D{
+		{"asteroid_id", astID},
+		{"state", true},
+	}).Decode(card)
+	return card, err
+}
+
+func (x *ReviewRepo) ListDue(ctx context.Context, ownerID primitive.ObjectID, before time.Time, filter *review.DueFilter) ([]*review.Card, error) {
+	query := bson.D{
+		{"owner_id", ownerID},
+		{"state", true},
+		{"due_time", bson.D{{"$lt", before}}},
+	}
+	if filter.AsteroidIDs != nil {
+		query = append(query, bson.E{Key: "asteroid_id", Value: bson.D{{"$in", filter.AsteroidIDs}}})
+	}
+	if filter.Tag != "" {
+		query = append(query, bson.E{Key: "tags", Value: filter.Tag})
+	}
+
+	result, err := x._mongo.Collection(_ReviewCardCollection).Find(ctx, query,
+		options.Find().
+			SetSort(bson.D{{"due_time", 1}}).
+			SetLimit(int64(filter.Limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	cards := make([]*review.Card, 0)
+	for result.Next(ctx) {
+		var card review.Card
+		if err := result.Decode(&card); err != nil {
+			return nil, err
+		}
+		cards = append(cards, &card)
+	}
+	return cards, result.Err()
+}
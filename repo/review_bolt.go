@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/review"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ review.Repo = (*BoltReviewRepo)(nil)
+
+type BoltReviewRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltReviewRepo(_bolt *bbolt.DB) *BoltReviewRepo {
+	return &BoltReviewRepo{_bolt: _bolt}
+}
+
+func (x *BoltReviewRepo) Create(ctx context.Context, card *review.Card) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(_BoltReviewCard), card.ID[:], card)
+	})
+}
+
+func (x *BoltReviewRepo) Update(ctx context.Context, card *review.Card) error {
+	return x.update(card.ID, func(c *review.Card) {
+		c.UpdatedTime = card.UpdatedTime
+		c.Repetitions = card.Repetitions
+		c.IntervalDay = card.IntervalDay
+		c.EaseFactor = card.EaseFactor
+		c.DueTime = card.DueTime
+		c.Stats = card.Stats
+	})
+}
+
+func (x *BoltReviewRepo) Delete(ctx context.Context, cardID primitive.ObjectID) error {
+	return x.update(cardID, func(c *review.Card) {
+		c.State = false
+		c.UpdatedTime = time.Now()
+	})
+}
+
+// update applies fn to the card, if it exists.
+func (x *BoltReviewRepo) update(cardID primitive.ObjectID, fn func(*review.Card)) error {
+	return x._bolt.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(_BoltReviewCard)
+		var card review.Card
+		if err := boltGet(bucket, cardID[:], &card); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+		fn(&card)
+		return boltPut(bucket, cardID[:], &card)
+	})
+}
+
+func (x *BoltReviewRepo) GetByAsteroidID(ctx context.Context, astID primitive.ObjectID) (*review.Card, error) {
+	cards, err := x.find(func(card *review.Card) bool { return card.AsteroidID == astID })
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return new(review.Card), mongo.ErrNoDocuments
+	}
+	return cards[0], nil
+}
+
+func (x *BoltReviewRepo) ListDue(ctx context.Context, ownerID primitive.ObjectID, before time.Time, filter *review.DueFilter) ([]*review.Card, error) {
+	var asteroidIDs map[primitive.ObjectID]bool
+	if filter.AsteroidIDs != nil {
+		asteroidIDs = make(map[primitive.ObjectID]bool, len(filter.AsteroidIDs))
+		for _, id := range filter.AsteroidIDs {
+			asteroidIDs[id] = true
+		}
+	}
+	cards, err := x.find(func(card *review.Card) bool {
+		if card.OwnerID != ownerID || !card.DueTime.Before(before) {
+			return false
+		}
+		if asteroidIDs != nil && !asteroidIDs[card.AsteroidID] {
+			return false
+		}
+		return filter.Tag == "" || hasTag(card.Tags, filter.Tag)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].DueTime.Before(cards[j].DueTime) })
+	if filter.Limit > 0 && len(cards) > filter.Limit {
+		cards = cards[:filter.Limit]
+	}
+	return cards, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// find lists the living cards matching.
+func (x *BoltReviewRepo) find(match func(*review.Card) bool) ([]*review.Card, error) {
+	cards := make([]*review.Card, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		return boltEach(tx.Bucket(_BoltReviewCard), nil, func(_, v []byte) error {
+			var card review.Card
+			if err := bson.Unmarshal(v, &card); err != nil {
+				return err
+			}
+			if card.State && match(&card) {
+				cards = append(cards, &card)
+			}
+			return nil
+		})
+	})
+	return cards, err
+}
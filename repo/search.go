@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
+
 	"github.com/ProjectOort/oort-server/biz/search"
 	"github.com/olivere/elastic/v7"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,48 +21,122 @@ func NewSearchRepo(_es *elastic.Client) *SearchRepo {
 	return &SearchRepo{_es: _es}
 }
 
-func (x *SearchRepo) SearchAsteroid(ctx context.Context, text string, authorID primitive.ObjectID) ([]*search.Item, error) {
+// rangeQuery keeps the field within the range, nil when the range is open on both sides.
+func rangeQuery(field string, r search.TimeRange) elastic.Query {
+	if r.From.IsZero() && r.To.IsZero() {
+		return nil
+	}
+	q := elastic.NewRangeQuery(field)
+	if !r.From.IsZero() {
+		q.Gte(r.From)
+	}
+	if !r.To.IsZero() {
+		q.Lte(r.To)
+	}
+	return q
+}
+
+func (x *SearchRepo) SearchAsteroid(ctx context.Context, q *search.Query, authorID primitive.ObjectID) (*search.Result, error) {
 	query := elastic.NewBoolQuery()
-	query.Must(
-		elastic.NewMatchQuery("author_id", authorID.Hex()),
-		elastic.NewQueryStringQuery(text),
-	)
+	query.Must(elastic.NewMatchQuery("author_id", authorID.Hex()))
+	if q.Text != "" {
+		query.Must(elastic.NewQueryStringQuery(q.Text))
+	}
+	// filters narrow the hits without taking part in their scores.
+	if q.Hub != nil {
+		query.Filter(elastic.NewTermQuery("hub", *q.Hub))
+	}
+	if q.Type != nil {
+		query.Filter(elastic.NewTermQuery("type", *q.Type))
+	}
+	if r := rangeQuery("created_time", q.Created); r != nil {
+		query.Filter(r)
+	}
+	if r := rangeQuery("updated_time", q.Updated); r != nil {
+		query.Filter(r)
+	}
+
 	highlight := elastic.NewHighlight()
 	highlight.Fields(
 		elastic.NewHighlighterField("title").
-			PreTags("<em>").
-			PostTags("</em>").
+			PreTags(search.PreTag).
+			PostTags(search.PostTag).
 			NoMatchSize(50),
 		elastic.NewHighlighterField("content").
-			PreTags("<em>").
-			PostTags("</em>").
+			PreTags(search.PreTag).
+			PostTags(search.PostTag).
 			NoMatchSize(50),
 	)
 
-	result, err := x._es.Search().
+	service := x._es.Search().
 		Index(_AsteroidIndex).
 		Query(query).
 		Highlight(highlight).
-		From(0).
-		Size(10).
-		Do(ctx)
+		From(q.Skip()).
+		Size(q.Size).
+		TrackTotalHits(true)
+	if q.SortBy != search.SortByRelevance {
+		service = service.SortBy(elastic.NewFieldSort(string(q.SortBy)).Order(!q.Desc), elastic.NewScoreSort()).
+			TrackScores(true)
+	}
+	result, err := service.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
-	items := make([]*search.Item, 0, result.Hits.TotalHits.Value)
 
-	if result.Hits.TotalHits.Value > 0 {
-		for _, hit := range result.Hits.Hits {
-			var item search.Item
-			item.TargetID = hit.Id
-
-			title := hit.Highlight["title"]
+	res := &search.Result{
+		Items: make([]*search.Item, 0, len(result.Hits.Hits)),
+		Total: result.Hits.TotalHits.Value,
+	}
+	for _, hit := range result.Hits.Hits {
+		var item search.Item
+		item.Type = search.TypeAsteroid
+		item.TargetID = hit.Id
+		if hit.Score != nil {
+			item.Score = *hit.Score
+		}
+		if title := hit.Highlight["title"]; len(title) > 0 {
 			item.Title = title[0]
-			content := hit.Highlight["content"]
-			item.Content = content
-			items = append(items, &item)
 		}
+		item.Content = hit.Highlight["content"]
+		res.Items = append(res.Items, &item)
+	}
+	return res, nil
+}
+
+func (x *SearchRepo) CompleteTitle(ctx context.Context, prefix string, authorID primitive.ObjectID, limit int) ([]*search.Completion, error) {
+	// filters only, as the order does not depend on scores.
+	query := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("author_id", authorID.Hex()),
+		elastic.NewPrefixQuery("title_suffixes", prefix),
+	)
+	result, err := x._es.Search().
+		Index(_AsteroidIndex).
+		Query(query).
+		SortBy(elastic.NewFieldSort("hub").Desc(), elastic.NewFieldSort("updated_time").Desc()).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("title", "hub", "updated_time")).
+		Size(limit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return items, nil
+	completions := make([]*search.Completion, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		var doc asteroidDoc
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			return nil, err
+		}
+		id, err := primitive.ObjectIDFromHex(hit.Id)
+		if err != nil {
+			return nil, err
+		}
+		completions = append(completions, &search.Completion{
+			ID:          id,
+			Title:       doc.Title,
+			Hub:         doc.Hub,
+			UpdatedTime: doc.UpdatedTime,
+		})
+	}
+	return completions, nil
 }
@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/search"
+	"github.com/ProjectOort/oort-server/biz/suggest"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compile-time interface implementation check.
+var _ search.Repo = (*BoltSearchRepo)(nil)
+
+// BoltSearchRepo searches the inverted index of the embedded store. The score
+// of an asteroid is how many of the terms of the text it holds, ties by
+// relevance go to the latest updated.
+type BoltSearchRepo struct {
+	_bolt *bbolt.DB
+}
+
+func NewBoltSearchRepo(_bolt *bbolt.DB) *BoltSearchRepo {
+	return &BoltSearchRepo{_bolt: _bolt}
+}
+
+func (x *BoltSearchRepo) SearchAsteroid(ctx context.Context, q *search.Query, authorID primitive.ObjectID) (*search.Result, error) {
+	terms := suggest.Tokenize(q.Text)
+	res := &search.Result{Items: make([]*search.Item, 0)}
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		match := func(ast *asteroid.Asteroid) bool {
+			return ast.AuthorID == authorID && ast.State &&
+				(q.Hub == nil || ast.Hub == *q.Hub) &&
+				(q.Type == nil || ast.Type == *q.Type) &&
+				q.Created.Contains(ast.CreatedTime) &&
+				q.Updated.Contains(ast.UpdatedTime)
+		}
+
+		// without text, every asteroid matches with a zero score.
+		asts := make([]*asteroid.Asteroid, 0)
+		hits := make(map[primitive.ObjectID]int)
+		if q.Text == "" {
+			err := eachBoltAsteroid(tx, authorID, func(ast *asteroid.Asteroid) error {
+				if match(ast) {
+					asts = append(asts, ast)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			seen := make(map[string]bool, len(terms))
+			for _, term := range terms {
+				if seen[term] {
+					continue
+				}
+				seen[term] = true
+				prefix := append([]byte(term), 0)
+				err := boltEach(tx.Bucket(_BoltTerm), prefix, func(k, _ []byte) error {
+					var id primitive.ObjectID
+					copy(id[:], k[len(prefix):])
+					hits[id]++
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			for id := range hits {
+				ast, err := getBoltAsteroid(tx, id)
+				if err == mongo.ErrNoDocuments {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if match(ast) {
+					asts = append(asts, ast)
+				}
+			}
+		}
+
+		switch q.SortBy {
+		case search.SortByCreatedTime:
+			sortAsteroids(asts, asteroid.SortByCreatedTime, q.Desc)
+		case search.SortByUpdatedTime:
+			sortAsteroids(asts, asteroid.SortByUpdatedTime, q.Desc)
+		default:
+			sort.Slice(asts, func(i, j int) bool {
+				if hi, hj := hits[asts[i].ID], hits[asts[j].ID]; hi != hj {
+					return hi > hj
+				}
+				return asts[i].UpdatedTime.After(asts[j].UpdatedTime)
+			})
+		}
+
+		res.Total = int64(len(asts))
+		skip := q.Skip()
+		if skip > len(asts) {
+			skip = len(asts)
+		}
+		asts = asts[skip:]
+		if len(asts) > q.Size {
+			asts = asts[:q.Size]
+		}
+		for _, ast := range asts {
+			res.Items = append(res.Items, &search.Item{
+				Type:     search.TypeAsteroid,
+				TargetID: ast.ID.Hex(),
+				Title:    search.Highlight(ast.Title, terms, 100, 50),
+				Content:  []string{search.Highlight(ast.Content, terms, 100, 50)},
+				Score:    float64(hits[ast.ID]),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CompleteTitle scans the completion index under the prefix, then checks the
+// whole prefix against the titles found, as the index keeps only its start.
+func (x *BoltSearchRepo) CompleteTitle(ctx context.Context, prefix string, authorID primitive.ObjectID, limit int) ([]*search.Completion, error) {
+	key := titleKey(authorID, prefix, primitive.NilObjectID)
+	key = key[:len(key)-1-len(primitive.NilObjectID)]
+
+	completions := make([]*search.Completion, 0)
+	err := x._bolt.View(func(tx *bbolt.Tx) error {
+		seen := make(map[primitive.ObjectID]bool)
+		return boltEach(tx.Bucket(_BoltTitle), key, func(k, _ []byte) error {
+			var id primitive.ObjectID
+			copy(id[:], k[len(k)-len(id):])
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+			ast, err := getBoltAsteroid(tx, id)
+			if err != nil {
+				return err
+			}
+			if !search.Completes(ast.Title, prefix) {
+				return nil
+			}
+			completions = append(completions, &search.Completion{
+				ID:          ast.ID,
+				Title:       ast.Title,
+				Hub:         ast.Hub,
+				UpdatedTime: ast.UpdatedTime,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	search.SortCompletions(completions)
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+	return completions, nil
+}
@@ -0,0 +1,566 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ProjectOort/oort-server/biz/asteroid"
+	"github.com/ProjectOort/oort-server/biz/batch"
+	"github.com/ProjectOort/oort-server/biz/search"
+	"github.com/olivere/elastic/v7"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// _AsteroidIndexMapping is the mapping of the asteroid index. _AsteroidIndex is
+// an alias, the index behind it is named after it with the time it was built,
+// so a reindex can swap a new one in at once, which is also how a change to
+// the mapping reaches an existing index.
+//
+// title_suffixes keeps search.WordSuffixes of the title for completion, which
+// is a prefix query on them. Suffixes longer than ignore_above are left out, as
+// they would exceed the size of a term and fail the whole document.
+const _AsteroidIndexMapping = `{
+	"mappings": {
+		"properties": {
+			"author_id":      {"type": "keyword"},
+			"hub":            {"type": "boolean"},
+			"type":           {"type": "integer"},
+			"title":          {"type": "text", "analyzer": "cjk"},
+			"title_suffixes": {"type": "keyword", "ignore_above": 8191},
+			"content":        {"type": "text", "analyzer": "cjk"},
+			"created_time":   {"type": "date"},
+			"updated_time":   {"type": "date"}
+		}
+	}
+}`
+
+const (
+	// _IndexBatchSize is how many asteroids a single bulk request carries.
+	_IndexBatchSize = 500
+	// _IndexMaxAttempts is how many times an asteroid is tried before it is
+	// left for the next write or reindex to pick up.
+	_IndexMaxAttempts = 5
+	_IndexRetryDelay  = time.Second
+	_IndexMaxDelay    = time.Minute
+)
+
+// ErrIndexOutdated is returned when the index behind the alias was built with
+// an older mapping, lacking the fields newer queries rely on.
+var ErrIndexOutdated = errors.New("the asteroid index lacks title_suffixes, title completion finds nothing until `oort-server reindex-search` is run")
+
+type asteroidDoc struct {
+	AuthorID      string    `json:"author_id"`
+	Hub           bool      `json:"hub"`
+	Type          int       `json:"type"`
+	Title         string    `json:"title"`
+	TitleSuffixes []string  `json:"title_suffixes"`
+	Content       string    `json:"content"`
+	CreatedTime   time.Time `json:"created_time"`
+	UpdatedTime   time.Time `json:"updated_time"`
+}
+
+func newAsteroidDoc(a *asteroid.Asteroid) *asteroidDoc {
+	return &asteroidDoc{
+		AuthorID:      a.AuthorID.Hex(),
+		Hub:           a.Hub,
+		Type:          a.Type,
+		Title:         a.Title,
+		TitleSuffixes: search.WordSuffixes(a.Title),
+		Content:       a.Content,
+		CreatedTime:   a.CreatedTime,
+		UpdatedTime:   a.UpdatedTime,
+	}
+}
+
+// SearchIndexer keeps the asteroid index in step with Mongo. Writes enqueue
+// the IDs of the asteroids they touch, and a worker indexes the latest version
+// of each in bulk, deleting the ones gone from Mongo or no longer alive. As
+// every job reads Mongo again, jobs can be merged and retried in any order.
+type SearchIndexer struct {
+	_mongo *mongo.Database
+	_es    *elastic.Client
+	logger *zap.Logger
+
+	mu sync.Mutex
+	// pending maps the asteroids waiting to be indexed to their failed attempts.
+	pending map[primitive.ObjectID]int
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewSearchIndexer(logger *zap.Logger, _mongo *mongo.Database, _es *elastic.Client) *SearchIndexer {
+	return &SearchIndexer{
+		_mongo:  _mongo,
+		_es:     _es,
+		logger:  logger.Named("[SEARCH_INDEXER]"),
+		pending: make(map[primitive.ObjectID]int),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Enqueue schedules the asteroids to be indexed again. It never blocks.
+func (x *SearchIndexer) Enqueue(ids ...primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	x.mu.Lock()
+	for _, id := range ids {
+		x.pending[id] = 0
+	}
+	x.mu.Unlock()
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start creates the index if there is none yet and runs the worker until Close.
+func (x *SearchIndexer) Start() {
+	go func() {
+		defer close(x.done)
+		if err := x.EnsureIndex(context.Background()); errors.Is(err, ErrIndexOutdated) {
+			x.logger.Sugar().Errorf("The asteroid index needs a reindex: %v", err)
+		} else if err != nil {
+			x.logger.Sugar().Errorf("Failed to create the asteroid index, error:\n%+v", err)
+		}
+		x.run()
+	}()
+}
+
+// Close stops the worker once the asteroids already enqueued were tried once more.
+func (x *SearchIndexer) Close() {
+	close(x.stop)
+	<-x.done
+}
+
+func (x *SearchIndexer) run() {
+	delay := _IndexRetryDelay
+	for {
+		select {
+		case <-x.wake:
+		case <-x.stop:
+			x.flush()
+			return
+		}
+		if x.flush() {
+			delay = _IndexRetryDelay
+			continue
+		}
+		// something failed, backs off before trying again.
+		select {
+		case <-time.After(delay):
+		case <-x.stop:
+			x.flush()
+			return
+		}
+		if delay *= 2; delay > _IndexMaxDelay {
+			delay = _IndexMaxDelay
+		}
+		select {
+		case x.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush indexes what is pending in batches, and reports whether all of it succeeded.
+func (x *SearchIndexer) flush() bool {
+	ok := true
+	for {
+		x.mu.Lock()
+		ids := make([]primitive.ObjectID, 0, _IndexBatchSize)
+		attempts := make(map[primitive.ObjectID]int, _IndexBatchSize)
+		for id, n := range x.pending {
+			if len(ids) == _IndexBatchSize {
+				break
+			}
+			ids = append(ids, id)
+			attempts[id] = n
+			delete(x.pending, id)
+		}
+		x.mu.Unlock()
+		if len(ids) == 0 {
+			return ok
+		}
+
+		failed, err := x.index(context.Background(), ids)
+		if err != nil {
+			x.logger.Sugar().Warnf("Failed to index %d asteroids, error:\n%+v", len(ids), err)
+		}
+		if len(failed) == 0 {
+			continue
+		}
+		ok = false
+		x.mu.Lock()
+		for _, id := range failed {
+			if _, requeued := x.pending[id]; requeued {
+				// written again meanwhile, which starts over.
+				continue
+			}
+			if n := attempts[id] + 1; n < _IndexMaxAttempts {
+				x.pending[id] = n
+			} else {
+				x.logger.Sugar().Errorf("Gave up indexing asteroid %s after %d attempts", id.Hex(), n)
+			}
+		}
+		x.mu.Unlock()
+		return ok
+	}
+}
+
+// index writes the current version of the asteroids to the index, and returns
+// the ones that failed.
+func (x *SearchIndexer) index(ctx context.Context, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}})
+	if err != nil {
+		return ids, errors.WithStack(err)
+	}
+	asts := make([]*asteroid.Asteroid, 0, len(ids))
+	if err := cursor.All(ctx, &asts); err != nil {
+		return ids, errors.WithStack(err)
+	}
+	alive := make(map[primitive.ObjectID]*asteroid.Asteroid, len(asts))
+	for _, ast := range asts {
+		if ast.State {
+			alive[ast.ID] = ast
+		}
+	}
+
+	bulk := x._es.Bulk().Index(_AsteroidIndex)
+	for _, id := range ids {
+		if ast, ok := alive[id]; ok {
+			bulk.Add(elastic.NewBulkIndexRequest().Id(id.Hex()).Doc(newAsteroidDoc(ast)))
+		} else {
+			bulk.Add(elastic.NewBulkDeleteRequest().Id(id.Hex()))
+		}
+	}
+	failed, err := bulkFailures(bulk.Do(ctx))
+	if err != nil && failed == nil {
+		// the request did not go through at all.
+		return ids, err
+	}
+	return failed, err
+}
+
+// bulkFailures collects the asteroids a bulk request failed to write. Deleting
+// what is not in the index is no failure.
+func bulkFailures(res *elastic.BulkResponse, err error) ([]primitive.ObjectID, error) {
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	failed := make([]primitive.ObjectID, 0)
+	for _, item := range res.Items {
+		for action, r := range item {
+			if r.Status < 300 || action == "delete" && r.Status == http.StatusNotFound {
+				continue
+			}
+			id, err := primitive.ObjectIDFromHex(r.Id)
+			if err != nil {
+				continue
+			}
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) != 0 {
+		return failed, errors.Errorf("%d asteroids failed to be written to the index", len(failed))
+	}
+	return nil, nil
+}
+
+// EnsureIndex creates an index behind the alias if the alias does not exist
+// yet. An index named like the alias is left as it is, until a reindex. An
+// existing index without title_suffixes yields ErrIndexOutdated, the mapping of
+// a field can't be changed in place.
+func (x *SearchIndexer) EnsureIndex(ctx context.Context) error {
+	exists, err := x._es.IndexExists(_AsteroidIndex).Do(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if exists {
+		return x.checkMapping(ctx)
+	}
+	name, err := x.createIndex(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = x._es.Alias().Add(name, _AsteroidIndex).Do(ctx)
+	return errors.WithStack(err)
+}
+
+// checkMapping makes sure every index behind the alias maps title_suffixes.
+func (x *SearchIndexer) checkMapping(ctx context.Context) error {
+	indices, err := x._es.GetFieldMapping().Index(_AsteroidIndex).Field("title_suffixes").Do(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, index := range indices {
+		// {"mappings": {"title_suffixes": {...}}}, with empty mappings when the
+		// field is missing.
+		mapping, _ := index.(map[string]interface{})
+		fields, _ := mapping["mappings"].(map[string]interface{})
+		if _, ok := fields["title_suffixes"]; !ok {
+			return errors.WithStack(ErrIndexOutdated)
+		}
+	}
+	return nil
+}
+
+func (x *SearchIndexer) createIndex(ctx context.Context) (string, error) {
+	name := fmt.Sprintf("%s_%s", _AsteroidIndex, time.Now().Format("20060102150405"))
+	_, err := x._es.CreateIndex(name).BodyString(_AsteroidIndexMapping).Do(ctx)
+	return name, errors.WithStack(err)
+}
+
+// Reindex builds a new index from Mongo and swaps the alias onto it in a single
+// step, so searches are served all along, then drops the indices it replaced.
+// The server keeps writing through the alias to the old index while the new
+// one is filled, so once the alias is swapped every asteroid is copied once
+// more, and whatever the new index holds that is no longer alive is deleted,
+// to catch what changed in between. It returns the name of the new index and
+// how many asteroids it holds.
+//
+// An index named like the alias, from before the server owned it, has to be
+// deleted before the alias can take its name, searches fail in between.
+func (x *SearchIndexer) Reindex(ctx context.Context) (string, int64, error) {
+	name, err := x.createIndex(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := x.copyAll(ctx, name); err != nil {
+		return name, 0, err
+	}
+
+	aliases, err := x._es.Aliases().Do(ctx)
+	if err != nil {
+		return name, 0, errors.WithStack(err)
+	}
+	olds := aliases.IndicesByAlias(_AsteroidIndex)
+	if len(olds) == 0 {
+		exists, err := x._es.IndexExists(_AsteroidIndex).Do(ctx)
+		if err != nil {
+			return name, 0, errors.WithStack(err)
+		}
+		if exists {
+			if _, err := x._es.DeleteIndex(_AsteroidIndex).Do(ctx); err != nil {
+				return name, 0, errors.WithStack(err)
+			}
+		}
+	}
+	swap := x._es.Alias().Add(name, _AsteroidIndex)
+	for _, old := range olds {
+		swap.Remove(old, _AsteroidIndex)
+	}
+	if _, err := swap.Do(ctx); err != nil {
+		return name, 0, errors.WithStack(err)
+	}
+
+	indexed, err := x.copyAll(ctx, name)
+	if err != nil {
+		return name, indexed, err
+	}
+	pruned, err := x.prune(ctx, name)
+	if err != nil {
+		return name, indexed, err
+	}
+	if len(olds) != 0 {
+		if _, err := x._es.DeleteIndex(olds...).Do(ctx); err != nil {
+			return name, indexed, errors.WithStack(err)
+		}
+	}
+	return name, indexed - pruned, nil
+}
+
+// copyAll writes every alive asteroid to the index, and returns how many were written.
+func (x *SearchIndexer) copyAll(ctx context.Context, index string) (int64, error) {
+	cursor, err := x._mongo.Collection(_AsteroidCollection).Find(ctx, bson.D{{"state", true}},
+		options.Find().SetBatchSize(_IndexBatchSize))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer cursor.Close(ctx)
+
+	var written int64
+	reqs := make(map[primitive.ObjectID]elastic.BulkableRequest, _IndexBatchSize)
+	for cursor.Next(ctx) {
+		var ast asteroid.Asteroid
+		if err := cursor.Decode(&ast); err != nil {
+			return written, errors.WithStack(err)
+		}
+		reqs[ast.ID] = elastic.NewBulkIndexRequest().Id(ast.ID.Hex()).Doc(newAsteroidDoc(&ast))
+		if len(reqs) == _IndexBatchSize {
+			if err := x.write(ctx, index, reqs); err != nil {
+				return written, err
+			}
+			written += _IndexBatchSize
+			reqs = make(map[primitive.ObjectID]elastic.BulkableRequest, _IndexBatchSize)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return written, errors.WithStack(err)
+	}
+	if len(reqs) != 0 {
+		if err := x.write(ctx, index, reqs); err != nil {
+			return written, err
+		}
+		written += int64(len(reqs))
+	}
+	return written, nil
+}
+
+// prune deletes from the index the asteroids that are gone from Mongo or no
+// longer alive, and returns how many were deleted.
+func (x *SearchIndexer) prune(ctx context.Context, index string) (int64, error) {
+	scroll := x._es.Scroll(index).
+		Query(elastic.NewMatchAllQuery()).
+		FetchSource(false).
+		Size(_IndexBatchSize)
+	defer scroll.Clear(context.Background())
+
+	var pruned int64
+	for {
+		result, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return pruned, nil
+		}
+		if err != nil {
+			return pruned, errors.WithStack(err)
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(result.Hits.Hits))
+		for _, hit := range result.Hits.Hits {
+			if id, err := primitive.ObjectIDFromHex(hit.Id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		cursor, err := x._mongo.Collection(_AsteroidCollection).Find(ctx,
+			bson.D{{"_id", bson.D{{"$in", ids}}}, {"state", true}},
+			options.Find().SetProjection(bson.D{{"_id", 1}}))
+		if err != nil {
+			return pruned, errors.WithStack(err)
+		}
+		alive := make([]struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}, 0, len(ids))
+		if err := cursor.All(ctx, &alive); err != nil {
+			return pruned, errors.WithStack(err)
+		}
+		reqs := make(map[primitive.ObjectID]elastic.BulkableRequest)
+		for _, id := range ids {
+			reqs[id] = elastic.NewBulkDeleteRequest().Id(id.Hex())
+		}
+		for _, a := range alive {
+			delete(reqs, a.ID)
+		}
+		if len(reqs) == 0 {
+			continue
+		}
+		if err := x.write(ctx, index, reqs); err != nil {
+			return pruned, err
+		}
+		pruned += int64(len(reqs))
+	}
+}
+
+// write sends the requests to the index in bulk, retrying the ones that
+// failed, all of them when the request did not go through.
+func (x *SearchIndexer) write(ctx context.Context, index string, reqs map[primitive.ObjectID]elastic.BulkableRequest) error {
+	delay := _IndexRetryDelay
+	for attempt := 1; ; attempt++ {
+		bulk := x._es.Bulk().Index(index)
+		for _, req := range reqs {
+			bulk.Add(req)
+		}
+		failed, err := bulkFailures(bulk.Do(ctx))
+		if err == nil || attempt == _IndexMaxAttempts {
+			return err
+		}
+		if failed != nil {
+			retry := make(map[primitive.ObjectID]elastic.BulkableRequest, len(failed))
+			for _, id := range failed {
+				retry[id] = reqs[id]
+			}
+			reqs = retry
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// compile-time interface implementation check.
+var _ asteroid.Repo = (*IndexedAsteroidRepo)(nil)
+
+// IndexedAsteroidRepo enqueues the asteroids written through it to the indexer.
+type IndexedAsteroidRepo struct {
+	asteroid.Repo
+	indexer *SearchIndexer
+}
+
+func NewIndexedAsteroidRepo(repo asteroid.Repo, indexer *SearchIndexer) *IndexedAsteroidRepo {
+	return &IndexedAsteroidRepo{Repo: repo, indexer: indexer}
+}
+
+func (x *IndexedAsteroidRepo) Create(ctx context.Context, a *asteroid.Asteroid, linkFromIDs []primitive.ObjectID, linkToIDs []primitive.ObjectID) error {
+	if err := x.Repo.Create(ctx, a, linkFromIDs, linkToIDs); err != nil {
+		return err
+	}
+	x.indexer.Enqueue(a.ID)
+	return nil
+}
+
+func (x *IndexedAsteroidRepo) UpdateContent(ctx context.Context, a *asteroid.Asteroid) error {
+	if err := x.Repo.UpdateContent(ctx, a); err != nil {
+		return err
+	}
+	x.indexer.Enqueue(a.ID)
+	return nil
+}
+
+// compile-time interface implementation check.
+var _ batch.Repo = (*IndexedBatchRepo)(nil)
+
+// IndexedBatchRepo enqueues the asteroids a batch creates or updates to the indexer.
+type IndexedBatchRepo struct {
+	batch.Repo
+	indexer *SearchIndexer
+}
+
+func NewIndexedBatchRepo(repo batch.Repo, indexer *SearchIndexer) *IndexedBatchRepo {
+	return &IndexedBatchRepo{Repo: repo, indexer: indexer}
+}
+
+// Apply enqueues the touched asteroids after a commit, and after a diverged
+// batch too, as Mongo may keep its writes then. index re-reads Mongo, so an
+// asteroid that was restored after all is only indexed again as it is.
+func (x *IndexedBatchRepo) Apply(ctx context.Context, muts []*batch.Mutation) error {
+	err := x.Repo.Apply(ctx, muts)
+	if err != nil && !errors.Is(err, batch.ErrDiverged) {
+		return err
+	}
+	ids := make([]primitive.ObjectID, 0, len(muts))
+	for _, mut := range muts {
+		switch mut.Type {
+		case batch.OpCreate:
+			ids = append(ids, mut.Asteroid.ID)
+		case batch.OpUpdate:
+			ids = append(ids, mut.AsteroidID)
+		}
+	}
+	x.indexer.Enqueue(ids...)
+	return err
+}